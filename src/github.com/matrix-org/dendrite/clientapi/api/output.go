@@ -0,0 +1,37 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api contains the types which the client API writes to its output logs.
+package api
+
+// An OutputRevokedDevices is written when a user logs out one or more of their devices.
+// The access tokens of the devices have been revoked, so consumers should stop serving
+// any requests they are still processing for those devices.
+type OutputRevokedDevices struct {
+	// The Matrix user ID of the owner of the devices e.g '@alice:localhost'
+	UserID string
+	// The IDs of the devices which were logged out.
+	DeviceIDs []string
+}
+
+// An OutputClientData is written when a user changes their account data, so that consumers
+// can send the new data to the user's clients.
+type OutputClientData struct {
+	// The Matrix user ID of the owner of the data e.g '@alice:localhost'
+	UserID string
+	// The room the data is for, or an empty string for global account data.
+	RoomID string
+	// The type of the data which was changed e.g 'm.direct'
+	Type string
+}
@@ -16,18 +16,36 @@ package auth
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
 	"github.com/matrix-org/dendrite/clientapi/jsonerror"
 	"github.com/matrix-org/util"
 )
 
+// How long after a device was last seen before it is recorded again. This avoids writing to the
+// database on every request, such as each /sync long-poll.
+const lastSeenUpdateInterval = time.Minute
+
+// DeviceDatabase represents a database of devices which have been issued access tokens.
+type DeviceDatabase interface {
+	// Lookup the device which the given access token was issued to, including when it was last seen.
+	// Returns nil if the access token is unknown.
+	// Returns an error if there was a problem talking to the database.
+	GetDeviceByAccessToken(token string) (*authtypes.Device, error)
+	// Record that the device was used just now from the given IP address.
+	UpdateDeviceLastSeen(userID, deviceID, ip string) error
+}
+
 // VerifyAccessToken verifies that an access token was supplied in the given HTTP request
-// and returns the user ID it corresponds to. Returns resErr (an error response which can be
+// and returns the device it corresponds to. Returns resErr (an error response which can be
 // sent to the client) if the token is invalid or there was a problem querying the database.
-func VerifyAccessToken(req *http.Request) (userID string, resErr *util.JSONResponse) {
-	token, tokenErr := extractAccessToken(req)
+func VerifyAccessToken(req *http.Request, deviceDB DeviceDatabase) (device *authtypes.Device, resErr *util.JSONResponse) {
+	token, tokenErr := ExtractAccessToken(req)
 	if tokenErr != nil {
 		resErr = &util.JSONResponse{
 			Code: 401,
@@ -35,18 +53,43 @@ func VerifyAccessToken(req *http.Request) (userID string, resErr *util.JSONRespo
 		}
 		return
 	}
-	if token == "fail" {
-		res := util.ErrorResponse(fmt.Errorf("Fatal error"))
+	device, err := deviceDB.GetDeviceByAccessToken(token)
+	if err != nil {
+		res := httputil.LogThenError(req, err)
 		resErr = &res
+		return
+	}
+	if device == nil {
+		resErr = &util.JSONResponse{
+			Code: 401,
+			JSON: jsonerror.UnknownToken("Unknown token"),
+		}
+		return
+	}
+	nowMS := time.Now().UnixNano() / int64(time.Millisecond)
+	if nowMS-device.LastSeenTS < int64(lastSeenUpdateInterval/time.Millisecond) {
+		return
+	}
+	// Failing to update the last seen time shouldn't stop the request from being processed.
+	if err = deviceDB.UpdateDeviceLastSeen(device.UserID, device.ID, RemoteIP(req)); err != nil {
+		util.GetLogger(req.Context()).WithError(err).Warn("Failed to update device last seen time")
 	}
-	// TODO: Check the token against the database
-	userID = token
 	return
 }
 
-// extractAccessToken from a request, or return an error detailing what went wrong. The
+// RemoteIP returns the IP address of the client which made the request. If the request came
+// through a trusted reverse proxy, httputil.TrustProxies will have set this to the client's address.
+func RemoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// ExtractAccessToken from a request, or return an error detailing what went wrong. The
 // error message MUST be human-readable and comprehensible to the client.
-func extractAccessToken(req *http.Request) (string, error) {
+func ExtractAccessToken(req *http.Request) (string, error) {
 	// cf https://github.com/matrix-org/synapse/blob/v0.19.2/synapse/api/auth.py#L631
 	authBearer := req.Header.Get("Authorization")
 	queryToken := req.URL.Query().Get("access_token")
@@ -68,3 +111,19 @@ func extractAccessToken(req *http.Request) (string, error) {
 
 	return "", fmt.Errorf("missing access token")
 }
+
+// LocalpartFromUserID returns the localpart of a user ID e.g '@alice:localhost', which must
+// belong to this server. Returns an error if the user ID is invalid or belongs to a different server.
+func LocalpartFromUserID(userID, serverName string) (string, error) {
+	if !strings.HasPrefix(userID, "@") {
+		return "", fmt.Errorf("Invalid user ID: %s", userID)
+	}
+	parts := strings.SplitN(userID[1:], ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", fmt.Errorf("Invalid user ID: %s", userID)
+	}
+	if parts[1] != serverName {
+		return "", fmt.Errorf("User ID %s does not belong to this server", userID)
+	}
+	return parts[0], nil
+}
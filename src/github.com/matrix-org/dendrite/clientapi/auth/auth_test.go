@@ -0,0 +1,144 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+)
+
+type testDeviceDatabase map[string]authtypes.Device
+
+func (db testDeviceDatabase) GetDeviceByAccessToken(token string) (*authtypes.Device, error) {
+	dev, ok := db[token]
+	if !ok {
+		return nil, nil
+	}
+	return &dev, nil
+}
+
+func (db testDeviceDatabase) UpdateDeviceLastSeen(userID, deviceID, ip string) error {
+	return nil
+}
+
+var testDevices = testDeviceDatabase{
+	"abcdef": {ID: "MYDEVICE", UserID: "@alice:localhost", AccessToken: "abcdef"},
+}
+
+func TestVerifyAccessToken(t *testing.T) {
+	tests := []struct {
+		url          string
+		header       string
+		wantCode     int
+		wantErrCode  string
+		wantUserID   string
+		wantDeviceID string
+	}{
+		{url: "/sync?access_token=abcdef", wantUserID: "@alice:localhost", wantDeviceID: "MYDEVICE"},
+		{url: "/sync", header: "Bearer abcdef", wantUserID: "@alice:localhost", wantDeviceID: "MYDEVICE"},
+		{url: "/sync", wantCode: 401, wantErrCode: "M_MISSING_TOKEN"},
+		{url: "/sync", header: "Basic abcdef", wantCode: 401, wantErrCode: "M_MISSING_TOKEN"},
+		{url: "/sync?access_token=abcdef", header: "Bearer abcdef", wantCode: 401, wantErrCode: "M_MISSING_TOKEN"},
+		{url: "/sync?access_token=@alice:localhost", wantCode: 401, wantErrCode: "M_UNKNOWN_TOKEN"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatalf("TestVerifyAccessToken: failed to make request: %s", err)
+		}
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		device, resErr := VerifyAccessToken(req, testDevices)
+		if tt.wantCode != 0 {
+			if resErr == nil {
+				t.Errorf("TestVerifyAccessToken(%s, %q): want code %d, got device %+v", tt.url, tt.header, tt.wantCode, device)
+				continue
+			}
+			if resErr.Code != tt.wantCode {
+				t.Errorf("TestVerifyAccessToken(%s, %q): want code %d, got %d", tt.url, tt.header, tt.wantCode, resErr.Code)
+			}
+			if errCode := resErr.JSON.(*jsonerror.MatrixError).ErrCode; errCode != tt.wantErrCode {
+				t.Errorf("TestVerifyAccessToken(%s, %q): want errcode %s, got %s", tt.url, tt.header, tt.wantErrCode, errCode)
+			}
+			continue
+		}
+		if resErr != nil {
+			t.Errorf("TestVerifyAccessToken(%s, %q): want success, got %+v", tt.url, tt.header, resErr.JSON)
+			continue
+		}
+		if device.UserID != tt.wantUserID || device.ID != tt.wantDeviceID {
+			t.Errorf("TestVerifyAccessToken(%s, %q): want %s/%s, got %s/%s", tt.url, tt.header, tt.wantUserID, tt.wantDeviceID, device.UserID, device.ID)
+		}
+	}
+}
+
+// lastSeenDeviceDatabase counts the updates to the last seen time of its device.
+type lastSeenDeviceDatabase struct {
+	device  authtypes.Device
+	updates int
+}
+
+func (db *lastSeenDeviceDatabase) GetDeviceByAccessToken(token string) (*authtypes.Device, error) {
+	dev := db.device
+	return &dev, nil
+}
+
+func (db *lastSeenDeviceDatabase) UpdateDeviceLastSeen(userID, deviceID, ip string) error {
+	db.updates++
+	return nil
+}
+
+func TestVerifyAccessTokenUpdatesLastSeen(t *testing.T) {
+	nowMS := time.Now().UnixNano() / int64(time.Millisecond)
+	tests := []struct {
+		lastSeenTS  int64
+		wantUpdates int
+	}{
+		{nowMS, 0},
+		{nowMS - int64(2*lastSeenUpdateInterval/time.Millisecond), 1},
+	}
+	for _, tt := range tests {
+		db := &lastSeenDeviceDatabase{device: authtypes.Device{
+			ID: "MYDEVICE", UserID: "@alice:localhost", AccessToken: "abcdef", LastSeenTS: tt.lastSeenTS,
+		}}
+		req, err := http.NewRequest("GET", "/sync?access_token=abcdef", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, resErr := VerifyAccessToken(req, db); resErr != nil {
+			t.Fatalf("VerifyAccessToken: want success, got %+v", resErr.JSON)
+		}
+		if db.updates != tt.wantUpdates {
+			t.Errorf("last seen %dms ago: want %d updates, got %d", nowMS-tt.lastSeenTS, tt.wantUpdates, db.updates)
+		}
+	}
+}
+
+func TestLocalpartFromUserID(t *testing.T) {
+	localpart, err := LocalpartFromUserID("@alice:localhost", "localhost")
+	if err != nil || localpart != "alice" {
+		t.Errorf("LocalpartFromUserID(@alice:localhost): wanted alice got %q, %v", localpart, err)
+	}
+	for _, userID := range []string{"alice", "@alice", "@:localhost", "@alice:example.com"} {
+		if _, err = LocalpartFromUserID(userID, "localhost"); err == nil {
+			t.Errorf("LocalpartFromUserID(%q): wanted an error", userID)
+		}
+	}
+}
@@ -12,14 +12,12 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package config
+package authtypes
 
-// Sync contains the config information necessary to spin up a sync-server process.
-type Sync struct {
-	// The topic for events which are written by the room server output log.
-	RoomserverOutputTopic string `yaml:"roomserver_topic"`
-	// A list of URIs to consume events from. These kafka logs should be produced by a Room Server.
-	KafkaConsumerURIs []string `yaml:"consumer_uris"`
-	// The postgres connection config for connecting to the database e.g a postgres:// URI
-	DataSource string `yaml:"database"`
+// Account represents a Matrix account on this home server.
+type Account struct {
+	// The localpart of the Matrix user ID e.g 'alice' for '@alice:localhost'
+	Localpart string
+	// When this account was created, as a unix timestamp (ms resolution).
+	CreatedTS int64
 }
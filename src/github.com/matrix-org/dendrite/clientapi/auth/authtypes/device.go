@@ -0,0 +1,33 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package authtypes provides the types that are used when authenticating clients.
+package authtypes
+
+// Device represents a client's device (mobile, web, etc) which has been issued an access token.
+type Device struct {
+	// The device ID, which is unique per user.
+	ID string
+	// The Matrix user ID of the owner of this device e.g '@alice:localhost'
+	UserID string
+	// The access_token granted to this device.
+	// This uniquely identifies the device from all other devices and clients.
+	AccessToken string
+	// The display name of the device, as chosen by the user. Can be empty.
+	DisplayName string
+	// When the device was last used, as a unix timestamp (ms resolution).
+	LastSeenTS int64
+	// The IP address the device was last used from.
+	LastSeenIP string
+}
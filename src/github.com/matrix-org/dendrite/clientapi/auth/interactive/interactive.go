@@ -0,0 +1,238 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package interactive implements the user-interactive authentication API.
+// http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#user-interactive-authentication-api
+package interactive
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/util"
+)
+
+// DefaultSessionTimeout is how long a session may go without being used before it expires.
+const DefaultSessionTimeout = 10 * time.Minute
+
+// The length of generated session IDs.
+const sessionIDLength = 24
+
+// DefaultMaxSessions is how many sessions are kept at most. Starting a session needs nothing but
+// a request, so once there are this many the least recently used session is discarded.
+const DefaultMaxSessions = 10000
+
+// Flow is one possible way that the client can complete user-interactive auth.
+type Flow struct {
+	Stages []authtypes.LoginType `json:"stages"`
+}
+
+// Response is the body of the 401 response which tells the client which stages are
+// still required. It includes a Matrix error if the client failed a stage.
+type Response struct {
+	Flows     []Flow                              `json:"flows"`
+	Completed []authtypes.LoginType               `json:"completed"`
+	Params    map[authtypes.LoginType]interface{} `json:"params"`
+	Session   string                              `json:"session"`
+	*jsonerror.MatrixError
+}
+
+// authDict is the common part of the "auth" dictionary which clients submit for every stage.
+type authDict struct {
+	Type    authtypes.LoginType `json:"type"`
+	Session string              `json:"session"`
+}
+
+// session is the server-side state of a user-interactive auth session.
+type session struct {
+	completed []authtypes.LoginType
+	// The user the session was started for, or "" for unauthenticated requests.
+	userID   string
+	lastUsed time.Time
+}
+
+// UserInteractive guards a request with user-interactive auth. Sessions are kept in memory
+// and are discarded once a flow is complete, they haven't been used for the timeout, or
+// they are the least recently used when there are too many.
+// It is safe to use from multiple goroutines.
+type UserInteractive struct {
+	flows       []Flow
+	stages      map[authtypes.LoginType]Stage
+	timeout     time.Duration
+	maxSessions int
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+
+	sessionsMutex sync.Mutex
+	sessions      map[string]*session
+}
+
+// New makes a UserInteractive which accepts any of the given flows. Each flow is the list of
+// stages which must all be completed. Sessions expire after not being used for the timeout.
+func New(timeout time.Duration, flows ...[]Stage) *UserInteractive {
+	u := &UserInteractive{
+		stages:      make(map[authtypes.LoginType]Stage),
+		timeout:     timeout,
+		maxSessions: DefaultMaxSessions,
+		now:         time.Now,
+		sessions:    make(map[string]*session),
+	}
+	for _, stages := range flows {
+		var f Flow
+		for _, s := range stages {
+			f.Stages = append(f.Stages, s.Type())
+			u.stages[s.Type()] = s
+		}
+		u.flows = append(u.flows, f)
+	}
+	return u
+}
+
+// Verify checks the "auth" dictionary of a request body against the session it refers to.
+// userID is the user making the request, or "" if the request is not authenticated; a session
+// can only be continued by the user who started it. Returns resErr (a response which can be sent
+// to the client) if the client needs to complete more stages or the dictionary is invalid.
+// Returns nil once a flow has been completed, after which the session can't be used again.
+func (u *UserInteractive) Verify(req *http.Request, rawAuthDict json.RawMessage, userID string) *util.JSONResponse {
+	var dict authDict
+	if len(rawAuthDict) > 0 {
+		if err := json.Unmarshal(rawAuthDict, &dict); err != nil {
+			return &util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON("The 'auth' dictionary could not be parsed: " + err.Error()),
+			}
+		}
+	}
+
+	u.sessionsMutex.Lock()
+	defer u.sessionsMutex.Unlock()
+	u.expireSessions()
+
+	// Clients start a session by making the request without an auth dictionary.
+	if dict.Type == "" && dict.Session == "" {
+		if len(u.sessions) >= u.maxSessions {
+			u.evictLeastRecentlyUsedSession()
+		}
+		sessionID := util.RandomString(sessionIDLength)
+		u.sessions[sessionID] = &session{userID: userID, lastUsed: u.now()}
+		return u.challenge(sessionID, nil)
+	}
+
+	sess := u.sessions[dict.Session]
+	if sess == nil || sess.userID != userID {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.Unknown("Unknown session"),
+		}
+	}
+	sess.lastUsed = u.now()
+
+	// The client may poll the session without attempting a stage.
+	if dict.Type == "" {
+		return u.challenge(dict.Session, nil)
+	}
+
+	stage := u.stages[dict.Type]
+	if stage == nil {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("Unknown auth.type: " + string(dict.Type)),
+		}
+	}
+	if err := stage.Validate(req, rawAuthDict, userID); err != nil {
+		return u.challenge(dict.Session, err)
+	}
+
+	if !hasStage(sess.completed, dict.Type) {
+		sess.completed = append(sess.completed, dict.Type)
+	}
+	for _, f := range u.flows {
+		if flowComplete(f, sess.completed) {
+			delete(u.sessions, dict.Session)
+			return nil
+		}
+	}
+	return u.challenge(dict.Session, nil)
+}
+
+// challenge returns the 401 response listing the flows and the stages completed so far in the session.
+// The session mutex must be held.
+func (u *UserInteractive) challenge(sessionID string, matrixErr *jsonerror.MatrixError) *util.JSONResponse {
+	completed := []authtypes.LoginType{}
+	if sess := u.sessions[sessionID]; sess != nil {
+		completed = append(completed, sess.completed...)
+	}
+	params := make(map[authtypes.LoginType]interface{})
+	for loginType, stage := range u.stages {
+		if p := stage.Params(); p != nil {
+			params[loginType] = p
+		}
+	}
+	return &util.JSONResponse{
+		Code: 401,
+		JSON: Response{
+			Flows:       u.flows,
+			Completed:   completed,
+			Params:      params,
+			Session:     sessionID,
+			MatrixError: matrixErr,
+		},
+	}
+}
+
+// expireSessions removes the sessions which haven't been used for the timeout.
+// The session mutex must be held.
+func (u *UserInteractive) expireSessions() {
+	now := u.now()
+	for id, sess := range u.sessions {
+		if now.Sub(sess.lastUsed) > u.timeout {
+			delete(u.sessions, id)
+		}
+	}
+}
+
+// evictLeastRecentlyUsedSession removes the session which was used longest ago.
+// The session mutex must be held.
+func (u *UserInteractive) evictLeastRecentlyUsedSession() {
+	var oldestID string
+	var oldest *session
+	for id, sess := range u.sessions {
+		if oldest == nil || sess.lastUsed.Before(oldest.lastUsed) {
+			oldestID, oldest = id, sess
+		}
+	}
+	delete(u.sessions, oldestID)
+}
+
+func flowComplete(f Flow, completed []authtypes.LoginType) bool {
+	for _, s := range f.Stages {
+		if !hasStage(completed, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasStage(stages []authtypes.LoginType, stage authtypes.LoginType) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interactive
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+)
+
+// failStage is a stage which the client completes by sending "pass": true.
+type failStage struct{}
+
+func (failStage) Type() authtypes.LoginType { return "m.login.test" }
+func (failStage) Params() interface{}       { return map[string]string{"hint": "pass"} }
+func (failStage) Validate(req *http.Request, rawAuthDict json.RawMessage, userID string) *jsonerror.MatrixError {
+	var dict struct {
+		Pass bool `json:"pass"`
+	}
+	if err := json.Unmarshal(rawAuthDict, &dict); err != nil || !dict.Pass {
+		return jsonerror.Forbidden("did not pass")
+	}
+	return nil
+}
+
+func mustChallenge(t *testing.T, u *UserInteractive, authDict, userID string) Response {
+	var raw json.RawMessage
+	if authDict != "" {
+		raw = json.RawMessage(authDict)
+	}
+	res := u.Verify(&http.Request{}, raw, userID)
+	if res == nil {
+		t.Fatalf("Verify(%s): want 401, got success", authDict)
+	}
+	if res.Code != 401 {
+		t.Fatalf("Verify(%s): want 401, got %d %v", authDict, res.Code, res.JSON)
+	}
+	return res.JSON.(Response)
+}
+
+func TestMultiStageFlow(t *testing.T) {
+	u := New(time.Minute, []Stage{DummyStage{}, failStage{}})
+
+	r := mustChallenge(t, u, "", "")
+	if len(r.Flows) != 1 || len(r.Flows[0].Stages) != 2 {
+		t.Fatalf("want 1 flow with 2 stages, got %v", r.Flows)
+	}
+	if r.Params["m.login.test"] == nil {
+		t.Errorf("want params for m.login.test, got %v", r.Params)
+	}
+	session := r.Session
+
+	r = mustChallenge(t, u, `{"type":"m.login.dummy","session":"`+session+`"}`, "")
+	if len(r.Completed) != 1 || r.Completed[0] != authtypes.LoginTypeDummy {
+		t.Errorf("want completed [m.login.dummy], got %v", r.Completed)
+	}
+
+	r = mustChallenge(t, u, `{"type":"m.login.test","session":"`+session+`"}`, "")
+	if r.MatrixError == nil || r.MatrixError.ErrCode != "M_FORBIDDEN" {
+		t.Errorf("want M_FORBIDDEN for failed stage, got %v", r.MatrixError)
+	}
+
+	if res := u.Verify(&http.Request{}, json.RawMessage(`{"type":"m.login.test","pass":true,"session":"`+session+`"}`), ""); res != nil {
+		t.Fatalf("want success once all stages are complete, got %d %v", res.Code, res.JSON)
+	}
+
+	// The session can't be reused once the flow is complete.
+	res := u.Verify(&http.Request{}, json.RawMessage(`{"type":"m.login.dummy","session":"`+session+`"}`), "")
+	if res == nil || res.Code != 400 {
+		t.Errorf("want 400 for completed session, got %v", res)
+	}
+}
+
+func TestSessionBelongsToUser(t *testing.T) {
+	u := New(time.Minute, []Stage{DummyStage{}})
+	session := mustChallenge(t, u, "", "@alice:localhost").Session
+
+	res := u.Verify(&http.Request{}, json.RawMessage(`{"type":"m.login.dummy","session":"`+session+`"}`), "@bob:localhost")
+	if res == nil || res.Code != 400 {
+		t.Errorf("want 400 for another user's session, got %v", res)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	u := New(time.Minute, []Stage{DummyStage{}})
+	u.now = func() time.Time { return now }
+	session := mustChallenge(t, u, "", "").Session
+
+	now = now.Add(2 * time.Minute)
+	res := u.Verify(&http.Request{}, json.RawMessage(`{"type":"m.login.dummy","session":"`+session+`"}`), "")
+	if res == nil || res.Code != 400 {
+		t.Errorf("want 400 for expired session, got %v", res)
+	}
+}
+
+func TestLeastRecentlyUsedSessionEvictedWhenFull(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	u := New(time.Minute, []Stage{DummyStage{}})
+	u.now = func() time.Time { return now }
+	u.maxSessions = 2
+
+	first := mustChallenge(t, u, "", "").Session
+	now = now.Add(time.Second)
+	second := mustChallenge(t, u, "", "").Session
+	now = now.Add(time.Second)
+	// Using the first session makes the second the least recently used.
+	mustChallenge(t, u, `{"session":"`+first+`"}`, "")
+	now = now.Add(time.Second)
+	mustChallenge(t, u, "", "")
+
+	if len(u.sessions) != 2 {
+		t.Errorf("want at most 2 sessions, got %d", len(u.sessions))
+	}
+	if u.sessions[first] == nil {
+		t.Error("want the recently used session to be kept, got nothing")
+	}
+	if u.sessions[second] != nil {
+		t.Error("want the least recently used session to be evicted, got it kept")
+	}
+}
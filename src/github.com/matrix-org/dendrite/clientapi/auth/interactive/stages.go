@@ -0,0 +1,113 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package interactive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/util"
+)
+
+// Stage is one stage of user-interactive auth. Implementations must be safe to use from
+// multiple goroutines.
+type Stage interface {
+	// Type returns the login type which clients use to submit this stage.
+	Type() authtypes.LoginType
+	// Params returns the parameters the client needs to complete this stage, or nil if there are none.
+	Params() interface{}
+	// Validate checks the "auth" dictionary submitted for this stage. userID is the user making the
+	// request, or "" if the request is not authenticated. Returns an error, which is sent to the
+	// client alongside the flows, if the stage was not completed.
+	Validate(req *http.Request, rawAuthDict json.RawMessage, userID string) *jsonerror.MatrixError
+}
+
+// DummyStage implements m.login.dummy, which always succeeds. It is used for flows which
+// don't need any extra authentication, e.g. registration on a server with no captcha.
+type DummyStage struct{}
+
+// Type implements Stage
+func (DummyStage) Type() authtypes.LoginType { return authtypes.LoginTypeDummy }
+
+// Params implements Stage
+func (DummyStage) Params() interface{} { return nil }
+
+// Validate implements Stage
+func (DummyStage) Validate(req *http.Request, rawAuthDict json.RawMessage, userID string) *jsonerror.MatrixError {
+	return nil
+}
+
+// PasswordDatabase represents a database of accounts which can be checked for a password.
+type PasswordDatabase interface {
+	// Returns the account with the given localpart and password, or nil if the password doesn't match.
+	// Returns an error if there was a problem talking to the database.
+	GetAccountByPassword(localpart, plaintextPassword string) (*authtypes.Account, error)
+}
+
+// PasswordStage implements m.login.password, which asks an authenticated user to confirm
+// their identity by supplying their password again.
+type PasswordStage struct {
+	AccountDB  PasswordDatabase
+	ServerName string
+}
+
+type passwordAuthDict struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// Type implements Stage
+func (s PasswordStage) Type() authtypes.LoginType { return authtypes.LoginTypePassword }
+
+// Params implements Stage
+func (s PasswordStage) Params() interface{} { return nil }
+
+// Validate implements Stage
+func (s PasswordStage) Validate(req *http.Request, rawAuthDict json.RawMessage, userID string) *jsonerror.MatrixError {
+	var dict passwordAuthDict
+	if err := json.Unmarshal(rawAuthDict, &dict); err != nil {
+		return jsonerror.BadJSON("The 'auth' dictionary could not be parsed: " + err.Error())
+	}
+	if dict.User == "" || dict.Password == "" {
+		return jsonerror.MissingParam("'user' and 'password' must be supplied.")
+	}
+	if userID == "" {
+		return jsonerror.Forbidden("m.login.password can only be used by a logged in user")
+	}
+
+	// The user may be given as a localpart or as a full user ID.
+	suppliedUserID := dict.User
+	if !strings.HasPrefix(suppliedUserID, "@") {
+		suppliedUserID = fmt.Sprintf("@%s:%s", dict.User, s.ServerName)
+	}
+	if suppliedUserID != userID {
+		return jsonerror.Forbidden("The supplied user does not match the logged in user")
+	}
+	localpart := strings.SplitN(userID[1:], ":", 2)[0]
+
+	acc, err := s.AccountDB.GetAccountByPassword(localpart, dict.Password)
+	if err != nil {
+		util.GetLogger(req.Context()).WithError(err).Error("Failed to check password")
+		return jsonerror.Unknown("Internal Server Error")
+	}
+	if acc == nil {
+		return jsonerror.Forbidden("Invalid password")
+	}
+	return nil
+}
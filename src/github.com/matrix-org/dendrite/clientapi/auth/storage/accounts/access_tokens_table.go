@@ -0,0 +1,110 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+)
+
+const accessTokensSchema = `
+-- Stores the access tokens which have been issued to client devices.
+CREATE TABLE IF NOT EXISTS access_tokens (
+    -- The access token. This is the opaque string clients send with each request.
+    token TEXT NOT NULL PRIMARY KEY,
+    -- The Matrix user ID this token was issued to e.g '@alice:localhost'
+    user_id TEXT NOT NULL,
+    -- The ID of the device this token was issued to.
+    device_id TEXT NOT NULL,
+    -- When this token was issued, as a unix timestamp (ms resolution).
+    created_ts BIGINT NOT NULL
+);
+-- for looking up all the tokens of a device or user
+CREATE INDEX IF NOT EXISTS access_tokens_user_device_idx ON access_tokens(user_id, device_id);
+`
+
+const insertAccessTokenSQL = "" +
+	"INSERT INTO access_tokens (token, user_id, device_id, created_ts) VALUES ($1, $2, $3, $4)"
+
+// The last seen time is included so that callers can avoid updating it on every request.
+const selectDeviceByTokenSQL = "" +
+	"SELECT a.user_id, a.device_id, COALESCE(d.last_seen_ts, 0), COALESCE(d.last_seen_ip, '')" +
+	" FROM access_tokens a LEFT JOIN devices d ON a.user_id = d.user_id AND a.device_id = d.device_id" +
+	" WHERE a.token = $1"
+
+const deleteAccessTokensByDeviceSQL = "" +
+	"DELETE FROM access_tokens WHERE user_id = $1 AND device_id = $2"
+
+const deleteAccessTokensByUserSQL = "" +
+	"DELETE FROM access_tokens WHERE user_id = $1"
+
+type accessTokensStatements struct {
+	insertAccessTokenStmt          *sql.Stmt
+	selectDeviceByTokenStmt        *sql.Stmt
+	deleteAccessTokensByDeviceStmt *sql.Stmt
+	deleteAccessTokensByUserStmt   *sql.Stmt
+}
+
+func (s *accessTokensStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(accessTokensSchema)
+	if err != nil {
+		return
+	}
+	if s.insertAccessTokenStmt, err = db.Prepare(insertAccessTokenSQL); err != nil {
+		return
+	}
+	if s.selectDeviceByTokenStmt, err = db.Prepare(selectDeviceByTokenSQL); err != nil {
+		return
+	}
+	if s.deleteAccessTokensByDeviceStmt, err = db.Prepare(deleteAccessTokensByDeviceSQL); err != nil {
+		return
+	}
+	if s.deleteAccessTokensByUserStmt, err = db.Prepare(deleteAccessTokensByUserSQL); err != nil {
+		return
+	}
+	return
+}
+
+// insertAccessToken stores a new access token for the given user and device.
+func (s *accessTokensStatements) insertAccessToken(txn *sql.Tx, token, userID, deviceID string, createdTS int64) error {
+	_, err := txn.Stmt(s.insertAccessTokenStmt).Exec(token, userID, deviceID, createdTS)
+	return err
+}
+
+// deleteAccessTokensByDevice revokes all the access tokens issued to the given device.
+func (s *accessTokensStatements) deleteAccessTokensByDevice(txn *sql.Tx, userID, deviceID string) error {
+	_, err := txn.Stmt(s.deleteAccessTokensByDeviceStmt).Exec(userID, deviceID)
+	return err
+}
+
+// selectDeviceByToken returns the device which the given access token was issued to.
+// Returns sql.ErrNoRows if the token is unknown.
+func (s *accessTokensStatements) selectDeviceByToken(token string) (*authtypes.Device, error) {
+	dev := authtypes.Device{
+		AccessToken: token,
+	}
+	err := s.selectDeviceByTokenStmt.QueryRow(token).Scan(&dev.UserID, &dev.ID, &dev.LastSeenTS, &dev.LastSeenIP)
+	if err != nil {
+		return nil, err
+	}
+	return &dev, nil
+}
+
+// deleteAccessTokensByUser revokes all the access tokens issued to the given user.
+func (s *accessTokensStatements) deleteAccessTokensByUser(txn *sql.Tx, userID string) error {
+	_, err := txn.Stmt(s.deleteAccessTokensByUserStmt).Exec(userID)
+	return err
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+const accountDataSchema = `
+-- Stores the account data of users, which clients use to store their settings on the server.
+CREATE TABLE IF NOT EXISTS account_data (
+    -- The Matrix user ID of the owner of the data e.g '@alice:localhost'
+    user_id TEXT NOT NULL,
+    -- The room the data is for, or an empty string for global account data.
+    room_id TEXT NOT NULL,
+    -- The type of the data e.g 'm.direct'
+    type TEXT NOT NULL,
+    -- The JSON content of the data. Stored as TEXT because this should be valid UTF-8.
+    content TEXT NOT NULL,
+    PRIMARY KEY(user_id, room_id, type)
+);
+`
+
+const upsertAccountDataSQL = "" +
+	"INSERT INTO account_data (user_id, room_id, type, content) VALUES ($1, $2, $3, $4)" +
+	" ON CONFLICT (user_id, room_id, type) DO UPDATE SET content = $4"
+
+const selectAccountDataSQL = "" +
+	"SELECT room_id, type, content FROM account_data WHERE user_id = $1"
+
+const selectAccountDataByTypeSQL = "" +
+	"SELECT content FROM account_data WHERE user_id = $1 AND room_id = $2 AND type = $3"
+
+type accountDataStatements struct {
+	upsertAccountDataStmt       *sql.Stmt
+	selectAccountDataStmt       *sql.Stmt
+	selectAccountDataByTypeStmt *sql.Stmt
+}
+
+func (s *accountDataStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(accountDataSchema)
+	if err != nil {
+		return
+	}
+	if s.upsertAccountDataStmt, err = db.Prepare(upsertAccountDataSQL); err != nil {
+		return
+	}
+	if s.selectAccountDataStmt, err = db.Prepare(selectAccountDataSQL); err != nil {
+		return
+	}
+	if s.selectAccountDataByTypeStmt, err = db.Prepare(selectAccountDataByTypeSQL); err != nil {
+		return
+	}
+	return
+}
+
+func (s *accountDataStatements) upsertAccountData(userID, roomID, dataType, content string) error {
+	_, err := s.upsertAccountDataStmt.Exec(userID, roomID, dataType, content)
+	return err
+}
+
+// selectAccountData returns the global account data of the user, and a map from room IDs to the
+// user's account data for that room.
+func (s *accountDataStatements) selectAccountData(userID string) (
+	global []gomatrixserverlib.ClientEvent, rooms map[string][]gomatrixserverlib.ClientEvent, err error,
+) {
+	rows, err := s.selectAccountDataStmt.Query(userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	global = []gomatrixserverlib.ClientEvent{}
+	rooms = make(map[string][]gomatrixserverlib.ClientEvent)
+	for rows.Next() {
+		var roomID, dataType, content string
+		if err = rows.Scan(&roomID, &dataType, &content); err != nil {
+			return
+		}
+		ev := gomatrixserverlib.ClientEvent{
+			Type:    dataType,
+			Content: []byte(content),
+		}
+		if roomID == "" {
+			global = append(global, ev)
+		} else {
+			rooms[roomID] = append(rooms[roomID], ev)
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *accountDataStatements) selectAccountDataByType(userID, roomID, dataType string) (*gomatrixserverlib.ClientEvent, error) {
+	var content string
+	if err := s.selectAccountDataByTypeStmt.QueryRow(userID, roomID, dataType).Scan(&content); err != nil {
+		return nil, err
+	}
+	return &gomatrixserverlib.ClientEvent{
+		Type:    dataType,
+		Content: []byte(content),
+	}, nil
+}
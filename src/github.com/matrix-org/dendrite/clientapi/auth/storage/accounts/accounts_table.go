@@ -0,0 +1,106 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+)
+
+const accountsSchema = `
+-- Stores data about accounts.
+CREATE TABLE IF NOT EXISTS accounts (
+    -- The Matrix user ID localpart for this account
+    localpart TEXT NOT NULL PRIMARY KEY,
+    -- When this account was first created, as a unix timestamp (ms resolution).
+    created_ts BIGINT NOT NULL,
+    -- The bcrypt hash of the password for this account. Can be NULL if the account has no password.
+    password_hash TEXT
+);
+`
+
+const insertAccountSQL = "" +
+	"INSERT INTO accounts (localpart, created_ts, password_hash) VALUES ($1, $2, $3)" +
+	" ON CONFLICT DO NOTHING RETURNING created_ts"
+
+const selectPasswordHashSQL = "" +
+	"SELECT password_hash, created_ts FROM accounts WHERE localpart = $1"
+
+const selectAccountByLocalpartSQL = "" +
+	"SELECT created_ts FROM accounts WHERE localpart = $1"
+
+type accountsStatements struct {
+	insertAccountStmt            *sql.Stmt
+	selectPasswordHashStmt       *sql.Stmt
+	selectAccountByLocalpartStmt *sql.Stmt
+}
+
+func (s *accountsStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(accountsSchema)
+	if err != nil {
+		return
+	}
+	if s.insertAccountStmt, err = db.Prepare(insertAccountSQL); err != nil {
+		return
+	}
+	if s.selectPasswordHashStmt, err = db.Prepare(selectPasswordHashSQL); err != nil {
+		return
+	}
+	if s.selectAccountByLocalpartStmt, err = db.Prepare(selectAccountByLocalpartSQL); err != nil {
+		return
+	}
+	return
+}
+
+// insertAccount creates a new account. 'hash' should be the password hash for this account. If it is missing,
+// this account will be passwordless. Returns sql.ErrNoRows if the localpart is already taken.
+func (s *accountsStatements) insertAccount(localpart string, hash *string, createdTS int64) (*authtypes.Account, error) {
+	acc := authtypes.Account{
+		Localpart: localpart,
+	}
+	if err := s.insertAccountStmt.QueryRow(localpart, createdTS, hash).Scan(&acc.CreatedTS); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// selectPasswordHash returns the account with the given localpart along with its password hash.
+// The hash is nil if the account has no password. Returns sql.ErrNoRows if there is no such account.
+func (s *accountsStatements) selectPasswordHash(localpart string) (*authtypes.Account, *string, error) {
+	acc := authtypes.Account{
+		Localpart: localpart,
+	}
+	var hash sql.NullString
+	if err := s.selectPasswordHashStmt.QueryRow(localpart).Scan(&hash, &acc.CreatedTS); err != nil {
+		return nil, nil, err
+	}
+	if !hash.Valid {
+		return &acc, nil, nil
+	}
+	return &acc, &hash.String, nil
+}
+
+// selectAccountByLocalpart returns the account with the given localpart.
+// Returns sql.ErrNoRows if there is no such account.
+func (s *accountsStatements) selectAccountByLocalpart(localpart string) (*authtypes.Account, error) {
+	acc := authtypes.Account{
+		Localpart: localpart,
+	}
+	if err := s.selectAccountByLocalpartStmt.QueryRow(localpart).Scan(&acc.CreatedTS); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+)
+
+const devicesSchema = `
+-- Stores data about devices.
+CREATE TABLE IF NOT EXISTS devices (
+    -- The Matrix user ID of the owner of this device e.g '@alice:localhost'
+    user_id TEXT NOT NULL,
+    -- The device ID, which is unique per user.
+    device_id TEXT NOT NULL,
+    -- The display name of the device, as chosen by the user. Can be NULL.
+    display_name TEXT,
+    -- When this device was first created, as a unix timestamp (ms resolution).
+    created_ts BIGINT NOT NULL,
+    -- When this device was last used, as a unix timestamp (ms resolution).
+    last_seen_ts BIGINT NOT NULL,
+    -- The IP address this device was last used from.
+    last_seen_ip TEXT NOT NULL,
+    PRIMARY KEY(user_id, device_id)
+);
+`
+
+// Logging in again with an existing device ID keeps the device's display name.
+const insertDeviceSQL = "" +
+	"INSERT INTO devices (user_id, device_id, display_name, created_ts, last_seen_ts, last_seen_ip)" +
+	" VALUES ($1, $2, $3, $4, $4, $5)" +
+	" ON CONFLICT (user_id, device_id) DO UPDATE SET last_seen_ts = $4, last_seen_ip = $5"
+
+const selectDevicesByUserSQL = "" +
+	"SELECT device_id, display_name, last_seen_ts, last_seen_ip FROM devices WHERE user_id = $1 ORDER BY device_id ASC"
+
+const selectDeviceSQL = "" +
+	"SELECT display_name, last_seen_ts, last_seen_ip FROM devices WHERE user_id = $1 AND device_id = $2"
+
+const updateDeviceNameSQL = "" +
+	"UPDATE devices SET display_name = $3 WHERE user_id = $1 AND device_id = $2"
+
+const updateDeviceLastSeenSQL = "" +
+	"UPDATE devices SET last_seen_ts = $3, last_seen_ip = $4 WHERE user_id = $1 AND device_id = $2"
+
+const deleteDeviceSQL = "" +
+	"DELETE FROM devices WHERE user_id = $1 AND device_id = $2"
+
+const deleteDevicesByUserSQL = "" +
+	"DELETE FROM devices WHERE user_id = $1 RETURNING device_id"
+
+type devicesStatements struct {
+	insertDeviceStmt         *sql.Stmt
+	selectDevicesByUserStmt  *sql.Stmt
+	selectDeviceStmt         *sql.Stmt
+	updateDeviceNameStmt     *sql.Stmt
+	updateDeviceLastSeenStmt *sql.Stmt
+	deleteDeviceStmt         *sql.Stmt
+	deleteDevicesByUserStmt  *sql.Stmt
+}
+
+func (s *devicesStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(devicesSchema)
+	if err != nil {
+		return
+	}
+	if s.insertDeviceStmt, err = db.Prepare(insertDeviceSQL); err != nil {
+		return
+	}
+	if s.selectDevicesByUserStmt, err = db.Prepare(selectDevicesByUserSQL); err != nil {
+		return
+	}
+	if s.selectDeviceStmt, err = db.Prepare(selectDeviceSQL); err != nil {
+		return
+	}
+	if s.updateDeviceNameStmt, err = db.Prepare(updateDeviceNameSQL); err != nil {
+		return
+	}
+	if s.updateDeviceLastSeenStmt, err = db.Prepare(updateDeviceLastSeenSQL); err != nil {
+		return
+	}
+	if s.deleteDeviceStmt, err = db.Prepare(deleteDeviceSQL); err != nil {
+		return
+	}
+	if s.deleteDevicesByUserStmt, err = db.Prepare(deleteDevicesByUserSQL); err != nil {
+		return
+	}
+	return
+}
+
+// insertDevice creates a device, or marks an existing device as seen if it already exists.
+func (s *devicesStatements) insertDevice(txn *sql.Tx, userID, deviceID string, displayName *string, createdTS int64, ip string) error {
+	_, err := txn.Stmt(s.insertDeviceStmt).Exec(userID, deviceID, displayName, createdTS, ip)
+	return err
+}
+
+// selectDevicesByUser returns all the devices owned by the given user.
+func (s *devicesStatements) selectDevicesByUser(userID string) ([]authtypes.Device, error) {
+	rows, err := s.selectDevicesByUserStmt.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []authtypes.Device
+	for rows.Next() {
+		dev := authtypes.Device{UserID: userID}
+		var displayName sql.NullString
+		if err = rows.Scan(&dev.ID, &displayName, &dev.LastSeenTS, &dev.LastSeenIP); err != nil {
+			return nil, err
+		}
+		dev.DisplayName = displayName.String
+		devices = append(devices, dev)
+	}
+	return devices, rows.Err()
+}
+
+// selectDevice returns the device with the given ID owned by the given user.
+// Returns sql.ErrNoRows if there is no such device.
+func (s *devicesStatements) selectDevice(userID, deviceID string) (*authtypes.Device, error) {
+	dev := authtypes.Device{ID: deviceID, UserID: userID}
+	var displayName sql.NullString
+	err := s.selectDeviceStmt.QueryRow(userID, deviceID).Scan(&displayName, &dev.LastSeenTS, &dev.LastSeenIP)
+	if err != nil {
+		return nil, err
+	}
+	dev.DisplayName = displayName.String
+	return &dev, nil
+}
+
+// updateDeviceName sets the display name of a device. Returns the number of devices updated.
+func (s *devicesStatements) updateDeviceName(userID, deviceID string, displayName *string) (int64, error) {
+	res, err := s.updateDeviceNameStmt.Exec(userID, deviceID, displayName)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// updateDeviceLastSeen records when and where a device was last used.
+func (s *devicesStatements) updateDeviceLastSeen(userID, deviceID string, lastSeenTS int64, ip string) error {
+	_, err := s.updateDeviceLastSeenStmt.Exec(userID, deviceID, lastSeenTS, ip)
+	return err
+}
+
+// deleteDevice removes a device. It does not revoke the device's access tokens.
+func (s *devicesStatements) deleteDevice(txn *sql.Tx, userID, deviceID string) error {
+	_, err := txn.Stmt(s.deleteDeviceStmt).Exec(userID, deviceID)
+	return err
+}
+
+// deleteDevicesByUser removes all the devices owned by the given user and returns their IDs.
+// It does not revoke the devices' access tokens.
+func (s *devicesStatements) deleteDevicesByUser(txn *sql.Tx, userID string) ([]string, error) {
+	rows, err := txn.Stmt(s.deleteDevicesByUserStmt).Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deviceIDs []string
+	for rows.Next() {
+		var deviceID string
+		if err = rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	return deviceIDs, rows.Err()
+}
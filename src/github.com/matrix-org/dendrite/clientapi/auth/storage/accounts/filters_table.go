@@ -0,0 +1,66 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+)
+
+const filtersSchema = `
+-- Stores the filters which users have uploaded for their /sync requests.
+CREATE TABLE IF NOT EXISTS filters (
+    -- The ID of the filter, which is given to the user.
+    id BIGSERIAL PRIMARY KEY,
+    -- The Matrix user ID of the user who uploaded the filter e.g '@alice:localhost'
+    user_id TEXT NOT NULL,
+    -- The JSON for the filter as uploaded. Stored as TEXT because this should be valid UTF-8.
+    filter TEXT NOT NULL
+);
+`
+
+const insertFilterSQL = "" +
+	"INSERT INTO filters (user_id, filter) VALUES ($1, $2) RETURNING id"
+
+const selectFilterSQL = "" +
+	"SELECT filter FROM filters WHERE user_id = $1 AND id = $2"
+
+type filtersStatements struct {
+	insertFilterStmt *sql.Stmt
+	selectFilterStmt *sql.Stmt
+}
+
+func (s *filtersStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(filtersSchema)
+	if err != nil {
+		return
+	}
+	if s.insertFilterStmt, err = db.Prepare(insertFilterSQL); err != nil {
+		return
+	}
+	if s.selectFilterStmt, err = db.Prepare(selectFilterSQL); err != nil {
+		return
+	}
+	return
+}
+
+func (s *filtersStatements) insertFilter(userID, filter string) (filterID int64, err error) {
+	err = s.insertFilterStmt.QueryRow(userID, filter).Scan(&filterID)
+	return
+}
+
+func (s *filtersStatements) selectFilter(userID string, filterID int64) (filter string, err error) {
+	err = s.selectFilterStmt.QueryRow(userID, filterID).Scan(&filter)
+	return
+}
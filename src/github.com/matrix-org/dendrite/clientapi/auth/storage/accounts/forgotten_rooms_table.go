@@ -0,0 +1,86 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+)
+
+const forgottenRoomsSchema = `
+-- Stores the rooms which users have forgotten.
+CREATE TABLE IF NOT EXISTS forgotten_rooms (
+    -- The Matrix user ID of the user who forgot the room e.g '@alice:localhost'
+    user_id TEXT NOT NULL,
+    -- The room which was forgotten.
+    room_id TEXT NOT NULL,
+    -- The ID of the user's membership event at the time the room was forgotten. The room
+    -- is only forgotten while this is still the user's membership in the room, so that
+    -- rejoining and leaving again makes it visible once more.
+    event_id TEXT NOT NULL,
+    PRIMARY KEY(user_id, room_id)
+);
+`
+
+const upsertForgottenRoomSQL = "" +
+	"INSERT INTO forgotten_rooms (user_id, room_id, event_id) VALUES ($1, $2, $3)" +
+	" ON CONFLICT (user_id, room_id) DO UPDATE SET event_id = $3"
+
+const selectForgottenRoomsSQL = "" +
+	"SELECT room_id, event_id FROM forgotten_rooms WHERE user_id = $1"
+
+type forgottenRoomsStatements struct {
+	upsertForgottenRoomStmt  *sql.Stmt
+	selectForgottenRoomsStmt *sql.Stmt
+}
+
+func (s *forgottenRoomsStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(forgottenRoomsSchema)
+	if err != nil {
+		return
+	}
+	if s.upsertForgottenRoomStmt, err = db.Prepare(upsertForgottenRoomSQL); err != nil {
+		return
+	}
+	if s.selectForgottenRoomsStmt, err = db.Prepare(selectForgottenRoomsSQL); err != nil {
+		return
+	}
+	return
+}
+
+// upsertForgottenRoom records that the user forgot the room while their membership was the given event.
+func (s *forgottenRoomsStatements) upsertForgottenRoom(userID, roomID, eventID string) error {
+	_, err := s.upsertForgottenRoomStmt.Exec(userID, roomID, eventID)
+	return err
+}
+
+// selectForgottenRooms returns a map from the IDs of the rooms the user has forgotten to the
+// IDs of the membership events they were forgotten at.
+func (s *forgottenRoomsStatements) selectForgottenRooms(userID string) (map[string]string, error) {
+	rows, err := s.selectForgottenRoomsStmt.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	forgotten := make(map[string]string)
+	for rows.Next() {
+		var roomID, eventID string
+		if err = rows.Scan(&roomID, &eventID); err != nil {
+			return nil, err
+		}
+		forgotten[roomID] = eventID
+	}
+	return forgotten, rows.Err()
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+)
+
+const membershipsSchema = `
+-- Stores the rooms which the accounts on this server are joined to. This is kept up to date
+-- from the room server's output log.
+CREATE TABLE IF NOT EXISTS memberships (
+    -- The Matrix user ID localpart of the member
+    localpart TEXT NOT NULL,
+    -- The room the account is joined to
+    room_id TEXT NOT NULL,
+    -- The ID of the join event
+    event_id TEXT NOT NULL,
+    PRIMARY KEY(localpart, room_id)
+);
+`
+
+const upsertMembershipSQL = "" +
+	"INSERT INTO memberships (localpart, room_id, event_id) VALUES ($1, $2, $3)" +
+	" ON CONFLICT (localpart, room_id) DO UPDATE SET event_id = $3"
+
+const deleteMembershipSQL = "" +
+	"DELETE FROM memberships WHERE localpart = $1 AND room_id = $2"
+
+const selectRoomIDsByLocalpartSQL = "" +
+	"SELECT room_id FROM memberships WHERE localpart = $1"
+
+type membershipsStatements struct {
+	upsertMembershipStmt         *sql.Stmt
+	deleteMembershipStmt         *sql.Stmt
+	selectRoomIDsByLocalpartStmt *sql.Stmt
+}
+
+func (s *membershipsStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(membershipsSchema)
+	if err != nil {
+		return
+	}
+	if s.upsertMembershipStmt, err = db.Prepare(upsertMembershipSQL); err != nil {
+		return
+	}
+	if s.deleteMembershipStmt, err = db.Prepare(deleteMembershipSQL); err != nil {
+		return
+	}
+	if s.selectRoomIDsByLocalpartStmt, err = db.Prepare(selectRoomIDsByLocalpartSQL); err != nil {
+		return
+	}
+	return
+}
+
+func (s *membershipsStatements) upsertMembership(localpart, roomID, eventID string) error {
+	_, err := s.upsertMembershipStmt.Exec(localpart, roomID, eventID)
+	return err
+}
+
+func (s *membershipsStatements) deleteMembership(localpart, roomID string) error {
+	_, err := s.deleteMembershipStmt.Exec(localpart, roomID)
+	return err
+}
+
+// selectRoomIDsByLocalpart returns the IDs of the rooms the account is joined to.
+func (s *membershipsStatements) selectRoomIDsByLocalpart(localpart string) ([]string, error) {
+	rows, err := s.selectRoomIDsByLocalpartStmt.Query(localpart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roomIDs []string
+	for rows.Next() {
+		var roomID string
+		if err = rows.Scan(&roomID); err != nil {
+			return nil, err
+		}
+		roomIDs = append(roomIDs, roomID)
+	}
+	return roomIDs, rows.Err()
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+)
+
+const profilesSchema = `
+-- Stores data about the profiles of accounts.
+CREATE TABLE IF NOT EXISTS profiles (
+    -- The Matrix user ID localpart for this account
+    localpart TEXT NOT NULL PRIMARY KEY,
+    -- The display name for this account
+    display_name TEXT NOT NULL DEFAULT '',
+    -- The URL of the avatar for this account
+    avatar_url TEXT NOT NULL DEFAULT ''
+);
+`
+
+const selectProfileByLocalpartSQL = "" +
+	"SELECT display_name, avatar_url FROM profiles WHERE localpart = $1"
+
+const upsertDisplayNameSQL = "" +
+	"INSERT INTO profiles (localpart, display_name) VALUES ($1, $2)" +
+	" ON CONFLICT (localpart) DO UPDATE SET display_name = $2"
+
+const upsertAvatarURLSQL = "" +
+	"INSERT INTO profiles (localpart, avatar_url) VALUES ($1, $2)" +
+	" ON CONFLICT (localpart) DO UPDATE SET avatar_url = $2"
+
+type profilesStatements struct {
+	selectProfileByLocalpartStmt *sql.Stmt
+	upsertDisplayNameStmt        *sql.Stmt
+	upsertAvatarURLStmt          *sql.Stmt
+}
+
+func (s *profilesStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(profilesSchema)
+	if err != nil {
+		return
+	}
+	if s.selectProfileByLocalpartStmt, err = db.Prepare(selectProfileByLocalpartSQL); err != nil {
+		return
+	}
+	if s.upsertDisplayNameStmt, err = db.Prepare(upsertDisplayNameSQL); err != nil {
+		return
+	}
+	if s.upsertAvatarURLStmt, err = db.Prepare(upsertAvatarURLSQL); err != nil {
+		return
+	}
+	return
+}
+
+// selectProfileByLocalpart returns the profile of the account with the given localpart.
+// Returns sql.ErrNoRows if the account has never set a profile.
+func (s *profilesStatements) selectProfileByLocalpart(localpart string) (*authtypes.Profile, error) {
+	profile := authtypes.Profile{Localpart: localpart}
+	err := s.selectProfileByLocalpartStmt.QueryRow(localpart).Scan(&profile.DisplayName, &profile.AvatarURL)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (s *profilesStatements) upsertDisplayName(localpart, displayName string) error {
+	_, err := s.upsertDisplayNameStmt.Exec(localpart, displayName)
+	return err
+}
+
+func (s *profilesStatements) upsertAvatarURL(localpart, avatarURL string) error {
+	_, err := s.upsertAvatarURLStmt.Exec(localpart, avatarURL)
+	return err
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+const roomTagsSchema = `
+-- Stores the tags which users have given to rooms, e.g. to mark them as favourites.
+CREATE TABLE IF NOT EXISTS room_tags (
+    -- The Matrix user ID of the user who tagged the room e.g '@alice:localhost'
+    user_id TEXT NOT NULL,
+    -- The room which was tagged.
+    room_id TEXT NOT NULL,
+    -- The name of the tag e.g 'm.favourite'
+    tag TEXT NOT NULL,
+    -- The JSON content of the tag e.g '{"order":0.5}'
+    content TEXT NOT NULL,
+    PRIMARY KEY(user_id, room_id, tag)
+);
+`
+
+const upsertRoomTagSQL = "" +
+	"INSERT INTO room_tags (user_id, room_id, tag, content) VALUES ($1, $2, $3, $4)" +
+	" ON CONFLICT (user_id, room_id, tag) DO UPDATE SET content = $4"
+
+const deleteRoomTagSQL = "" +
+	"DELETE FROM room_tags WHERE user_id = $1 AND room_id = $2 AND tag = $3"
+
+const selectRoomTagsSQL = "" +
+	"SELECT tag, content FROM room_tags WHERE user_id = $1 AND room_id = $2"
+
+const selectAllRoomTagsSQL = "" +
+	"SELECT room_id, tag, content FROM room_tags WHERE user_id = $1"
+
+type roomTagsStatements struct {
+	upsertRoomTagStmt     *sql.Stmt
+	deleteRoomTagStmt     *sql.Stmt
+	selectRoomTagsStmt    *sql.Stmt
+	selectAllRoomTagsStmt *sql.Stmt
+}
+
+func (s *roomTagsStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(roomTagsSchema)
+	if err != nil {
+		return
+	}
+	if s.upsertRoomTagStmt, err = db.Prepare(upsertRoomTagSQL); err != nil {
+		return
+	}
+	if s.deleteRoomTagStmt, err = db.Prepare(deleteRoomTagSQL); err != nil {
+		return
+	}
+	if s.selectRoomTagsStmt, err = db.Prepare(selectRoomTagsSQL); err != nil {
+		return
+	}
+	if s.selectAllRoomTagsStmt, err = db.Prepare(selectAllRoomTagsSQL); err != nil {
+		return
+	}
+	return
+}
+
+func (s *roomTagsStatements) upsertRoomTag(userID, roomID, tag, content string) error {
+	_, err := s.upsertRoomTagStmt.Exec(userID, roomID, tag, content)
+	return err
+}
+
+func (s *roomTagsStatements) deleteRoomTag(userID, roomID, tag string) error {
+	_, err := s.deleteRoomTagStmt.Exec(userID, roomID, tag)
+	return err
+}
+
+// selectRoomTags returns a map from the user's tags for the room to their content.
+func (s *roomTagsStatements) selectRoomTags(userID, roomID string) (map[string]json.RawMessage, error) {
+	rows, err := s.selectRoomTagsStmt.Query(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var tag, content string
+		if err = rows.Scan(&tag, &content); err != nil {
+			return nil, err
+		}
+		tags[tag] = json.RawMessage(content)
+	}
+	return tags, rows.Err()
+}
+
+// selectAllRoomTags returns a map from the IDs of the rooms the user has tagged to the user's
+// tags for the room and their content.
+func (s *roomTagsStatements) selectAllRoomTags(userID string) (map[string]map[string]json.RawMessage, error) {
+	rows, err := s.selectAllRoomTagsStmt.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := make(map[string]map[string]json.RawMessage)
+	for rows.Next() {
+		var roomID, tag, content string
+		if err = rows.Scan(&roomID, &tag, &content); err != nil {
+			return nil, err
+		}
+		if rooms[roomID] == nil {
+			rooms[roomID] = make(map[string]json.RawMessage)
+		}
+		rooms[roomID][tag] = json.RawMessage(content)
+	}
+	return rooms, rows.Err()
+}
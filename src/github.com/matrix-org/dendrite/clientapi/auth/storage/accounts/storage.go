@@ -0,0 +1,437 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	// Import the postgres database driver.
+	_ "github.com/lib/pq"
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/gomatrixserverlib"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Database represents an account database
+type Database struct {
+	db           *sql.DB
+	accounts     accountsStatements
+	accessTokens accessTokensStatements
+	devices      devicesStatements
+	forgotten    forgottenRoomsStatements
+	profiles     profilesStatements
+	memberships  membershipsStatements
+	partitions   common.PartitionOffsetStatements
+	accountData  accountDataStatements
+	roomTags     roomTagsStatements
+	filters      filtersStatements
+}
+
+// NewDatabase creates a new accounts database
+func NewDatabase(dataSourceName string) (*Database, error) {
+	var db *sql.DB
+	var err error
+	if db, err = sql.Open("postgres", dataSourceName); err != nil {
+		return nil, err
+	}
+	accounts := accountsStatements{}
+	if err = accounts.prepare(db); err != nil {
+		return nil, err
+	}
+	tokens := accessTokensStatements{}
+	if err = tokens.prepare(db); err != nil {
+		return nil, err
+	}
+	devices := devicesStatements{}
+	if err = devices.prepare(db); err != nil {
+		return nil, err
+	}
+	forgotten := forgottenRoomsStatements{}
+	if err = forgotten.prepare(db); err != nil {
+		return nil, err
+	}
+	profiles := profilesStatements{}
+	if err = profiles.prepare(db); err != nil {
+		return nil, err
+	}
+	memberships := membershipsStatements{}
+	if err = memberships.prepare(db); err != nil {
+		return nil, err
+	}
+	partitions := common.PartitionOffsetStatements{}
+	if err = partitions.Prepare(db); err != nil {
+		return nil, err
+	}
+	accountData := accountDataStatements{}
+	if err = accountData.prepare(db); err != nil {
+		return nil, err
+	}
+	roomTags := roomTagsStatements{}
+	if err = roomTags.prepare(db); err != nil {
+		return nil, err
+	}
+	filters := filtersStatements{}
+	if err = filters.prepare(db); err != nil {
+		return nil, err
+	}
+	return &Database{
+		db, accounts, tokens, devices, forgotten, profiles, memberships, partitions, accountData, roomTags, filters,
+	}, nil
+}
+
+// CreateAccount makes a new account with the given login name and password. If no password is supplied,
+// the account will be a passwordless account. Returns nil if the localpart is already taken.
+// Returns an error if there was a problem hashing the password or talking to the database.
+func (d *Database) CreateAccount(localpart, plaintextPassword string) (*authtypes.Account, error) {
+	var hash *string
+	if plaintextPassword != "" {
+		hashBytes, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		h := string(hashBytes)
+		hash = &h
+	}
+	acc, err := d.accounts.insertAccount(localpart, hash, nowMillis())
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return acc, err
+}
+
+// GetAccountByPassword returns the account associated with the given localpart and password.
+// Returns nil if the account doesn't exist, has no password or if the password doesn't match.
+// Returns an error if there was a problem talking to the database.
+func (d *Database) GetAccountByPassword(localpart, plaintextPassword string) (*authtypes.Account, error) {
+	acc, hash, err := d.accounts.selectPasswordHash(localpart)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return nil, nil
+	}
+	if err = bcrypt.CompareHashAndPassword([]byte(*hash), []byte(plaintextPassword)); err != nil {
+		return nil, nil
+	}
+	return acc, nil
+}
+
+// GetAccountByLocalpart returns the account with the given localpart.
+// Returns nil if there is no such account.
+// Returns an error if there was a problem talking to the database.
+func (d *Database) GetAccountByLocalpart(localpart string) (*authtypes.Account, error) {
+	acc, err := d.accounts.selectAccountByLocalpart(localpart)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return acc, err
+}
+
+// GetDeviceByAccessToken returns the device which the given access token was issued to.
+// Returns nil if the access token is unknown.
+// Returns an error if there was a problem talking to the database.
+func (d *Database) GetDeviceByAccessToken(token string) (*authtypes.Device, error) {
+	dev, err := d.accessTokens.selectDeviceByToken(token)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return dev, err
+}
+
+// CreateDevice stores an access token for the given device, creating the device if it doesn't
+// already exist. The token must be unique across all users and devices. displayName is only used
+// for new devices and can be nil. ip is the address the device logged in from.
+func (d *Database) CreateDevice(userID, deviceID string, displayName *string, accessToken, ip string) error {
+	return runTransaction(d.db, func(txn *sql.Tx) error {
+		now := nowMillis()
+		if err := d.devices.insertDevice(txn, userID, deviceID, displayName, now, ip); err != nil {
+			return err
+		}
+		return d.accessTokens.insertAccessToken(txn, accessToken, userID, deviceID, now)
+	})
+}
+
+// GetDevicesByUserID returns all the devices owned by the given user.
+func (d *Database) GetDevicesByUserID(userID string) ([]authtypes.Device, error) {
+	return d.devices.selectDevicesByUser(userID)
+}
+
+// GetDevice returns the device with the given ID owned by the given user.
+// Returns nil if there is no such device.
+// Returns an error if there was a problem talking to the database.
+func (d *Database) GetDevice(userID, deviceID string) (*authtypes.Device, error) {
+	dev, err := d.devices.selectDevice(userID, deviceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return dev, err
+}
+
+// UpdateDeviceDisplayName sets the display name of a device, or clears it if displayName is nil.
+// Returns false if there is no such device.
+func (d *Database) UpdateDeviceDisplayName(userID, deviceID string, displayName *string) (bool, error) {
+	updated, err := d.devices.updateDeviceName(userID, deviceID, displayName)
+	return updated > 0, err
+}
+
+// UpdateDeviceLastSeen records that the device was used just now from the given IP address.
+func (d *Database) UpdateDeviceLastSeen(userID, deviceID, ip string) error {
+	return d.devices.updateDeviceLastSeen(userID, deviceID, nowMillis(), ip)
+}
+
+// RemoveDevices deletes the given devices owned by the user and revokes their access tokens.
+// Devices which don't exist are ignored.
+func (d *Database) RemoveDevices(userID string, deviceIDs []string) error {
+	return runTransaction(d.db, func(txn *sql.Tx) error {
+		for _, deviceID := range deviceIDs {
+			if err := d.accessTokens.deleteAccessTokensByDevice(txn, userID, deviceID); err != nil {
+				return err
+			}
+			if err := d.devices.deleteDevice(txn, userID, deviceID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveAllDevices deletes all the devices owned by the user and revokes all of the user's
+// access tokens. Returns the IDs of the devices which were deleted.
+func (d *Database) RemoveAllDevices(userID string) (deviceIDs []string, err error) {
+	err = runTransaction(d.db, func(txn *sql.Tx) (txnErr error) {
+		if txnErr = d.accessTokens.deleteAccessTokensByUser(txn, userID); txnErr != nil {
+			return
+		}
+		deviceIDs, txnErr = d.devices.deleteDevicesByUser(txn, userID)
+		return
+	})
+	return
+}
+
+// ForgetRoom records that the user has forgotten the room. membershipEventID is the user's
+// current membership event in the room, which must be a leave or a ban.
+func (d *Database) ForgetRoom(userID, roomID, membershipEventID string) error {
+	return d.forgotten.upsertForgottenRoom(userID, roomID, membershipEventID)
+}
+
+// ForgottenRooms maps the IDs of the rooms a user has forgotten to the membership events
+// they were forgotten at.
+type ForgottenRooms map[string]string
+
+// IsForgotten returns whether the user has forgotten the room since they last left it, given
+// the ID of their current membership event in the room, or "" if they have none. A room is
+// only still forgotten if that event is the one it was forgotten at, so rejoining the room
+// or being invited back un-forgets it.
+func (f ForgottenRooms) IsForgotten(roomID, membershipEventID string) bool {
+	forgottenAt, ok := f[roomID]
+	return ok && forgottenAt == membershipEventID
+}
+
+// GetForgottenRooms returns the rooms the user has forgotten. Use IsForgotten to check whether
+// a room is still forgotten.
+func (d *Database) GetForgottenRooms(userID string) (ForgottenRooms, error) {
+	forgotten, err := d.forgotten.selectForgottenRooms(userID)
+	return ForgottenRooms(forgotten), err
+}
+
+// IsRoomForgotten returns whether the user has forgotten the room since they last left it,
+// given the ID of their current membership event in the room. See ForgottenRooms.IsForgotten.
+func (d *Database) IsRoomForgotten(userID, roomID, membershipEventID string) (bool, error) {
+	forgotten, err := d.GetForgottenRooms(userID)
+	if err != nil {
+		return false, err
+	}
+	return forgotten.IsForgotten(roomID, membershipEventID), nil
+}
+
+// GetProfileByLocalpart returns the profile of the account with the given localpart.
+// Returns an empty profile if the account has never set one.
+func (d *Database) GetProfileByLocalpart(localpart string) (*authtypes.Profile, error) {
+	profile, err := d.profiles.selectProfileByLocalpart(localpart)
+	if err == sql.ErrNoRows {
+		return &authtypes.Profile{Localpart: localpart}, nil
+	}
+	return profile, err
+}
+
+// SetDisplayName updates the display name in the profile of the account with the given localpart.
+func (d *Database) SetDisplayName(localpart, displayName string) error {
+	return d.profiles.upsertDisplayName(localpart, displayName)
+}
+
+// SetAvatarURL updates the avatar URL in the profile of the account with the given localpart.
+func (d *Database) SetAvatarURL(localpart, avatarURL string) error {
+	return d.profiles.upsertAvatarURL(localpart, avatarURL)
+}
+
+// SaveMembership records that the account with the given localpart is joined to the room.
+// eventID is the ID of the join event.
+func (d *Database) SaveMembership(localpart, roomID, eventID string) error {
+	return d.memberships.upsertMembership(localpart, roomID, eventID)
+}
+
+// RemoveMembership records that the account with the given localpart is no longer joined to the room.
+func (d *Database) RemoveMembership(localpart, roomID string) error {
+	return d.memberships.deleteMembership(localpart, roomID)
+}
+
+// GetRoomIDsByLocalpart returns the IDs of the rooms the account with the given localpart is joined to.
+func (d *Database) GetRoomIDsByLocalpart(localpart string) ([]string, error) {
+	return d.memberships.selectRoomIDsByLocalpart(localpart)
+}
+
+// SaveAccountData stores the account data of the given type for the user. roomID is empty for
+// global account data. content is the JSON content of the data.
+func (d *Database) SaveAccountData(userID, roomID, dataType, content string) error {
+	return d.accountData.upsertAccountData(userID, roomID, dataType, content)
+}
+
+// GetAccountData returns all the account data of the user: the global account data, and a map
+// from room IDs to the account data for that room. The user's tags for each room they have tagged
+// are included as an m.tag event.
+func (d *Database) GetAccountData(userID string) (
+	global []gomatrixserverlib.ClientEvent, rooms map[string][]gomatrixserverlib.ClientEvent, err error,
+) {
+	if global, rooms, err = d.accountData.selectAccountData(userID); err != nil {
+		return
+	}
+	allTags, err := d.roomTags.selectAllRoomTags(userID)
+	if err != nil {
+		return
+	}
+	for roomID, tags := range allTags {
+		var ev *gomatrixserverlib.ClientEvent
+		if ev, err = tagEvent(tags); err != nil {
+			return
+		}
+		rooms[roomID] = append(rooms[roomID], *ev)
+	}
+	return
+}
+
+// GetAccountDataByType returns the account data of the given type for the user. roomID is empty
+// for global account data. Returns nil if the user has no account data of that type. The m.tag
+// type for a room is made from the user's tags for the room, and is returned even if there are
+// none so that clients see tags being removed.
+func (d *Database) GetAccountDataByType(userID, roomID, dataType string) (*gomatrixserverlib.ClientEvent, error) {
+	if dataType == "m.tag" && roomID != "" {
+		tags, err := d.roomTags.selectRoomTags(userID, roomID)
+		if err != nil {
+			return nil, err
+		}
+		return tagEvent(tags)
+	}
+	ev, err := d.accountData.selectAccountDataByType(userID, roomID, dataType)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ev, err
+}
+
+// SaveTag adds the tag to the room for the user, or replaces its content if the room already
+// has the tag. content is the JSON content of the tag.
+func (d *Database) SaveTag(userID, roomID, tag, content string) error {
+	return d.roomTags.upsertRoomTag(userID, roomID, tag, content)
+}
+
+// RemoveTag removes the tag from the room for the user. It is not an error if the room doesn't
+// have the tag.
+func (d *Database) RemoveTag(userID, roomID, tag string) error {
+	return d.roomTags.deleteRoomTag(userID, roomID, tag)
+}
+
+// GetTags returns a map from the user's tags for the room to their content.
+func (d *Database) GetTags(userID, roomID string) (map[string]json.RawMessage, error) {
+	return d.roomTags.selectRoomTags(userID, roomID)
+}
+
+// PutFilter stores the JSON of a filter uploaded by the user, and returns the ID of the filter.
+func (d *Database) PutFilter(userID, filter string) (string, error) {
+	filterID, err := d.filters.insertFilter(userID, filter)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(filterID, 10), nil
+}
+
+// GetFilter returns the JSON of the filter with the given ID which the user uploaded.
+// Returns an empty string if the user has no such filter.
+func (d *Database) GetFilter(userID, filterID string) (string, error) {
+	id, err := strconv.ParseInt(filterID, 10, 64)
+	if err != nil {
+		// The ID isn't one we would have given out.
+		return "", nil
+	}
+	filter, err := d.filters.selectFilter(userID, id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return filter, err
+}
+
+// tagEvent returns the m.tag account data event for the given tags.
+func tagEvent(tags map[string]json.RawMessage) (*gomatrixserverlib.ClientEvent, error) {
+	content, err := json.Marshal(struct {
+		Tags map[string]json.RawMessage `json:"tags"`
+	}{tags})
+	if err != nil {
+		return nil, err
+	}
+	return &gomatrixserverlib.ClientEvent{
+		Type:    "m.tag",
+		Content: content,
+	}, nil
+}
+
+// PartitionOffsets implements common.PartitionStorer
+func (d *Database) PartitionOffsets(topic string) ([]common.PartitionOffset, error) {
+	return d.partitions.SelectPartitionOffsets(topic)
+}
+
+// SetPartitionOffset implements common.PartitionStorer
+func (d *Database) SetPartitionOffset(topic string, partition int32, offset int64) error {
+	return d.partitions.UpsertPartitionOffset(topic, partition, offset)
+}
+
+// nowMillis returns the current time as a unix timestamp with millisecond resolution.
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func runTransaction(db *sql.DB, fn func(txn *sql.Tx) error) (err error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			txn.Rollback()
+			panic(r)
+		} else if err != nil {
+			txn.Rollback()
+		} else {
+			err = txn.Commit()
+		}
+	}()
+	err = fn(txn)
+	return
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import "testing"
+
+func TestForgottenRoomsIsForgotten(t *testing.T) {
+	forgotten := ForgottenRooms{"!room:localhost": "$leave:localhost"}
+	tests := []struct {
+		roomID            string
+		membershipEventID string
+		want              bool
+	}{
+		{"!room:localhost", "$leave:localhost", true},
+		// The user has rejoined or been invited back since forgetting the room.
+		{"!room:localhost", "$rejoin:localhost", false},
+		{"!room:localhost", "", false},
+		{"!other:localhost", "$leave:localhost", false},
+	}
+	for _, tt := range tests {
+		if got := forgotten.IsForgotten(tt.roomID, tt.membershipEventID); got != tt.want {
+			t.Errorf("IsForgotten(%q, %q): want %v, got %v", tt.roomID, tt.membershipEventID, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/matrix-org/util"
+)
+
+// The length of generated access tokens in bytes, before they are base64 encoded.
+const accessTokenByteLength = 32
+
+// The length of generated device IDs.
+const deviceIDLength = 10
+
+// GenerateAccessToken creates a new opaque access token. The token is generated from a
+// cryptographically secure source of randomness so that it can't be guessed by other clients.
+// Returns an error if the random number generator failed.
+func GenerateAccessToken() (string, error) {
+	b := make([]byte, accessTokenByteLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// url-safe no padding
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GenerateDeviceID creates a new device ID for a client which didn't supply one.
+// Device IDs only need to be unique per user, so they don't need to be unguessable.
+func GenerateDeviceID() string {
+	return util.RandomString(deviceIDLength)
+}
@@ -25,6 +25,10 @@ type MemberContent struct {
 	Membership  string `json:"membership"`
 	DisplayName string `json:"displayname,omitempty"`
 	AvatarURL   string `json:"avatar_url,omitempty"`
+	// Set on invites to mark the room as a direct chat with the invitee.
+	IsDirect bool `json:"is_direct,omitempty"`
+	// Why the membership was changed, e.g. the reason for a kick or ban.
+	Reason string `json:"reason,omitempty"`
 	// TODO: ThirdPartyInvite string `json:"third_party_invite,omitempty"`
 }
 
@@ -74,3 +78,38 @@ func InitialPowerLevelsContent(roomCreator string) PowerLevelContent {
 		Users: map[string]int{roomCreator: 100},
 	}
 }
+
+// GuestAccessContent is the event content for http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-guest-access
+type GuestAccessContent struct {
+	GuestAccess string `json:"guest_access"`
+}
+
+// NameContent is the event content for http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-name
+type NameContent struct {
+	Name string `json:"name"`
+}
+
+// TopicContent is the event content for http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-topic
+type TopicContent struct {
+	Topic string `json:"topic"`
+}
+
+// CanonicalAliasContent is the event content for http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-canonical-alias
+type CanonicalAliasContent struct {
+	Alias string `json:"alias"`
+}
+
+// AliasesContent is the event content for http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-aliases
+type AliasesContent struct {
+	Aliases []string `json:"aliases"`
+}
+
+// AvatarContent is the event content for http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-avatar
+type AvatarContent struct {
+	URL string `json:"url"`
+}
+
+// RedactionContent is the event content for http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-redaction
+type RedactionContent struct {
+	Reason string `json:"reason,omitempty"`
+}
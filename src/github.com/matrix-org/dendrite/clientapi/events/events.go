@@ -0,0 +1,85 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// ErrRoomNoExists is returned when trying to build an event for a room the server doesn't know about.
+var ErrRoomNoExists = errors.New("Room does not exist")
+
+// BuildEvent fills out the prev_events and auth_events of the builder from the current state of
+// the room, then builds and signs the event. It returns a *gomatrixserverlib.NotAllowed error if
+// the event fails the auth checks against that state, or ErrRoomNoExists if the room isn't known.
+// If queryRes is not nil it is filled with the roomserver's response, for callers which need to
+// look at the state of the room.
+func BuildEvent(
+	builder *gomatrixserverlib.EventBuilder, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	queryRes *api.QueryLatestEventsAndStateResponse,
+) (*gomatrixserverlib.Event, error) {
+	// work out what will be required in order to send this event
+	needed, err := gomatrixserverlib.StateNeededForEventBuilder(builder)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask the roomserver for information about this room
+	queryReq := api.QueryLatestEventsAndStateRequest{
+		RoomID:       builder.RoomID,
+		StateToFetch: needed.Tuples(),
+	}
+	if queryRes == nil {
+		queryRes = &api.QueryLatestEventsAndStateResponse{}
+	}
+	if err = queryAPI.QueryLatestEventsAndState(&queryReq, queryRes); err != nil {
+		return nil, err
+	}
+	if !queryRes.RoomExists {
+		return nil, ErrRoomNoExists
+	}
+
+	// set the fields we previously couldn't do and build the event
+	builder.PrevEvents = queryRes.LatestEvents // the current events will be the prev events of the new event
+	var refs []gomatrixserverlib.EventReference
+	for _, e := range queryRes.StateEvents {
+		refs = append(refs, e.EventReference())
+	}
+	builder.AuthEvents = refs
+	eventID := fmt.Sprintf("$%s:%s", util.RandomString(16), cfg.Matrix.ServerName)
+	event, err := builder.Build(eventID, time.Now(), cfg.Matrix.ServerName, cfg.Matrix.KeyID, cfg.Matrix.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// check to see if the sender can perform this operation
+	stateEvents := make([]*gomatrixserverlib.Event, len(queryRes.StateEvents))
+	for i := range queryRes.StateEvents {
+		stateEvents[i] = &queryRes.StateEvents[i]
+	}
+	provider := gomatrixserverlib.NewAuthEvents(stateEvents)
+	if err = gomatrixserverlib.Allowed(event, &provider); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
@@ -16,7 +16,9 @@ package httputil
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/matrix-org/dendrite/clientapi/jsonerror"
 	"github.com/matrix-org/util"
@@ -45,3 +47,43 @@ func LogThenError(req *http.Request, err error) util.JSONResponse {
 	util.GetLogger(req.Context()).WithError(err).Error("request failed")
 	return jsonerror.InternalServerError()
 }
+
+// TrustProxies wraps the handler so that the RemoteAddr of requests which came through the trusted
+// proxies is the address of the client. Each proxy appends the address it received the request
+// from to the X-Forwarded-For header, so the client is the last address in the header which isn't
+// a trusted proxy. The header is ignored in requests from other addresses, since clients can set it
+// to anything they like.
+func TrustProxies(trusted []*net.IPNet, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		forwardedFor := req.Header.Get("X-Forwarded-For")
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil || forwardedFor == "" || !isTrusted(trusted, host) {
+			h.ServeHTTP(w, req)
+			return
+		}
+		addrs := strings.Split(forwardedFor, ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if net.ParseIP(addr) == nil {
+				// The header is malformed, so use the address of the last proxy we could trust.
+				break
+			}
+			host = addr
+			if !isTrusted(trusted, addr) {
+				break
+			}
+		}
+		req.RemoteAddr = net.JoinHostPort(host, "0")
+		h.ServeHTTP(w, req)
+	})
+}
+
+func isTrusted(trusted []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	for _, ipNet := range trusted {
+		if ip != nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
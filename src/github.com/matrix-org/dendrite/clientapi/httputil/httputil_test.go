@@ -0,0 +1,57 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httputil
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustProxies(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"1.2.3.4:1234", "", "1.2.3.4:1234"},
+		// Clients which don't connect through a trusted proxy can't choose their address.
+		{"1.2.3.4:1234", "5.6.7.8", "1.2.3.4:1234"},
+		{"10.0.0.1:1234", "5.6.7.8", "5.6.7.8:0"},
+		// Only the addresses appended by trusted proxies are used.
+		{"10.0.0.1:1234", "9.9.9.9, 5.6.7.8, 10.0.0.2", "5.6.7.8:0"},
+		{"10.0.0.1:1234", "garbage, 10.0.0.2", "10.0.0.2:0"},
+	}
+	for _, tt := range tests {
+		var got string
+		h := TrustProxies([]*net.IPNet{proxies}, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			got = req.RemoteAddr
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("TrustProxies(%s, %q): want RemoteAddr %s, got %s", tt.remoteAddr, tt.forwardedFor, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producers
+
+import (
+	"encoding/json"
+
+	"github.com/matrix-org/dendrite/clientapi/api"
+	sarama "gopkg.in/Shopify/sarama.v1"
+)
+
+// LogoutProducer produces messages telling other components that devices were logged out.
+type LogoutProducer struct {
+	Topic    string
+	Producer sarama.SyncProducer
+}
+
+// NewLogoutProducer creates a new LogoutProducer
+func NewLogoutProducer(kafkaURIs []string, topic string) (*LogoutProducer, error) {
+	producer, err := sarama.NewSyncProducer(kafkaURIs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LogoutProducer{
+		Topic:    topic,
+		Producer: producer,
+	}, nil
+}
+
+// SendRevokedDevices writes a message to the logout output log saying that the access tokens
+// of the given devices have been revoked.
+func (p *LogoutProducer) SendRevokedDevices(userID string, deviceIDs []string) error {
+	value, err := json.Marshal(api.OutputRevokedDevices{
+		UserID:    userID,
+		DeviceIDs: deviceIDs,
+	})
+	if err != nil {
+		return err
+	}
+	var m sarama.ProducerMessage
+	m.Topic = p.Topic
+	m.Key = sarama.StringEncoder(userID)
+	m.Value = sarama.ByteEncoder(value)
+	_, _, err = p.Producer.SendMessage(&m)
+	return err
+}
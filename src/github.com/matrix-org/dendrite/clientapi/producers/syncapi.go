@@ -0,0 +1,59 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producers
+
+import (
+	"encoding/json"
+
+	"github.com/matrix-org/dendrite/clientapi/api"
+	sarama "gopkg.in/Shopify/sarama.v1"
+)
+
+// SyncAPIProducer produces messages telling the sync server that a user's account data changed.
+type SyncAPIProducer struct {
+	Topic    string
+	Producer sarama.SyncProducer
+}
+
+// NewSyncAPIProducer creates a new SyncAPIProducer
+func NewSyncAPIProducer(kafkaURIs []string, topic string) (*SyncAPIProducer, error) {
+	producer, err := sarama.NewSyncProducer(kafkaURIs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncAPIProducer{
+		Topic:    topic,
+		Producer: producer,
+	}, nil
+}
+
+// SendData writes a message to the client data output log saying that the account data of the
+// given type was changed for the user. roomID is empty for global account data.
+func (p *SyncAPIProducer) SendData(userID, roomID, dataType string) error {
+	value, err := json.Marshal(api.OutputClientData{
+		UserID: userID,
+		RoomID: roomID,
+		Type:   dataType,
+	})
+	if err != nil {
+		return err
+	}
+	var m sarama.ProducerMessage
+	m.Topic = p.Topic
+	m.Key = sarama.StringEncoder(userID)
+	m.Value = sarama.ByteEncoder(value)
+	_, _, err = p.Producer.SendMessage(&m)
+	return err
+}
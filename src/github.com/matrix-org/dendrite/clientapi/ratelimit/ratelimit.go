@@ -0,0 +1,124 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit implements token bucket rate limiting for client requests.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// How often buckets which have refilled completely are removed from memory.
+const pruneInterval = time.Minute
+
+// Limiter is a set of token buckets, one for each key. Each bucket holds up to burst tokens and
+// refills at a constant rate. Every request takes a token from its bucket and is refused if the
+// bucket is empty. A nil Limiter allows every request.
+type Limiter struct {
+	perSecond float64
+	burst     float64
+	// now is swapped out in tests.
+	now       func() time.Time
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	// When the number of tokens was last calculated.
+	updated time.Time
+}
+
+// NewLimiter makes a Limiter which allows bursts of up to burst requests per key, refilling at
+// perSecond requests per second. Returns nil if perSecond isn't positive, disabling the limit.
+func NewLimiter(perSecond float64, burst int) *Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		now:       time.Now,
+		buckets:   map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket for each of the keys. If any of the buckets is empty then
+// no tokens are taken, and it returns false along with how long the client should wait before a
+// token becomes available in all of them.
+func (l *Limiter) Allow(keys ...string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastPrune) > pruneInterval {
+		l.prune(now)
+	}
+
+	buckets := make([]*bucket, len(keys))
+	var wait time.Duration
+	for i, key := range keys {
+		b := l.buckets[key]
+		if b == nil {
+			b = &bucket{tokens: l.burst, updated: now}
+			l.buckets[key] = b
+		} else {
+			b.tokens = l.refill(b, now)
+			b.updated = now
+		}
+		if b.tokens < 1 {
+			bucketWait := time.Duration(math.Ceil((1 - b.tokens) / l.perSecond * float64(time.Second)))
+			if bucketWait > wait {
+				wait = bucketWait
+			}
+		}
+		buckets[i] = b
+	}
+
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// refill returns the number of tokens in the bucket at the given time.
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(l.burst, b.tokens+elapsed*l.perSecond)
+}
+
+// prune removes the buckets which are full, since they behave the same as a new bucket.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestLimiter(perSecond float64, burst int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	l := NewLimiter(perSecond, burst)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l, _ := newTestLimiter(1, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("@alice:localhost"); !ok {
+			t.Fatalf("request %d: want allowed, got refused", i)
+		}
+	}
+	ok, wait := l.Allow("@alice:localhost")
+	if ok {
+		t.Fatal("request 3: want refused, got allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("want wait of %s, got %s", time.Second, wait)
+	}
+	if ok, _ := l.Allow("@bob:localhost"); !ok {
+		t.Error("want other keys to have their own bucket, got refused")
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l, clock := newTestLimiter(0.5, 1)
+	if ok, _ := l.Allow("1.2.3.4"); !ok {
+		t.Fatal("want first request allowed, got refused")
+	}
+	clock.advance(time.Second)
+	ok, wait := l.Allow("1.2.3.4")
+	if ok {
+		t.Fatal("want refused before the bucket refills, got allowed")
+	}
+	if wait != time.Second {
+		t.Errorf("want wait of %s, got %s", time.Second, wait)
+	}
+	clock.advance(time.Second)
+	if ok, _ := l.Allow("1.2.3.4"); !ok {
+		t.Error("want allowed after the bucket refills, got refused")
+	}
+}
+
+func TestLimiterMultipleKeys(t *testing.T) {
+	l, _ := newTestLimiter(1, 1)
+	if ok, _ := l.Allow("ip:1.2.3.4"); !ok {
+		t.Fatal("want first request allowed, got refused")
+	}
+	if ok, _ := l.Allow("user:@alice:localhost", "ip:1.2.3.4"); ok {
+		t.Fatal("want refused when one of the buckets is empty, got allowed")
+	}
+	if ok, _ := l.Allow("user:@alice:localhost", "ip:5.6.7.8"); !ok {
+		t.Error("want a refused request not to take tokens from the other buckets, got refused")
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	l, clock := newTestLimiter(1, 2)
+	l.Allow("a")
+	clock.advance(2 * pruneInterval)
+	l.Allow("b")
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("want full bucket to be pruned")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("want bucket in use to be kept")
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	l := NewLimiter(0, 10)
+	if l != nil {
+		t.Fatal("want nil Limiter when the rate is zero")
+	}
+	if ok, _ := l.Allow("anyone"); !ok {
+		t.Error("want nil Limiter to allow everything")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/util"
+)
+
+// GetAccountData implements GET /user/{userID}/account_data/{type} and
+// GET /user/{userID}/rooms/{roomID}/account_data/{type}. roomID is empty for global account data.
+func GetAccountData(
+	req *http.Request, userID, roomID, dataType string, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	if userID != device.UserID {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("Cannot get the account data of another user"),
+		}
+	}
+
+	data, err := accountDB.GetAccountDataByType(userID, roomID, dataType)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if data == nil {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Account data not found"),
+		}
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: data.Content,
+	}
+}
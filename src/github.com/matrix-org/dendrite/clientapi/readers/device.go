@@ -0,0 +1,94 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/util"
+)
+
+// http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#get-matrix-client-unstable-devices
+type deviceJSON struct {
+	DeviceID    string `json:"device_id"`
+	UserID      string `json:"user_id"`
+	DisplayName string `json:"display_name,omitempty"`
+	LastSeenIP  string `json:"last_seen_ip"`
+	LastSeenTS  int64  `json:"last_seen_ts"`
+}
+
+type devicesJSON struct {
+	Devices []deviceJSON `json:"devices"`
+}
+
+func toDeviceJSON(dev authtypes.Device) deviceJSON {
+	return deviceJSON{
+		DeviceID:    dev.ID,
+		UserID:      dev.UserID,
+		DisplayName: dev.DisplayName,
+		LastSeenIP:  dev.LastSeenIP,
+		LastSeenTS:  dev.LastSeenTS,
+	}
+}
+
+// GetDevices implements GET /devices
+func GetDevices(req *http.Request, accountDB *accounts.Database) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	devices, err := accountDB.GetDevicesByUserID(device.UserID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	res := devicesJSON{Devices: []deviceJSON{}}
+	for _, dev := range devices {
+		res.Devices = append(res.Devices, toDeviceJSON(dev))
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: res,
+	}
+}
+
+// GetDevice implements GET /devices/{deviceID}
+func GetDevice(req *http.Request, deviceID string, accountDB *accounts.Database) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	dev, err := accountDB.GetDevice(device.UserID, deviceID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if dev == nil {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Unknown device"),
+		}
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: toDeviceJSON(*dev),
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-directory-room-roomalias
+type directoryRoomResponse struct {
+	RoomID  string   `json:"room_id"`
+	Servers []string `json:"servers"`
+}
+
+// DirectoryRoom implements GET /directory/room/{roomAlias}
+func DirectoryRoom(
+	req *http.Request, roomAlias string, cfg *config.Dendrite, aliasAPI api.RoomserverAliasAPI,
+) util.JSONResponse {
+	if !strings.HasPrefix(roomAlias, "#") || !strings.Contains(roomAlias, ":") {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("Room alias must be in the form '#localpart:domain'"),
+		}
+	}
+
+	// TODO: Ask the server in the alias if it isn't ours.
+	queryReq := api.GetAliasRoomIDRequest{Alias: roomAlias}
+	var queryRes api.GetAliasRoomIDResponse
+	if err := aliasAPI.GetAliasRoomID(&queryReq, &queryRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if queryRes.RoomID == "" {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room alias " + roomAlias + " not found."),
+		}
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: directoryRoomResponse{
+			RoomID:  queryRes.RoomID,
+			Servers: []string{cfg.Matrix.ServerName},
+		},
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// GetEvent implements GET /rooms/{roomID}/event/{eventID}
+// The event is only returned if the user could see it given the state of the room before it.
+// Otherwise the response is a 404, so that users can't find out which events exist.
+func GetEvent(
+	req *http.Request, roomID, eventID string, queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	notFound := util.JSONResponse{
+		Code: 404,
+		JSON: jsonerror.NotFound("The event was not found or you do not have permission to read this event"),
+	}
+
+	eventsReq := api.QueryEventsByIDRequest{EventIDs: []string{eventID}}
+	var eventsRes api.QueryEventsByIDResponse
+	if err := queryAPI.QueryEventsByID(&eventsReq, &eventsRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if len(eventsRes.Events) == 0 || eventsRes.Events[0].RoomID() != roomID {
+		return notFound
+	}
+
+	visibleReq := api.QueryEventsVisibleToUserRequest{UserID: device.UserID, EventIDs: []string{eventID}}
+	var visibleRes api.QueryEventsVisibleToUserResponse
+	if err := queryAPI.QueryEventsVisibleToUser(&visibleReq, &visibleRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if len(visibleRes.VisibleEventIDs) == 0 {
+		return notFound
+	}
+
+	forgotten, err := isRoomForgotten(device.UserID, roomID, queryAPI, accountDB)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if forgotten {
+		return notFound
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: gomatrixserverlib.ToClientEvent(eventsRes.Events[0], gomatrixserverlib.FormatAll),
+	}
+}
+
+// isRoomForgotten returns whether the user has forgotten the room since they last left it.
+func isRoomForgotten(
+	userID, roomID string, queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) (bool, error) {
+	queryReq := api.QueryLatestEventsAndStateRequest{
+		RoomID: roomID,
+		StateToFetch: []gomatrixserverlib.StateKeyTuple{
+			{EventType: "m.room.member", StateKey: userID},
+		},
+	}
+	var queryRes api.QueryLatestEventsAndStateResponse
+	if err := queryAPI.QueryLatestEventsAndState(&queryReq, &queryRes); err != nil {
+		return false, err
+	}
+	var membershipEventID string
+	if len(queryRes.StateEvents) > 0 {
+		membershipEventID = queryRes.StateEvents[0].EventID()
+	}
+	return accountDB.IsRoomForgotten(userID, roomID, membershipEventID)
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/util"
+)
+
+// How long other servers may cache our keys for before fetching them again.
+const serverKeysValidity = 24 * time.Hour
+
+// LocalKeys implements GET /_matrix/key/v2/server
+// It returns the current signing key of this server, and the old keys which events were signed with
+// before they expired.
+func LocalKeys(req *http.Request, cfg *config.Dendrite) util.JSONResponse {
+	keys, err := common.SignedServerKeys(
+		cfg.Matrix.ServerName, cfg.Matrix.KeyID, cfg.Matrix.PrivateKey, cfg.Matrix.OldVerifyKeys,
+		time.Now().Add(serverKeysValidity),
+	)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: json.RawMessage(keys),
+	}
+}
@@ -16,11 +16,16 @@ package readers
 
 import (
 	"fmt"
-	"github.com/matrix-org/dendrite/clientapi/config"
+	"net/http"
+	"strings"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
 	"github.com/matrix-org/dendrite/clientapi/httputil"
 	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/common/config"
 	"github.com/matrix-org/util"
-	"net/http"
 )
 
 type loginFlows struct {
@@ -28,34 +33,51 @@ type loginFlows struct {
 }
 
 type flow struct {
-	Type   string   `json:"type"`
-	Stages []string `json:"stages"`
+	Type   authtypes.LoginType   `json:"type"`
+	Stages []authtypes.LoginType `json:"stages"`
 }
 
 type passwordRequest struct {
-	User     string `json:"user"`
-	Password string `json:"password"`
+	Type               authtypes.LoginType `json:"type"`
+	User               string              `json:"user"`
+	Password           string              `json:"password"`
+	DeviceID           string              `json:"device_id"`
+	InitialDisplayName *string             `json:"initial_device_display_name"`
 }
 
 type loginResponse struct {
 	UserID      string `json:"user_id"`
 	AccessToken string `json:"access_token"`
 	HomeServer  string `json:"home_server"`
+	DeviceID    string `json:"device_id"`
 }
 
-func passwordLogin() loginFlows {
-	f := loginFlows{}
-	s := flow{"m.login.password", []string{"m.login.password"}}
-	f.Flows = append(f.Flows, s)
+// loginFlowsFromConfig returns a single-stage flow for each login type enabled in the config.
+func loginFlowsFromConfig(cfg *config.Dendrite) loginFlows {
+	f := loginFlows{Flows: []flow{}}
+	for _, t := range cfg.Matrix.LoginTypes {
+		loginType := authtypes.LoginType(t)
+		f.Flows = append(f.Flows, flow{loginType, []authtypes.LoginType{loginType}})
+	}
 	return f
 }
 
+// loginTypeEnabled returns true if the given login type is enabled in the config.
+func loginTypeEnabled(cfg *config.Dendrite, loginType authtypes.LoginType) bool {
+	for _, t := range cfg.Matrix.LoginTypes {
+		if authtypes.LoginType(t) == loginType {
+			return true
+		}
+	}
+	return false
+}
+
 // Login implements GET and POST /login
-func Login(req *http.Request, cfg config.ClientAPI) util.JSONResponse {
-	if req.Method == "GET" { // TODO: support other forms of login other than password, depending on config options
+func Login(req *http.Request, accountDB *accounts.Database, cfg *config.Dendrite) util.JSONResponse {
+	if req.Method == "GET" {
 		return util.JSONResponse{
 			Code: 200,
-			JSON: passwordLogin(),
+			JSON: loginFlowsFromConfig(cfg),
 		}
 	} else if req.Method == "POST" {
 		var r passwordRequest
@@ -63,19 +85,62 @@ func Login(req *http.Request, cfg config.ClientAPI) util.JSONResponse {
 		if resErr != nil {
 			return *resErr
 		}
+		if r.Type == "" {
+			r.Type = authtypes.LoginTypePassword
+		}
+		if r.Type != authtypes.LoginTypePassword || !loginTypeEnabled(cfg, r.Type) {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.Unknown(fmt.Sprintf("Unknown login type: %s", r.Type)),
+			}
+		}
 		if r.User == "" {
 			return util.JSONResponse{
 				Code: 400,
 				JSON: jsonerror.BadJSON("'user' must be supplied."),
 			}
 		}
-		// TODO: Check username and password properly
+
+		localpart, err := localpartFromUser(r.User, cfg.Matrix.ServerName)
+		if err != nil {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON(err.Error()),
+			}
+		}
+
+		acc, err := accountDB.GetAccountByPassword(localpart, r.Password)
+		if err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if acc == nil {
+			// Don't reveal whether the account exists or the password was wrong.
+			return util.JSONResponse{
+				Code: 403,
+				JSON: jsonerror.Forbidden("username or password was incorrect, or account does not exist"),
+			}
+		}
+
+		userID := makeUserID(acc.Localpart, cfg.Matrix.ServerName)
+		deviceID := r.DeviceID
+		if deviceID == "" {
+			deviceID = auth.GenerateDeviceID()
+		}
+		token, err := auth.GenerateAccessToken()
+		if err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if err = accountDB.CreateDevice(userID, deviceID, r.InitialDisplayName, token, auth.RemoteIP(req)); err != nil {
+			return httputil.LogThenError(req, err)
+		}
+
 		return util.JSONResponse{
 			Code: 200,
 			JSON: loginResponse{
-				UserID:      makeUserID(r.User, cfg.ServerName),
-				AccessToken: makeUserID(r.User, cfg.ServerName), // FIXME: token is the user ID for now
-				HomeServer:  cfg.ServerName,
+				UserID:      userID,
+				AccessToken: token,
+				HomeServer:  cfg.Matrix.ServerName,
+				DeviceID:    deviceID,
 			},
 		}
 	}
@@ -85,6 +150,16 @@ func Login(req *http.Request, cfg config.ClientAPI) util.JSONResponse {
 	}
 }
 
+// localpartFromUser extracts the localpart from the 'user' field of a login request, which
+// may be either a bare localpart or a full user ID e.g '@alice:localhost'.
+// Returns an error if the user ID belongs to a different server.
+func localpartFromUser(user, serverName string) (string, error) {
+	if !strings.HasPrefix(user, "@") {
+		return user, nil
+	}
+	return auth.LocalpartFromUserID(user, serverName)
+}
+
 func makeUserID(localpart, domain string) string {
 	return fmt.Sprintf("@%s:%s", localpart, domain)
 }
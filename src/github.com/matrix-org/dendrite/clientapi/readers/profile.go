@@ -0,0 +1,107 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-profile-userid
+type profileResponse struct {
+	DisplayName string `json:"displayname,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+type displayNameResponse struct {
+	DisplayName string `json:"displayname,omitempty"`
+}
+
+type avatarURLResponse struct {
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+// GetProfile implements GET /profile/{userID}
+func GetProfile(req *http.Request, userID string, cfg *config.Dendrite, accountDB *accounts.Database) util.JSONResponse {
+	profile, resErr := loadProfile(req, userID, cfg, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: profileResponse{profile.DisplayName, profile.AvatarURL},
+	}
+}
+
+// GetDisplayName implements GET /profile/{userID}/displayname
+func GetDisplayName(req *http.Request, userID string, cfg *config.Dendrite, accountDB *accounts.Database) util.JSONResponse {
+	profile, resErr := loadProfile(req, userID, cfg, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: displayNameResponse{profile.DisplayName},
+	}
+}
+
+// GetAvatarURL implements GET /profile/{userID}/avatar_url
+func GetAvatarURL(req *http.Request, userID string, cfg *config.Dendrite, accountDB *accounts.Database) util.JSONResponse {
+	profile, resErr := loadProfile(req, userID, cfg, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: avatarURLResponse{profile.AvatarURL},
+	}
+}
+
+// loadProfile returns the profile of the account with the given user ID, or a 404 if the user
+// doesn't have an account on this server.
+func loadProfile(
+	req *http.Request, userID string, cfg *config.Dendrite, accountDB *accounts.Database,
+) (*authtypes.Profile, *util.JSONResponse) {
+	notFound := &util.JSONResponse{
+		Code: 404,
+		JSON: jsonerror.NotFound("Profile was not found"),
+	}
+	// TODO: Fetch the profiles of remote users over federation.
+	localpart, err := auth.LocalpartFromUserID(userID, cfg.Matrix.ServerName)
+	if err != nil {
+		return nil, notFound
+	}
+	acc, err := accountDB.GetAccountByLocalpart(localpart)
+	if err != nil {
+		resErr := httputil.LogThenError(req, err)
+		return nil, &resErr
+	}
+	if acc == nil {
+		return nil, notFound
+	}
+	profile, err := accountDB.GetProfileByLocalpart(localpart)
+	if err != nil {
+		resErr := httputil.LogThenError(req, err)
+		return nil, &resErr
+	}
+	return profile, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// http://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-rooms-roomid-joined-members
+type joinedMember struct {
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+type joinedMembersResponse struct {
+	Joined map[string]joinedMember `json:"joined"`
+}
+
+// GetRoomState implements GET /rooms/{roomID}/state
+func GetRoomState(
+	req *http.Request, roomID string, queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	stateEvents, resErr := queryStateForUser(req, roomID, nil, queryAPI, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: gomatrixserverlib.ToClientEvents(stateEvents, gomatrixserverlib.FormatAll),
+	}
+}
+
+// GetRoomStateEvent implements GET /rooms/{roomID}/state/{eventType} and
+// GET /rooms/{roomID}/state/{eventType}/{stateKey}
+func GetRoomStateEvent(
+	req *http.Request, roomID, eventType, stateKey string,
+	queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	stateEvents, resErr := queryStateForUser(
+		req, roomID, []gomatrixserverlib.StateKeyTuple{{EventType: eventType, StateKey: stateKey}}, queryAPI, accountDB,
+	)
+	if resErr != nil {
+		return *resErr
+	}
+	if len(stateEvents) == 0 {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Cannot find state event"),
+		}
+	}
+	content := json.RawMessage(stateEvents[0].Content())
+	return util.JSONResponse{
+		Code: 200,
+		JSON: &content,
+	}
+}
+
+// GetJoinedMembers implements GET /rooms/{roomID}/joined_members
+func GetJoinedMembers(
+	req *http.Request, roomID string, queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	queryReq := api.QueryMembershipsForRoomRequest{RoomID: roomID, UserID: device.UserID}
+	var queryRes api.QueryMembershipsForRoomResponse
+	if err := queryAPI.QueryMembershipsForRoom(&queryReq, &queryRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if resErr := checkRoomVisible(queryRes.RoomExists, queryRes.HasBeenInRoom); resErr != nil {
+		return *resErr
+	}
+
+	res := joinedMembersResponse{Joined: map[string]joinedMember{}}
+	for _, event := range queryRes.MemberEvents {
+		var content events.MemberContent
+		if err := json.Unmarshal(event.Content(), &content); err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if content.Membership != "join" || event.StateKey() == nil {
+			continue
+		}
+		res.Joined[*event.StateKey()] = joinedMember{
+			DisplayName: content.DisplayName,
+			AvatarURL:   content.AvatarURL,
+		}
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: res,
+	}
+}
+
+// queryStateForUser asks the roomserver for the state of the room which the requesting user is
+// allowed to see. If stateToFetch is empty then the full state is returned.
+func queryStateForUser(
+	req *http.Request, roomID string, stateToFetch []gomatrixserverlib.StateKeyTuple,
+	queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) ([]gomatrixserverlib.Event, *util.JSONResponse) {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return nil, resErr
+	}
+
+	queryReq := api.QueryStateForUserRequest{
+		RoomID:       roomID,
+		UserID:       device.UserID,
+		StateToFetch: stateToFetch,
+	}
+	var queryRes api.QueryStateForUserResponse
+	if err := queryAPI.QueryStateForUser(&queryReq, &queryRes); err != nil {
+		resErr := httputil.LogThenError(req, err)
+		return nil, &resErr
+	}
+	if resErr := checkRoomVisible(queryRes.RoomExists, queryRes.HasBeenInRoom); resErr != nil {
+		return nil, resErr
+	}
+	return queryRes.StateEvents, nil
+}
+
+// checkRoomVisible returns an error response if the room doesn't exist or if the user has never
+// been in it.
+func checkRoomVisible(roomExists, hasBeenInRoom bool) *util.JSONResponse {
+	if !roomExists {
+		return &util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room does not exist"),
+		}
+	}
+	if !hasBeenInRoom {
+		return &util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You aren't a member of the room and weren't previously a member of the room."),
+		}
+	}
+	return nil
+}
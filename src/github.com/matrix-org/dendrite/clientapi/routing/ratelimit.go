@@ -0,0 +1,99 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/ratelimit"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/util"
+)
+
+// rateLimits throttles requests to the client API. There is a separate limiter for each kind of
+// request, and each limiter has a bucket for every user and every IP address.
+type rateLimits struct {
+	messages     *ratelimit.Limiter
+	roomCreation *ratelimit.Limiter
+	login        *ratelimit.Limiter
+	registration *ratelimit.Limiter
+	// Throttles the member events sent when a user changes their profile, rather than requests.
+	profileUpdates *ratelimit.Limiter
+	exempt         map[string]bool
+	deviceDB       auth.DeviceDatabase
+}
+
+func newRateLimits(cfg *config.Dendrite, deviceDB auth.DeviceDatabase) *rateLimits {
+	limits := cfg.RateLimits
+	exempt := map[string]bool{}
+	for _, userID := range limits.ExemptUserIDs {
+		exempt[userID] = true
+	}
+	return &rateLimits{
+		messages:       newLimiter(limits.Messages),
+		roomCreation:   newLimiter(limits.RoomCreation),
+		login:          newLimiter(limits.Login),
+		registration:   newLimiter(limits.Registration),
+		profileUpdates: newLimiter(limits.ProfileUpdates),
+		exempt:         exempt,
+		deviceDB:       deviceDB,
+	}
+}
+
+func newLimiter(limit config.RateLimit) *ratelimit.Limiter {
+	return ratelimit.NewLimiter(limit.PerSecond, limit.Burst)
+}
+
+// limit wraps the handler so that requests are refused with M_LIMIT_EXCEEDED once the user the
+// client's access token belongs to runs out of requests in the limiter. Requests without a valid
+// access token are limited by IP address instead, leaving the handler to reject them if it
+// requires authentication. Authenticated requests don't use the IP address's bucket, so that users
+// behind the same NAT don't share one budget.
+func (r *rateLimits) limit(limiter *ratelimit.Limiter, h util.JSONRequestHandler) util.JSONRequestHandler {
+	if limiter == nil {
+		return h
+	}
+	return util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		key := "ip:" + auth.RemoteIP(req)
+		if token, err := auth.ExtractAccessToken(req); err == nil {
+			device, err := r.deviceDB.GetDeviceByAccessToken(token)
+			if err != nil {
+				util.GetLogger(req.Context()).WithError(err).Warn("Failed to look up device for rate limiting")
+			} else if device != nil {
+				if r.exempt[device.UserID] {
+					return h.OnIncomingRequest(req)
+				}
+				key = "user:" + device.UserID
+			}
+		}
+
+		if ok, wait := limiter.Allow(key); !ok {
+			return util.JSONResponse{
+				Code: 429,
+				JSON: jsonerror.LimitExceeded("Too many requests", retryAfterMS(wait)),
+			}
+		}
+		return h.OnIncomingRequest(req)
+	})
+}
+
+// retryAfterMS converts the time to wait into whole milliseconds, rounding up so that
+// clients which wait for exactly that long will be allowed.
+func retryAfterMS(wait time.Duration) int64 {
+	return int64((wait + time.Millisecond - 1) / time.Millisecond)
+}
@@ -19,54 +19,178 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"github.com/matrix-org/dendrite/clientapi/config"
+	"github.com/matrix-org/dendrite/clientapi/auth/interactive"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
 	"github.com/matrix-org/dendrite/clientapi/producers"
 	"github.com/matrix-org/dendrite/clientapi/readers"
 	"github.com/matrix-org/dendrite/clientapi/writers"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/common/transactions"
+	publicrooms "github.com/matrix-org/dendrite/publicroomsapi/api"
 	"github.com/matrix-org/dendrite/roomserver/api"
 	"github.com/matrix-org/util"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const pathPrefixR0 = "/_matrix/client/r0"
+const pathPrefixKeyV2 = "/_matrix/key/v2"
 
 // Setup registers HTTP handlers with the given ServeMux. It also supplies the given http.Client
 // to clients which need to make outbound HTTP requests.
-func Setup(servMux *http.ServeMux, httpClient *http.Client, cfg config.ClientAPI, producer *producers.RoomserverProducer, queryAPI api.RoomserverQueryAPI) {
+func Setup(
+	servMux *http.ServeMux, httpClient *http.Client, cfg *config.Dendrite, producer *producers.RoomserverProducer,
+	queryAPI api.RoomserverQueryAPI, aliasAPI api.RoomserverAliasAPI, publicRoomsAPI publicrooms.PublicRoomsAPI,
+	accountDB *accounts.Database, logoutProducer *producers.LogoutProducer, syncProducer *producers.SyncAPIProducer,
+) {
 	apiMux := mux.NewRouter()
 	r0mux := apiMux.PathPrefix(pathPrefixR0).Subrouter()
-	r0mux.Handle("/createRoom", make("createRoom", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
-		return writers.CreateRoom(req, cfg, producer)
-	})))
+	keyMux := apiMux.PathPrefix(pathPrefixKeyV2).Subrouter()
+	limits := newRateLimits(cfg, accountDB)
+	txnCache := transactions.New(transactions.DefaultTTL, transactions.DefaultMaxEntries)
+
+	r0mux.Handle("/createRoom", make("createRoom", limits.limit(limits.roomCreation, util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return writers.CreateRoom(req, cfg, producer, aliasAPI, publicRoomsAPI, accountDB)
+	}))))
+	r0mux.Handle("/join/{roomIDOrAlias}", make("join", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.JoinRoomByIDOrAlias(req, vars["roomIDOrAlias"], cfg, queryAPI, aliasAPI, producer, accountDB)
+	}))).Methods("POST")
+	r0mux.Handle("/rooms/{roomID}/join", make("join", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.JoinRoomByIDOrAlias(req, vars["roomID"], cfg, queryAPI, aliasAPI, producer, accountDB)
+	}))).Methods("POST")
+	r0mux.Handle("/rooms/{roomID}/leave", make("leave", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.LeaveRoom(req, vars["roomID"], cfg, queryAPI, producer, accountDB)
+	}))).Methods("POST")
+	r0mux.Handle("/rooms/{roomID}/forget", make("forget", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.ForgetRoom(req, vars["roomID"], queryAPI, accountDB)
+	}))).Methods("POST")
+	r0mux.Handle("/rooms/{roomID}/{action:(?:invite|kick|ban|unban)}", make("membership", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.SendMembership(req, vars["roomID"], vars["action"], cfg, queryAPI, producer, accountDB)
+	}))).Methods("POST")
 	r0mux.Handle("/rooms/{roomID}/send/{eventType}/{txnID}",
-		make("send_message", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		make("send_message", withTxnCache(txnCache, accountDB, limits.limit(limits.messages, util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
 			vars := mux.Vars(req)
-			return writers.SendEvent(req, vars["roomID"], vars["eventType"], vars["txnID"], nil, cfg, queryAPI, producer)
-		})),
+			return writers.SendEvent(req, vars["roomID"], vars["eventType"], nil, cfg, queryAPI, producer, accountDB)
+		})))),
 	)
 	r0mux.Handle("/rooms/{roomID}/state/{eventType}",
-		make("send_message", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		make("send_message", limits.limit(limits.messages, util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
 			vars := mux.Vars(req)
 			emptyString := ""
-			return writers.SendEvent(req, vars["roomID"], vars["eventType"], vars["txnID"], &emptyString, cfg, queryAPI, producer)
-		})),
-	)
+			return writers.SendEvent(req, vars["roomID"], vars["eventType"], &emptyString, cfg, queryAPI, producer, accountDB)
+		}))),
+	).Methods("PUT")
 	r0mux.Handle("/rooms/{roomID}/state/{eventType}/{stateKey}",
-		make("send_message", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		make("send_message", limits.limit(limits.messages, util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
 			vars := mux.Vars(req)
 			stateKey := vars["stateKey"]
-			return writers.SendEvent(req, vars["roomID"], vars["eventType"], vars["txnID"], &stateKey, cfg, queryAPI, producer)
-		})),
-	)
+			return writers.SendEvent(req, vars["roomID"], vars["eventType"], &stateKey, cfg, queryAPI, producer, accountDB)
+		}))),
+	).Methods("PUT")
 
-	// Stub endpoints required by Riot
+	r0mux.Handle("/rooms/{roomID}/state", make("room_state", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetRoomState(req, vars["roomID"], queryAPI, accountDB)
+	}))).Methods("GET")
+	r0mux.Handle("/rooms/{roomID}/state/{eventType}", make("room_state_event", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetRoomStateEvent(req, vars["roomID"], vars["eventType"], "", queryAPI, accountDB)
+	}))).Methods("GET")
+	r0mux.Handle("/rooms/{roomID}/state/{eventType}/{stateKey}", make("room_state_event", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetRoomStateEvent(req, vars["roomID"], vars["eventType"], vars["stateKey"], queryAPI, accountDB)
+	}))).Methods("GET")
+	r0mux.Handle("/rooms/{roomID}/joined_members", make("joined_members", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetJoinedMembers(req, vars["roomID"], queryAPI, accountDB)
+	}))).Methods("GET")
+	r0mux.Handle("/rooms/{roomID}/event/{eventID}", make("room_event", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetEvent(req, vars["roomID"], vars["eventID"], queryAPI, accountDB)
+	}))).Methods("GET")
 
-	r0mux.Handle("/login",
-		make("login", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
-			return readers.Login(req, cfg)
-		})),
+	r0mux.Handle("/rooms/{roomID}/redact/{eventID}/{txnID}",
+		make("redact", withTxnCache(txnCache, accountDB, limits.limit(limits.messages, util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return writers.Redact(req, vars["roomID"], vars["eventID"], cfg, queryAPI, producer, accountDB)
+		})))),
+	).Methods("PUT")
+
+	r0mux.Handle("/directory/room/{roomAlias}", make("directory_room", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.DirectoryRoom(req, vars["roomAlias"], cfg, aliasAPI)
+	}))).Methods("GET")
+
+	r0mux.Handle("/directory/room/{roomAlias}", make("directory_room_set", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.SetLocalAlias(req, vars["roomAlias"], cfg, queryAPI, aliasAPI, producer, accountDB)
+	}))).Methods("PUT")
+
+	r0mux.Handle("/directory/room/{roomAlias}", make("directory_room_remove", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.RemoveLocalAlias(req, vars["roomAlias"], cfg, queryAPI, aliasAPI, producer, accountDB)
+	}))).Methods("DELETE")
+
+	r0mux.Handle("/register", make("register", limits.limit(limits.registration, util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return writers.Register(req, accountDB, cfg)
+	})))).Methods("POST")
+
+	r0mux.Handle("/register/available", make("register_available", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return writers.RegisterAvailable(req, accountDB)
+	}))).Methods("GET")
+
+	r0mux.Handle("/logout", make("logout", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return writers.Logout(req, accountDB, logoutProducer)
+	}))).Methods("POST")
+
+	r0mux.Handle("/logout/all", make("logout_all", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return writers.LogoutAll(req, accountDB, logoutProducer)
+	}))).Methods("POST")
+
+	loginHandler := util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return readers.Login(req, accountDB, cfg)
+	})
+
+	// Only attempts to log in are limited, so that clients can always fetch the login flows.
+	r0mux.Handle("/login", make("login", limits.limit(limits.login, loginHandler))).Methods("POST")
+	r0mux.Handle("/login", make("login", loginHandler))
+
+	// Deleting devices requires the user to confirm their password.
+	deviceDeletionAuth := interactive.New(
+		interactive.DefaultSessionTimeout,
+		[]interactive.Stage{interactive.PasswordStage{AccountDB: accountDB, ServerName: cfg.Matrix.ServerName}},
 	)
 
+	r0mux.Handle("/devices", make("get_devices", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return readers.GetDevices(req, accountDB)
+	}))).Methods("GET")
+
+	r0mux.Handle("/devices/{deviceID}", make("get_device", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetDevice(req, vars["deviceID"], accountDB)
+	}))).Methods("GET")
+
+	r0mux.Handle("/devices/{deviceID}", make("update_device", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.UpdateDevice(req, vars["deviceID"], accountDB)
+	}))).Methods("PUT")
+
+	r0mux.Handle("/devices/{deviceID}", make("delete_device", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return writers.DeleteDevice(req, vars["deviceID"], accountDB, deviceDeletionAuth, logoutProducer)
+	}))).Methods("DELETE")
+
+	r0mux.Handle("/delete_devices", make("delete_devices", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return writers.DeleteDevices(req, accountDB, deviceDeletionAuth, logoutProducer)
+	}))).Methods("POST")
+
+	// Stub endpoints required by Riot
+
 	r0mux.Handle("/pushrules/",
 		make("push_rules", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
 			// TODO: Implement push rules API
@@ -88,35 +212,103 @@ func Setup(servMux *http.ServeMux, httpClient *http.Client, cfg config.ClientAPI
 
 	r0mux.Handle("/user/{userID}/filter",
 		make("make_filter", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
-			// TODO: Persist filter and return filter ID
-			return util.JSONResponse{
-				Code: 200,
-				JSON: struct{}{},
-			}
+			vars := mux.Vars(req)
+			return writers.PutFilter(req, vars["userID"], accountDB)
 		})),
-	)
+	).Methods("POST")
 
 	r0mux.Handle("/user/{userID}/filter/{filterID}",
 		make("filter", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
-			// TODO: Retrieve filter based on ID
-			return util.JSONResponse{
-				Code: 200,
-				JSON: struct{}{},
-			}
+			vars := mux.Vars(req)
+			return readers.GetFilter(req, vars["userID"], vars["filterID"], accountDB)
 		})),
-	)
+	).Methods("GET")
+
+	r0mux.Handle("/user/{userID}/account_data/{type}",
+		make("user_account_data", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return writers.SaveAccountData(req, vars["userID"], "", vars["type"], accountDB, syncProducer)
+		})),
+	).Methods("PUT")
+
+	r0mux.Handle("/user/{userID}/account_data/{type}",
+		make("user_account_data", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return readers.GetAccountData(req, vars["userID"], "", vars["type"], accountDB)
+		})),
+	).Methods("GET")
+
+	r0mux.Handle("/user/{userID}/rooms/{roomID}/account_data/{type}",
+		make("user_room_account_data", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return writers.SaveAccountData(req, vars["userID"], vars["roomID"], vars["type"], accountDB, syncProducer)
+		})),
+	).Methods("PUT")
+
+	r0mux.Handle("/user/{userID}/rooms/{roomID}/account_data/{type}",
+		make("user_room_account_data", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return readers.GetAccountData(req, vars["userID"], vars["roomID"], vars["type"], accountDB)
+		})),
+	).Methods("GET")
+
+	r0mux.Handle("/user/{userID}/rooms/{roomID}/tags",
+		make("get_tags", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return readers.GetTags(req, vars["userID"], vars["roomID"], accountDB)
+		})),
+	).Methods("GET")
+
+	r0mux.Handle("/user/{userID}/rooms/{roomID}/tags/{tag}",
+		make("put_tag", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return writers.PutTag(req, vars["userID"], vars["roomID"], vars["tag"], accountDB, syncProducer)
+		})),
+	).Methods("PUT")
+
+	r0mux.Handle("/user/{userID}/rooms/{roomID}/tags/{tag}",
+		make("delete_tag", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return writers.DeleteTag(req, vars["userID"], vars["roomID"], vars["tag"], accountDB, syncProducer)
+		})),
+	).Methods("DELETE")
 
 	// Riot user settings
 
 	r0mux.Handle("/profile/{userID}",
 		make("profile", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
-			// TODO: Get profile data for user ID
-			return util.JSONResponse{
-				Code: 200,
-				JSON: struct{}{},
-			}
+			vars := mux.Vars(req)
+			return readers.GetProfile(req, vars["userID"], cfg, accountDB)
 		})),
-	)
+	).Methods("GET")
+
+	r0mux.Handle("/profile/{userID}/displayname",
+		make("profile_displayname", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return readers.GetDisplayName(req, vars["userID"], cfg, accountDB)
+		})),
+	).Methods("GET")
+
+	r0mux.Handle("/profile/{userID}/displayname",
+		make("profile_displayname", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return writers.SetDisplayName(req, vars["userID"], cfg, queryAPI, producer, accountDB, limits.profileUpdates)
+		})),
+	).Methods("PUT")
+
+	r0mux.Handle("/profile/{userID}/avatar_url",
+		make("profile_avatar_url", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return readers.GetAvatarURL(req, vars["userID"], cfg, accountDB)
+		})),
+	).Methods("GET")
+
+	r0mux.Handle("/profile/{userID}/avatar_url",
+		make("profile_avatar_url", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+			vars := mux.Vars(req)
+			return writers.SetAvatarURL(req, vars["userID"], cfg, queryAPI, producer, accountDB, limits.profileUpdates)
+		})),
+	).Methods("PUT")
 
 	r0mux.Handle("/account/3pid",
 		make("account_3pid", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
@@ -140,8 +332,13 @@ func Setup(servMux *http.ServeMux, httpClient *http.Client, cfg config.ClientAPI
 		})),
 	)
 
+	// The keys are served whichever key ID is asked for, since the response lists them all.
+	keyMux.Handle("/server{keyID:(?:/.*)?}", make("local_keys", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return readers.LocalKeys(req, cfg)
+	}))).Methods("GET")
+
 	servMux.Handle("/metrics", prometheus.Handler())
-	servMux.Handle("/api/", http.StripPrefix("/api", apiMux))
+	servMux.Handle("/api/", http.StripPrefix("/api", httputil.TrustProxies(cfg.Listen.TrustedProxyNets, apiMux)))
 }
 
 // make a util.JSONRequestHandler into an http.Handler
@@ -0,0 +1,57 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/common/transactions"
+	"github.com/matrix-org/util"
+)
+
+// withTxnCache wraps the handler so that retries of a request from the same device with the same
+// path, which includes the "txnID" route variable, get the response to the original request.
+// Retries which arrive while the original request is being handled wait for its response.
+// The access token is verified before the cache is checked, so an invalid or revoked token never
+// gets a cached response.
+// This should wrap any rate limiting so that retries don't use up the client's requests.
+// Only successful responses are kept, so that clients can retry after an error.
+func withTxnCache(txnCache *transactions.Cache, accountDB *accounts.Database, h util.JSONRequestHandler) util.JSONRequestHandler {
+	return util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		txnID := mux.Vars(req)["txnID"]
+		if txnID == "" {
+			return h.OnIncomingRequest(req)
+		}
+		device, resErr := auth.VerifyAccessToken(req, accountDB)
+		if resErr != nil {
+			return *resErr
+		}
+		path := req.URL.Path
+		if res, ok := txnCache.ReserveTransaction(device.UserID, device.ID, txnID, path); ok {
+			return *res
+		}
+		// Release the reservation even if the handler panics, so that retries don't wait forever.
+		defer txnCache.ReleaseTransaction(device.UserID, device.ID, txnID, path)
+
+		res := h.OnIncomingRequest(req)
+		if res.Code == 200 {
+			txnCache.AddTransaction(device.UserID, device.ID, txnID, path, &res)
+		}
+		return res
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/util"
+)
+
+// SaveAccountData implements PUT /user/{userID}/account_data/{type} and
+// PUT /user/{userID}/rooms/{roomID}/account_data/{type}. roomID is empty for global account data.
+func SaveAccountData(
+	req *http.Request, userID, roomID, dataType string, accountDB *accounts.Database,
+	syncProducer *producers.SyncAPIProducer,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	if userID != device.UserID {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("Cannot set the account data of another user"),
+		}
+	}
+
+	if roomID != "" && dataType == "m.tag" {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("Room tags must be changed with the tags API"),
+		}
+	}
+
+	var content map[string]json.RawMessage
+	if resErr = httputil.UnmarshalJSONRequest(req, &content); resErr != nil {
+		return *resErr
+	}
+	if content == nil {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("Account data must be a JSON object"),
+		}
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	if err = accountDB.SaveAccountData(userID, roomID, dataType, string(contentJSON)); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if err = syncProducer.SendData(userID, roomID, dataType); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
@@ -23,25 +23,51 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/matrix-org/dendrite/clientapi/auth"
-	"github.com/matrix-org/dendrite/clientapi/config"
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
 	"github.com/matrix-org/dendrite/clientapi/events"
 	"github.com/matrix-org/dendrite/clientapi/httputil"
 	"github.com/matrix-org/dendrite/clientapi/jsonerror"
 	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/dendrite/common/config"
+	publicrooms "github.com/matrix-org/dendrite/publicroomsapi/api"
+	"github.com/matrix-org/dendrite/roomserver/api"
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/util"
 )
 
 // https://matrix.org/docs/spec/client_server/r0.2.0.html#post-matrix-client-r0-createroom
 type createRoomRequest struct {
-	Invite          []string               `json:"invite"`
-	Name            string                 `json:"name"`
-	Visibility      string                 `json:"visibility"`
-	Topic           string                 `json:"topic"`
-	Preset          string                 `json:"preset"`
-	CreationContent map[string]interface{} `json:"creation_content"`
-	InitialState    json.RawMessage        `json:"initial_state"` // TODO
-	RoomAliasName   string                 `json:"room_alias_name"`
+	Invite                    []string               `json:"invite"`
+	Name                      string                 `json:"name"`
+	Visibility                string                 `json:"visibility"`
+	Topic                     string                 `json:"topic"`
+	Preset                    string                 `json:"preset"`
+	CreationContent           map[string]interface{} `json:"creation_content"`
+	InitialState              []initialStateEvent    `json:"initial_state"`
+	RoomAliasName             string                 `json:"room_alias_name"`
+	IsDirect                  bool                   `json:"is_direct"`
+	PowerLevelContentOverride json.RawMessage        `json:"power_level_content_override"`
+}
+
+// initialStateEvent is a state event supplied by the client to be sent when the room is created.
+type initialStateEvent struct {
+	Type     string          `json:"type"`
+	StateKey string          `json:"state_key"`
+	Content  json.RawMessage `json:"content"`
+}
+
+const (
+	presetPrivateChat        = "private_chat"
+	presetTrustedPrivateChat = "trusted_private_chat"
+	presetPublicChat         = "public_chat"
+)
+
+// The state events which are created by /createRoom itself and can't be set in initial_state.
+var reservedInitialStateTypes = map[string]bool{
+	"m.room.create":       true,
+	"m.room.member":       true,
+	"m.room.power_levels": true,
 }
 
 func (r createRoomRequest) Validate() *util.JSONResponse {
@@ -74,6 +100,45 @@ func (r createRoomRequest) Validate() *util.JSONResponse {
 			}
 		}
 	}
+	switch r.Visibility {
+	case "", "public", "private":
+	default:
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("visibility must be either 'public' or 'private'"),
+		}
+	}
+	switch r.Preset {
+	case "", presetPrivateChat, presetTrustedPrivateChat, presetPublicChat:
+	default:
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("unknown preset " + r.Preset),
+		}
+	}
+	for _, e := range r.InitialState {
+		if e.Type == "" || len(e.Content) == 0 {
+			return &util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON("initial_state events must have a type and content"),
+			}
+		}
+		if reservedInitialStateTypes[e.Type] {
+			return &util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON(e.Type + " cannot be set in initial_state"),
+			}
+		}
+	}
+	if len(r.PowerLevelContentOverride) > 0 {
+		var override map[string]json.RawMessage
+		if err := json.Unmarshal(r.PowerLevelContentOverride, &override); err != nil {
+			return &util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON("power_level_content_override must be an object"),
+			}
+		}
+	}
 	return nil
 }
 
@@ -91,76 +156,101 @@ type fledglingEvent struct {
 }
 
 // CreateRoom implements /createRoom
-func CreateRoom(req *http.Request, cfg config.ClientAPI, producer *producers.RoomserverProducer) util.JSONResponse {
+func CreateRoom(
+	req *http.Request, cfg *config.Dendrite, producer *producers.RoomserverProducer,
+	aliasAPI api.RoomserverAliasAPI, publicRoomsAPI publicrooms.PublicRoomsAPI, accountDB *accounts.Database,
+) util.JSONResponse {
 	// TODO: Check room ID doesn't clash with an existing one, and we
 	//       probably shouldn't be using pseudo-random strings, maybe GUIDs?
-	roomID := fmt.Sprintf("!%s:%s", util.RandomString(16), cfg.ServerName)
-	return createRoom(req, cfg, roomID, producer)
+	roomID := fmt.Sprintf("!%s:%s", util.RandomString(16), cfg.Matrix.ServerName)
+	return createRoom(req, cfg, roomID, producer, aliasAPI, publicRoomsAPI, accountDB)
 }
 
 // createRoom implements /createRoom
-func createRoom(req *http.Request, cfg config.ClientAPI, roomID string, producer *producers.RoomserverProducer) util.JSONResponse {
+func createRoom(
+	req *http.Request, cfg *config.Dendrite, roomID string, producer *producers.RoomserverProducer,
+	aliasAPI api.RoomserverAliasAPI, publicRoomsAPI publicrooms.PublicRoomsAPI, accountDB *accounts.Database,
+) util.JSONResponse {
 	logger := util.GetLogger(req.Context())
-	userID, resErr := auth.VerifyAccessToken(req)
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
 	if resErr != nil {
 		return *resErr
 	}
+	userID := device.UserID
 	var r createRoomRequest
 	resErr = httputil.UnmarshalJSONRequest(req, &r)
 	if resErr != nil {
 		return *resErr
 	}
-	// TODO: apply rate-limit
-
 	if resErr = r.Validate(); resErr != nil {
 		return *resErr
 	}
 
-	// TODO: visibility/presets/raw initial state/creation content
+	profile, err := loadProfile(userID, cfg, accountDB)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	var roomAlias string
+	if r.RoomAliasName != "" {
+		roomAlias = fmt.Sprintf("#%s:%s", r.RoomAliasName, cfg.Matrix.ServerName)
+		// Claim the alias before creating the room so that we fail before sending any events
+		// if it is already taken.
+		aliasReq := api.SetRoomAliasRequest{UserID: userID, Alias: roomAlias, RoomID: roomID}
+		var aliasRes api.SetRoomAliasResponse
+		if err = aliasAPI.SetRoomAlias(&aliasReq, &aliasRes); err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if aliasRes.AliasExists {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.RoomInUse("Room alias already taken"),
+			}
+		}
+	}
+
+	res := createRoomEvents(req, cfg, userID, profile, roomID, roomAlias, r, producer)
+	if res.Code != 200 && roomAlias != "" {
+		// The room wasn't created, so release the alias.
+		removeReq := api.RemoveRoomAliasRequest{Alias: roomAlias}
+		var removeRes api.RemoveRoomAliasResponse
+		if err = aliasAPI.RemoveRoomAlias(&removeReq, &removeRes); err != nil {
+			logger.WithError(err).Error("Failed to remove alias of room which couldn't be created")
+		}
+	}
+	if res.Code == 200 && r.Visibility == "public" {
+		// The room has been created by now, so failing to publish it shouldn't fail the request.
+		if publicRoomsAPI == nil {
+			logger.WithField("roomID", roomID).Warn("Not publishing room as there is no public rooms server")
+		} else {
+			publishReq := publicrooms.PublishRoomRequest{RoomID: roomID}
+			var publishRes publicrooms.PublishRoomResponse
+			if err = publicRoomsAPI.PublishRoom(&publishReq, &publishRes); err != nil {
+				logger.WithError(err).Error("Failed to publish room in the room directory")
+			}
+		}
+	}
+	return res
+}
 
-	// TODO: Create room alias association
+// createRoomEvents builds and sends the events which create the room.
+func createRoomEvents(
+	req *http.Request, cfg *config.Dendrite, userID string, profile *authtypes.Profile,
+	roomID, roomAlias string, r createRoomRequest, producer *producers.RoomserverProducer,
+) util.JSONResponse {
+	logger := util.GetLogger(req.Context())
 
 	logger.WithFields(log.Fields{
 		"userID": userID,
 		"roomID": roomID,
 	}).Info("Creating new room")
 
-	var builtEvents []gomatrixserverlib.Event
-
-	// send events into the room in order of:
-	//  1- m.room.create
-	//  2- room creator join member
-	//  3- m.room.power_levels
-	//  4- m.room.canonical_alias (opt) TODO
-	//  5- m.room.join_rules
-	//  6- m.room.history_visibility
-	//  7- m.room.guest_access (opt) TODO
-	//  8- other initial state items TODO
-	//  9- m.room.name (opt)
-	//  10- m.room.topic (opt)
-	//  11- invite events (opt) - with is_direct flag if applicable TODO
-	//  12- 3pid invite events (opt) TODO
-	//  13- m.room.aliases event for HS (if alias specified) TODO
-	// This differs from Synapse slightly. Synapse would vary the ordering of 3-7
-	// depending on if those events were in "initial_state" or not. This made it
-	// harder to reason about, hence sticking to a strict static ordering.
-	// TODO: Synapse has txn/token ID on each event. Do we need to do this here?
-	eventsToMake := []fledglingEvent{
-		{"m.room.create", "", events.CreateContent{Creator: userID}},
-		{"m.room.member", userID, events.MemberContent{Membership: "join"}}, // TODO: Set avatar_url / displayname
-		{"m.room.power_levels", "", events.InitialPowerLevelsContent(userID)},
-		// TODO: m.room.canonical_alias
-		{"m.room.join_rules", "", events.JoinRulesContent{"public"}},                 // FIXME: Allow this to be changed
-		{"m.room.history_visibility", "", events.HistoryVisibilityContent{"joined"}}, // FIXME: Allow this to be changed
-		// TODO: m.room.guest_access
-		// TODO: Other initial state items
-		// TODO: m.room.name
-		// TODO: m.room.topic
-		// TODO: invite events
-		// TODO: 3pid invite events
-		// TODO m.room.aliases
+	eventsToMake, err := r.eventsToMake(userID, profile, roomAlias, cfg.Matrix.ServerName)
+	if err != nil {
+		return httputil.LogThenError(req, err)
 	}
 
+	var builtEvents []gomatrixserverlib.Event
 	authEvents := gomatrixserverlib.NewAuthEvents(nil)
 	for i, e := range eventsToMake {
 		depth := i + 1 // depth starts at 1
@@ -172,7 +262,9 @@ func createRoom(req *http.Request, cfg config.ClientAPI, roomID string, producer
 			StateKey: &e.StateKey,
 			Depth:    int64(depth),
 		}
-		builder.SetContent(e.Content)
+		if err = builder.SetContent(e.Content); err != nil {
+			return httputil.LogThenError(req, err)
+		}
 		if i > 0 {
 			builder.PrevEvents = []gomatrixserverlib.EventReference{builtEvents[i-1].EventReference()}
 		}
@@ -182,7 +274,11 @@ func createRoom(req *http.Request, cfg config.ClientAPI, roomID string, producer
 		}
 
 		if err := gomatrixserverlib.Allowed(*ev, &authEvents); err != nil {
-			return httputil.LogThenError(req, err)
+			// The initial state comes from the client, so it may not pass the auth checks.
+			return util.JSONResponse{
+				Code: 403,
+				JSON: jsonerror.Forbidden(fmt.Sprintf("Cannot send %s event: %s", e.Type, err)),
+			}
 		}
 
 		// Add the event to the list of auth events
@@ -197,14 +293,149 @@ func createRoom(req *http.Request, cfg config.ClientAPI, roomID string, producer
 
 	return util.JSONResponse{
 		Code: 200,
-		JSON: builtEvents,
+		JSON: createRoomResponse{
+			RoomID:    roomID,
+			RoomAlias: roomAlias,
+		},
+	}
+}
+
+// eventsToMake returns the events to send into a new room created by userID, in the order they
+// should be sent. Events in initial_state replace the join rules, history visibility and guest
+// access events which the preset would otherwise create.
+func (r createRoomRequest) eventsToMake(userID string, profile *authtypes.Profile, roomAlias, serverName string) ([]fledglingEvent, error) {
+	preset := r.Preset
+	if preset == "" {
+		if r.Visibility == "public" {
+			preset = presetPublicChat
+		} else {
+			preset = presetPrivateChat
+		}
+	}
+
+	joinRule := "invite"
+	guestAccess := "can_join"
+	if preset == presetPublicChat {
+		joinRule = "public"
+		guestAccess = ""
+	}
+
+	createContent := map[string]interface{}{}
+	for k, v := range r.CreationContent {
+		createContent[k] = v
+	}
+	createContent["creator"] = userID
+
+	powerLevels := events.InitialPowerLevelsContent(userID)
+	if preset == presetTrustedPrivateChat {
+		for _, invitee := range r.Invite {
+			powerLevels.Users[invitee] = powerLevels.Users[userID]
+		}
+	}
+	powerLevelsContent, err := overridePowerLevels(powerLevels, r.PowerLevelContentOverride)
+	if err != nil {
+		return nil, err
+	}
+
+	// The initial state events which replace the events the preset would create.
+	presetEvents := []fledglingEvent{
+		{"m.room.join_rules", "", events.JoinRulesContent{JoinRule: joinRule}},
+		{"m.room.history_visibility", "", events.HistoryVisibilityContent{HistoryVisibility: "shared"}},
+	}
+	if guestAccess != "" {
+		presetEvents = append(presetEvents, fledglingEvent{"m.room.guest_access", "", events.GuestAccessContent{GuestAccess: guestAccess}})
+	}
+	var otherInitialState []fledglingEvent
+	for _, e := range r.InitialState {
+		replaced := false
+		for i := range presetEvents {
+			if presetEvents[i].Type == e.Type && presetEvents[i].StateKey == e.StateKey {
+				presetEvents[i].Content = e.Content
+				replaced = true
+			}
+		}
+		if !replaced {
+			otherInitialState = append(otherInitialState, fledglingEvent{e.Type, e.StateKey, e.Content})
+		}
+	}
+
+	// send events into the room in order of:
+	//  1- m.room.create
+	//  2- room creator join member
+	//  3- m.room.power_levels
+	//  4- m.room.canonical_alias (opt)
+	//  5- m.room.join_rules
+	//  6- m.room.history_visibility
+	//  7- m.room.guest_access (opt)
+	//  8- other initial state items
+	//  9- m.room.name (opt)
+	//  10- m.room.topic (opt)
+	//  11- invite events (opt) - with is_direct flag if applicable
+	//  12- 3pid invite events (opt) TODO
+	//  13- m.room.aliases event for HS (if alias specified)
+	// This differs from Synapse slightly. Synapse would vary the ordering of 3-7
+	// depending on if those events were in "initial_state" or not. This made it
+	// harder to reason about, hence sticking to a strict static ordering.
+	// TODO: Synapse has txn/token ID on each event. Do we need to do this here?
+	eventsToMake := []fledglingEvent{
+		{"m.room.create", "", createContent},
+		{"m.room.member", userID, events.MemberContent{
+			Membership:  "join",
+			DisplayName: profile.DisplayName,
+			AvatarURL:   profile.AvatarURL,
+		}},
+		{"m.room.power_levels", "", powerLevelsContent},
+	}
+	if roomAlias != "" {
+		eventsToMake = append(eventsToMake, fledglingEvent{"m.room.canonical_alias", "", events.CanonicalAliasContent{Alias: roomAlias}})
+	}
+	eventsToMake = append(eventsToMake, presetEvents...)
+	eventsToMake = append(eventsToMake, otherInitialState...)
+	if r.Name != "" {
+		eventsToMake = append(eventsToMake, fledglingEvent{"m.room.name", "", events.NameContent{Name: r.Name}})
+	}
+	if r.Topic != "" {
+		eventsToMake = append(eventsToMake, fledglingEvent{"m.room.topic", "", events.TopicContent{Topic: r.Topic}})
+	}
+	for _, invitee := range r.Invite {
+		eventsToMake = append(eventsToMake, fledglingEvent{
+			"m.room.member", invitee, events.MemberContent{Membership: "invite", IsDirect: r.IsDirect},
+		})
+	}
+	// TODO: 3pid invite events
+	if roomAlias != "" {
+		eventsToMake = append(eventsToMake, fledglingEvent{"m.room.aliases", serverName, events.AliasesContent{Aliases: []string{roomAlias}}})
+	}
+	return eventsToMake, nil
+}
+
+// overridePowerLevels replaces the top-level keys of the power levels with the ones in the override.
+func overridePowerLevels(powerLevels events.PowerLevelContent, override json.RawMessage) (interface{}, error) {
+	if len(override) == 0 {
+		return powerLevels, nil
+	}
+	defaultJSON, err := json.Marshal(powerLevels)
+	if err != nil {
+		return nil, err
+	}
+	var content map[string]json.RawMessage
+	if err = json.Unmarshal(defaultJSON, &content); err != nil {
+		return nil, err
+	}
+	var overrideContent map[string]json.RawMessage
+	if err = json.Unmarshal(override, &overrideContent); err != nil {
+		return nil, err
+	}
+	for k, v := range overrideContent {
+		content[k] = v
 	}
+	return content, nil
 }
 
 // buildEvent fills out auth_events for the builder then builds the event
 func buildEvent(builder *gomatrixserverlib.EventBuilder,
 	provider gomatrixserverlib.AuthEventProvider,
-	cfg config.ClientAPI) (*gomatrixserverlib.Event, error) {
+	cfg *config.Dendrite) (*gomatrixserverlib.Event, error) {
 
 	eventsNeeded, err := gomatrixserverlib.StateNeededForEventBuilder(builder)
 	if err != nil {
@@ -215,9 +446,9 @@ func buildEvent(builder *gomatrixserverlib.EventBuilder,
 		return nil, err
 	}
 	builder.AuthEvents = refs
-	eventID := fmt.Sprintf("$%s:%s", util.RandomString(16), cfg.ServerName)
+	eventID := fmt.Sprintf("$%s:%s", util.RandomString(16), cfg.Matrix.ServerName)
 	now := time.Now()
-	event, err := builder.Build(eventID, now, cfg.ServerName, cfg.KeyID, cfg.PrivateKey)
+	event, err := builder.Build(eventID, now, cfg.Matrix.ServerName, cfg.Matrix.KeyID, cfg.Matrix.PrivateKey)
 	if err != nil {
 		return nil, fmt.Errorf("cannot build event %s : Builder failed to build. %s", builder.Type, err)
 	}
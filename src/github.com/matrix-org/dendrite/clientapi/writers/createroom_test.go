@@ -0,0 +1,122 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/events"
+)
+
+var alice = &authtypes.Profile{Localpart: "alice", DisplayName: "Alice", AvatarURL: "mxc://localhost/alice"}
+
+func eventTypes(evs []fledglingEvent) []string {
+	var types []string
+	for _, e := range evs {
+		types = append(types, e.Type+"/"+e.StateKey)
+	}
+	return types
+}
+
+func TestEventsToMakeOrdering(t *testing.T) {
+	r := createRoomRequest{
+		Name:   "Room",
+		Topic:  "Chat",
+		Invite: []string{"@bob:localhost"},
+		InitialState: []initialStateEvent{
+			{Type: "m.room.avatar", Content: json.RawMessage(`{"url":"mxc://localhost/a"}`)},
+		},
+	}
+	evs, err := r.eventsToMake("@alice:localhost", alice, "#room:localhost", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"m.room.create/",
+		"m.room.member/@alice:localhost",
+		"m.room.power_levels/",
+		"m.room.canonical_alias/",
+		"m.room.join_rules/",
+		"m.room.history_visibility/",
+		"m.room.guest_access/",
+		"m.room.avatar/",
+		"m.room.name/",
+		"m.room.topic/",
+		"m.room.member/@bob:localhost",
+		"m.room.aliases/localhost",
+	}
+	if got := eventTypes(evs); !reflect.DeepEqual(got, want) {
+		t.Errorf("want events %v, got %v", want, got)
+	}
+	if join := evs[1].Content.(events.MemberContent); join.DisplayName != "Alice" || join.AvatarURL != alice.AvatarURL {
+		t.Errorf("want creator's join to have their profile, got %+v", join)
+	}
+}
+
+func TestEventsToMakePresets(t *testing.T) {
+	r := createRoomRequest{Visibility: "public"}
+	evs, err := r.eventsToMake("@alice:localhost", alice, "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 5 {
+		t.Fatalf("want 5 events for a public room, got %v", eventTypes(evs))
+	}
+	if rule := evs[3].Content.(events.JoinRulesContent).JoinRule; rule != "public" {
+		t.Errorf("want join rule public, got %s", rule)
+	}
+
+	r = createRoomRequest{Preset: presetTrustedPrivateChat, Invite: []string{"@bob:localhost"}, IsDirect: true}
+	if evs, err = r.eventsToMake("@alice:localhost", alice, "", "localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if level := evs[2].Content.(events.PowerLevelContent).Users["@bob:localhost"]; level != 100 {
+		t.Errorf("want invitee power level 100, got %d", level)
+	}
+	if invite := evs[len(evs)-1].Content.(events.MemberContent); !invite.IsDirect {
+		t.Error("want invite to be marked as direct")
+	}
+}
+
+func TestEventsToMakeOverrides(t *testing.T) {
+	r := createRoomRequest{
+		Preset: presetPublicChat,
+		InitialState: []initialStateEvent{
+			{Type: "m.room.join_rules", Content: json.RawMessage(`{"join_rule":"invite"}`)},
+		},
+		PowerLevelContentOverride: json.RawMessage(`{"invite":50}`),
+	}
+	evs, err := r.eventsToMake("@alice:localhost", alice, "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := string(evs[3].Content.(json.RawMessage)); content != `{"join_rule":"invite"}` {
+		t.Errorf("want join rules from initial_state, got %s", content)
+	}
+	powerLevels, err := json.Marshal(evs[2].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var levels events.PowerLevelContent
+	if err = json.Unmarshal(powerLevels, &levels); err != nil {
+		t.Fatal(err)
+	}
+	if levels.Invite != 50 || levels.Kick != 50 || levels.Users["@alice:localhost"] != 100 {
+		t.Errorf("want overridden invite level and default levels otherwise, got %+v", levels)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/interactive"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/util"
+)
+
+// http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#put-matrix-client-unstable-devices-deviceid
+type updateDeviceRequest struct {
+	DisplayName *string `json:"display_name"`
+}
+
+// http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#delete-matrix-client-unstable-devices-deviceid
+type deleteDeviceRequest struct {
+	Auth json.RawMessage `json:"auth"`
+}
+
+// http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#post-matrix-client-unstable-delete-devices
+type deleteDevicesRequest struct {
+	Devices []string        `json:"devices"`
+	Auth    json.RawMessage `json:"auth"`
+}
+
+// UpdateDevice implements PUT /devices/{deviceID}
+func UpdateDevice(req *http.Request, deviceID string, accountDB *accounts.Database) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	var r updateDeviceRequest
+	if resErr = httputil.UnmarshalJSONRequest(req, &r); resErr != nil {
+		return *resErr
+	}
+
+	updated, err := accountDB.UpdateDeviceDisplayName(device.UserID, deviceID, r.DisplayName)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !updated {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Unknown device"),
+		}
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// DeleteDevice implements DELETE /devices/{deviceID}
+// The user must re-authenticate with the given user-interactive auth before the device is deleted.
+func DeleteDevice(
+	req *http.Request, deviceID string, accountDB *accounts.Database, userInteractive *interactive.UserInteractive,
+	logoutProducer *producers.LogoutProducer,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	// The body of a DELETE request is optional. Clients start the auth session without one.
+	var r deleteDeviceRequest
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &r); err != nil {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON("The request body could not be decoded into valid JSON. " + err.Error()),
+			}
+		}
+	}
+
+	if resErr = userInteractive.Verify(req, r.Auth, device.UserID); resErr != nil {
+		return *resErr
+	}
+
+	if err = accountDB.RemoveDevices(device.UserID, []string{deviceID}); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if err = logoutProducer.SendRevokedDevices(device.UserID, []string{deviceID}); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// DeleteDevices implements POST /delete_devices
+// The user must re-authenticate with the given user-interactive auth before the devices are deleted.
+func DeleteDevices(
+	req *http.Request, accountDB *accounts.Database, userInteractive *interactive.UserInteractive,
+	logoutProducer *producers.LogoutProducer,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	var r deleteDevicesRequest
+	if resErr = httputil.UnmarshalJSONRequest(req, &r); resErr != nil {
+		return *resErr
+	}
+	if r.Devices == nil {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.MissingParam("'devices' must be supplied."),
+		}
+	}
+
+	if resErr = userInteractive.Verify(req, r.Auth, device.UserID); resErr != nil {
+		return *resErr
+	}
+
+	if err := accountDB.RemoveDevices(device.UserID, r.Devices); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if err := logoutProducer.SendRevokedDevices(device.UserID, r.Devices); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
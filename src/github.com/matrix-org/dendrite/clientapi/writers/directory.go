@@ -0,0 +1,289 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#put-matrix-client-r0-directory-room-roomalias
+type setAliasRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+// SetLocalAlias implements PUT /directory/room/{roomAlias}. Only aliases on this server can be
+// created, and only by users who are joined to the room.
+func SetLocalAlias(
+	req *http.Request, alias string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	aliasAPI api.RoomserverAliasAPI, producer *producers.RoomserverProducer, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	if resErr = validateLocalAlias(alias, cfg.Matrix.ServerName); resErr != nil {
+		return *resErr
+	}
+	var r setAliasRequest
+	if resErr = httputil.UnmarshalJSONRequest(req, &r); resErr != nil {
+		return *resErr
+	}
+	if r.RoomID == "" {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("'room_id' must be supplied."),
+		}
+	}
+
+	queryReq := api.QueryLatestEventsAndStateRequest{
+		RoomID: r.RoomID,
+		StateToFetch: []gomatrixserverlib.StateKeyTuple{
+			{EventType: "m.room.member", StateKey: device.UserID},
+			{EventType: "m.room.canonical_alias", StateKey: ""},
+		},
+	}
+	var queryRes api.QueryLatestEventsAndStateResponse
+	if err := queryAPI.QueryLatestEventsAndState(&queryReq, &queryRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !queryRes.RoomExists {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room does not exist"),
+		}
+	}
+	membership, err := currentMembership(queryRes.StateEvents, device.UserID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if membership != "join" {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You must be in the room to create an alias for it"),
+		}
+	}
+
+	aliasReq := api.SetRoomAliasRequest{UserID: device.UserID, Alias: alias, RoomID: r.RoomID}
+	var aliasRes api.SetRoomAliasResponse
+	if err = aliasAPI.SetRoomAlias(&aliasReq, &aliasRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if aliasRes.AliasExists {
+		return util.JSONResponse{
+			Code: 409,
+			JSON: jsonerror.RoomInUse("The alias " + alias + " already exists."),
+		}
+	}
+
+	eventsToSend := []fledglingEvent{}
+	aliasesEvent, err := aliasesEventForRoom(r.RoomID, cfg.Matrix.ServerName, aliasAPI)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	eventsToSend = append(eventsToSend, aliasesEvent)
+	// Give the room a canonical alias if it doesn't already have one.
+	if !hasStateEvent(queryRes.StateEvents, "m.room.canonical_alias") {
+		eventsToSend = append(eventsToSend, fledglingEvent{"m.room.canonical_alias", "", events.CanonicalAliasContent{Alias: alias}})
+	}
+	sendAliasEvents(req, device.UserID, r.RoomID, eventsToSend, cfg, queryAPI, producer)
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// RemoveLocalAlias implements DELETE /directory/room/{roomAlias}. Aliases can be removed by the
+// user who created them, or by users who can change the m.room.aliases event of the room they
+// refer to.
+func RemoveLocalAlias(
+	req *http.Request, alias string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	aliasAPI api.RoomserverAliasAPI, producer *producers.RoomserverProducer, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	if resErr = validateLocalAlias(alias, cfg.Matrix.ServerName); resErr != nil {
+		return *resErr
+	}
+
+	aliasReq := api.GetAliasRoomIDRequest{Alias: alias}
+	var aliasRes api.GetAliasRoomIDResponse
+	if err := aliasAPI.GetAliasRoomID(&aliasReq, &aliasRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if aliasRes.RoomID == "" {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room alias " + alias + " not found."),
+		}
+	}
+
+	if aliasRes.CreatorID != device.UserID {
+		queryReq := api.QueryLatestEventsAndStateRequest{
+			RoomID: aliasRes.RoomID,
+			StateToFetch: []gomatrixserverlib.StateKeyTuple{
+				{EventType: "m.room.power_levels", StateKey: ""},
+			},
+		}
+		var queryRes api.QueryLatestEventsAndStateResponse
+		if err := queryAPI.QueryLatestEventsAndState(&queryReq, &queryRes); err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		allowed, err := canSendState(queryRes.StateEvents, device.UserID, "m.room.aliases")
+		if err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if !allowed {
+			return util.JSONResponse{
+				Code: 403,
+				JSON: jsonerror.Forbidden("You do not have permission to remove this alias."),
+			}
+		}
+	}
+
+	removeReq := api.RemoveRoomAliasRequest{Alias: alias}
+	var removeRes api.RemoveRoomAliasResponse
+	if err := aliasAPI.RemoveRoomAlias(&removeReq, &removeRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	aliasesEvent, err := aliasesEventForRoom(aliasRes.RoomID, cfg.Matrix.ServerName, aliasAPI)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	sendAliasEvents(req, device.UserID, aliasRes.RoomID, []fledglingEvent{aliasesEvent}, cfg, queryAPI, producer)
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// validateLocalAlias checks that the alias is well formed and belongs to this server.
+func validateLocalAlias(alias, serverName string) *util.JSONResponse {
+	parts := strings.SplitN(strings.TrimPrefix(alias, "#"), ":", 2)
+	if !strings.HasPrefix(alias, "#") || len(parts) != 2 || parts[0] == "" {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("Room alias must be in the form '#localpart:domain'"),
+		}
+	}
+	if parts[1] != serverName {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("Room alias must be on this server"),
+		}
+	}
+	return nil
+}
+
+// aliasesEventForRoom returns the m.room.aliases event listing this server's aliases for the room.
+func aliasesEventForRoom(roomID, serverName string, aliasAPI api.RoomserverAliasAPI) (fledglingEvent, error) {
+	queryReq := api.GetAliasesForRoomIDRequest{RoomID: roomID}
+	var queryRes api.GetAliasesForRoomIDResponse
+	if err := aliasAPI.GetAliasesForRoomID(&queryReq, &queryRes); err != nil {
+		return fledglingEvent{}, err
+	}
+	aliases := queryRes.Aliases
+	if aliases == nil {
+		aliases = []string{}
+	}
+	return fledglingEvent{"m.room.aliases", serverName, events.AliasesContent{Aliases: aliases}}, nil
+}
+
+// sendAliasEvents sends the state events which reflect a change to the room's aliases. The alias
+// has already been changed, so failures are logged rather than returned to the client.
+func sendAliasEvents(
+	req *http.Request, userID, roomID string, eventsToSend []fledglingEvent, cfg *config.Dendrite,
+	queryAPI api.RoomserverQueryAPI, producer *producers.RoomserverProducer,
+) {
+	logger := util.GetLogger(req.Context())
+	for _, e := range eventsToSend {
+		stateKey := e.StateKey
+		builder := gomatrixserverlib.EventBuilder{
+			Sender:   userID,
+			RoomID:   roomID,
+			Type:     e.Type,
+			StateKey: &stateKey,
+		}
+		if err := builder.SetContent(e.Content); err != nil {
+			logger.WithError(err).Error("Failed to set alias event content")
+			continue
+		}
+		ev, err := events.BuildEvent(&builder, cfg, queryAPI, nil)
+		if err == nil {
+			err = producer.SendEvents([]gomatrixserverlib.Event{*ev})
+		}
+		if err != nil {
+			logger.WithError(err).WithFields(log.Fields{
+				"room_id": roomID,
+				"type":    e.Type,
+			}).Warn("Failed to send alias event")
+		}
+	}
+}
+
+// hasStateEvent returns true if there is a state event of the given type in the state.
+func hasStateEvent(stateEvents []gomatrixserverlib.Event, eventType string) bool {
+	for _, ev := range stateEvents {
+		if ev.Type() == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// canSendState returns true if the user's power level in the room is high enough to send state
+// events of the given type. stateEvents must include the room's m.room.power_levels event, if it
+// has one.
+func canSendState(stateEvents []gomatrixserverlib.Event, userID, eventType string) (bool, error) {
+	for _, ev := range stateEvents {
+		if ev.Type() != "m.room.power_levels" {
+			continue
+		}
+		var content events.PowerLevelContent
+		if err := json.Unmarshal(ev.Content(), &content); err != nil {
+			return false, err
+		}
+		level, ok := content.Users[userID]
+		if !ok {
+			level = content.UsersDefault
+		}
+		required, ok := content.Events[eventType]
+		if !ok {
+			required = content.StateDefault
+		}
+		return level >= required, nil
+	}
+	// Anyone can send state events in rooms without power levels.
+	// http://matrix.org/docs/spec/client_server/r0.2.0.html#m-room-power-levels
+	return true, nil
+}
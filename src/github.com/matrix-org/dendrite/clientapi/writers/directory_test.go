@@ -0,0 +1,83 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"testing"
+
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+func TestValidateLocalAlias(t *testing.T) {
+	tests := []struct {
+		alias string
+		valid bool
+	}{
+		{"#room:localhost", true},
+		{"#room:example.com", false},
+		{"room:localhost", false},
+		{"#:localhost", false},
+		{"#room", false},
+	}
+	for _, tc := range tests {
+		res := validateLocalAlias(tc.alias, "localhost")
+		if tc.valid && res != nil {
+			t.Errorf("want %q to be valid, got %+v", tc.alias, res.JSON)
+		}
+		if !tc.valid && (res == nil || res.Code != 400) {
+			t.Errorf("want %q to be rejected with a 400, got %+v", tc.alias, res)
+		}
+	}
+}
+
+func TestCanSendState(t *testing.T) {
+	powerLevels, err := gomatrixserverlib.NewEventFromTrustedJSON([]byte(`{
+		"type": "m.room.power_levels",
+		"state_key": "",
+		"room_id": "!room:localhost",
+		"event_id": "$powerlevels:localhost",
+		"sender": "@alice:localhost",
+		"content": {
+			"users": {"@alice:localhost": 100, "@bob:localhost": 50},
+			"users_default": 0,
+			"state_default": 50,
+			"events": {"m.room.aliases": 75}
+		}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		stateEvents []gomatrixserverlib.Event
+		userID      string
+		eventType   string
+		want        bool
+	}{
+		{[]gomatrixserverlib.Event{powerLevels}, "@alice:localhost", "m.room.aliases", true},
+		{[]gomatrixserverlib.Event{powerLevels}, "@bob:localhost", "m.room.aliases", false},
+		{[]gomatrixserverlib.Event{powerLevels}, "@bob:localhost", "m.room.topic", true},
+		{[]gomatrixserverlib.Event{powerLevels}, "@charlie:localhost", "m.room.topic", false},
+		{nil, "@charlie:localhost", "m.room.aliases", true},
+	}
+	for _, tt := range tests {
+		got, err := canSendState(tt.stateEvents, tt.userID, tt.eventType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("canSendState(%s, %s): want %v, got %v", tt.userID, tt.eventType, tt.want, got)
+		}
+	}
+}
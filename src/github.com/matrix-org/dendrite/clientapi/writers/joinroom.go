@@ -0,0 +1,116 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#post-matrix-client-r0-join-roomidoralias
+type joinRoomResponse struct {
+	RoomID string `json:"room_id"`
+}
+
+// JoinRoomByIDOrAlias implements /join/{roomIDOrAlias} and /rooms/{roomID}/join.
+// Only rooms which the server is already participating in can be joined.
+func JoinRoomByIDOrAlias(
+	req *http.Request, roomIDOrAlias string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	aliasAPI api.RoomserverAliasAPI, producer *producers.RoomserverProducer, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	var roomID string
+	switch {
+	case strings.HasPrefix(roomIDOrAlias, "!"):
+		roomID = roomIDOrAlias
+	case strings.HasPrefix(roomIDOrAlias, "#"):
+		aliasReq := api.GetAliasRoomIDRequest{Alias: roomIDOrAlias}
+		var aliasRes api.GetAliasRoomIDResponse
+		if err := aliasAPI.GetAliasRoomID(&aliasReq, &aliasRes); err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if aliasRes.RoomID == "" {
+			// TODO: Ask the server in the alias for the room ID over federation.
+			return util.JSONResponse{
+				Code: 404,
+				JSON: jsonerror.NotFound("Room alias " + roomIDOrAlias + " not found"),
+			}
+		}
+		roomID = aliasRes.RoomID
+	default:
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("Invalid first character '" + roomIDOrAlias[:1] + "' for room ID or alias"),
+		}
+	}
+
+	profile, err := loadProfile(device.UserID, cfg, accountDB)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	// TODO: Support third_party_signed in the request body.
+	builder := gomatrixserverlib.EventBuilder{
+		Sender:   device.UserID,
+		RoomID:   roomID,
+		Type:     "m.room.member",
+		StateKey: &device.UserID,
+	}
+	builder.SetContent(events.MemberContent{
+		Membership:  "join",
+		DisplayName: profile.DisplayName,
+		AvatarURL:   profile.AvatarURL,
+	})
+
+	e, err := events.BuildEvent(&builder, cfg, queryAPI, nil)
+	if err == events.ErrRoomNoExists {
+		// TODO: Join rooms on other servers over federation.
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room does not exist"),
+		}
+	} else if _, ok := err.(*gomatrixserverlib.NotAllowed); ok {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden(err.Error()),
+		}
+	} else if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	if err := producer.SendEvents([]gomatrixserverlib.Event{*e}); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: joinRoomResponse{roomID},
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// LeaveRoom implements /rooms/{roomID}/leave
+func LeaveRoom(
+	req *http.Request, roomID string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	producer *producers.RoomserverProducer, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	builder := gomatrixserverlib.EventBuilder{
+		Sender:   device.UserID,
+		RoomID:   roomID,
+		Type:     "m.room.member",
+		StateKey: &device.UserID,
+	}
+	builder.SetContent(events.MemberContent{Membership: "leave"})
+
+	e, err := events.BuildEvent(&builder, cfg, queryAPI, nil)
+	if err == events.ErrRoomNoExists {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room does not exist"),
+		}
+	} else if _, ok := err.(*gomatrixserverlib.NotAllowed); ok {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden(err.Error()),
+		}
+	} else if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	if err := producer.SendEvents([]gomatrixserverlib.Event{*e}); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// ForgetRoom implements /rooms/{roomID}/forget. The user must have left the room, or have
+// been banned from it, before they can forget it.
+func ForgetRoom(
+	req *http.Request, roomID string, queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	queryReq := api.QueryLatestEventsAndStateRequest{
+		RoomID: roomID,
+		StateToFetch: []gomatrixserverlib.StateKeyTuple{
+			{EventType: "m.room.member", StateKey: device.UserID},
+		},
+	}
+	var queryRes api.QueryLatestEventsAndStateResponse
+	if err := queryAPI.QueryLatestEventsAndState(&queryReq, &queryRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !queryRes.RoomExists || len(queryRes.StateEvents) == 0 {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("You have never been a member of this room"),
+		}
+	}
+
+	membershipEvent := queryRes.StateEvents[0]
+	var content events.MemberContent
+	if err := json.Unmarshal(membershipEvent.Content(), &content); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if content.Membership != "leave" && content.Membership != "ban" {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.Unknown("You must leave the room before forgetting it"),
+		}
+	}
+
+	if err := accountDB.ForgetRoom(device.UserID, roomID, membershipEvent.EventID()); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
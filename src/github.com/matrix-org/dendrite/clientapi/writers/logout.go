@@ -0,0 +1,69 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/util"
+)
+
+// Logout implements POST /logout
+// The device which made the request is deleted, which revokes its access token.
+func Logout(req *http.Request, accountDB *accounts.Database, logoutProducer *producers.LogoutProducer) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	deviceIDs := []string{device.ID}
+	if err := accountDB.RemoveDevices(device.UserID, deviceIDs); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if err := logoutProducer.SendRevokedDevices(device.UserID, deviceIDs); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// LogoutAll implements POST /logout/all
+// All of the user's devices are deleted, which revokes all of their access tokens.
+func LogoutAll(req *http.Request, accountDB *accounts.Database, logoutProducer *producers.LogoutProducer) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	deviceIDs, err := accountDB.RemoveAllDevices(device.UserID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if err = logoutProducer.SendRevokedDevices(device.UserID, deviceIDs); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
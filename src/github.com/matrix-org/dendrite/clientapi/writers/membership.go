@@ -0,0 +1,155 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#post-matrix-client-r0-rooms-roomid-kick
+type membershipRequest struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// The membership the target of each action ends up with.
+var membershipForAction = map[string]string{
+	"invite": "invite",
+	"kick":   "leave",
+	"ban":    "ban",
+	"unban":  "leave",
+}
+
+// The memberships the target must currently have for each action which needs one. The auth checks
+// let a user with enough power send a leave event for any target, so without this a kick could
+// unban a banned user, and an unban of someone who isn't banned would really be a kick.
+var targetMembershipsForAction = map[string][]string{
+	"kick":  {"join", "invite"},
+	"unban": {"ban"},
+}
+
+// SendMembership implements /rooms/{roomID}/{action} for the invite, kick, ban and unban actions.
+// The gomatrixserverlib auth checks enforce the power levels of the room, so senders with too low
+// a level get a 403.
+func SendMembership(
+	req *http.Request, roomID, action string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	producer *producers.RoomserverProducer, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	membership, ok := membershipForAction[action]
+	if !ok {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Unknown membership action " + action),
+		}
+	}
+	var r membershipRequest
+	if resErr = httputil.UnmarshalJSONRequest(req, &r); resErr != nil {
+		return *resErr
+	}
+	if r.UserID == "" {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("'user_id' must be supplied."),
+		}
+	}
+
+	builder := gomatrixserverlib.EventBuilder{
+		Sender:   device.UserID,
+		RoomID:   roomID,
+		Type:     "m.room.member",
+		StateKey: &r.UserID,
+	}
+	builder.SetContent(events.MemberContent{Membership: membership, Reason: r.Reason})
+
+	var queryRes api.QueryLatestEventsAndStateResponse
+	e, err := events.BuildEvent(&builder, cfg, queryAPI, &queryRes)
+	if err == events.ErrRoomNoExists {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room does not exist"),
+		}
+	} else if _, ok := err.(*gomatrixserverlib.NotAllowed); ok {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden(err.Error()),
+		}
+	} else if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	if allowed, ok := targetMembershipsForAction[action]; ok {
+		targetMembership, err := currentMembership(queryRes.StateEvents, r.UserID)
+		if err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if !containsString(allowed, targetMembership) {
+			return util.JSONResponse{
+				Code: 403,
+				JSON: jsonerror.Forbidden(fmt.Sprintf("Can't %s a user whose membership is %q", action, targetMembership)),
+			}
+		}
+	}
+
+	if err := producer.SendEvents([]gomatrixserverlib.Event{*e}); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// currentMembership returns the membership of the user in the given state events, or an empty
+// string if the state doesn't contain an m.room.member event for the user.
+func currentMembership(stateEvents []gomatrixserverlib.Event, userID string) (string, error) {
+	for _, ev := range stateEvents {
+		if ev.Type() != "m.room.member" || ev.StateKey() == nil || *ev.StateKey() != userID {
+			continue
+		}
+		var content events.MemberContent
+		if err := json.Unmarshal(ev.Content(), &content); err != nil {
+			return "", err
+		}
+		return content.Membership, nil
+	}
+	return "", nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/dendrite/clientapi/ratelimit"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#put-matrix-client-r0-profile-userid-displayname
+type displayNameRequest struct {
+	DisplayName string `json:"displayname"`
+}
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#put-matrix-client-r0-profile-userid-avatar-url
+type avatarURLRequest struct {
+	AvatarURL string `json:"avatar_url"`
+}
+
+// SetDisplayName implements PUT /profile/{userID}/displayname
+func SetDisplayName(
+	req *http.Request, userID string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	producer *producers.RoomserverProducer, accountDB *accounts.Database, limiter *ratelimit.Limiter,
+) util.JSONResponse {
+	var r displayNameRequest
+	return setProfileField(req, userID, &r, func(localpart string) error {
+		return accountDB.SetDisplayName(localpart, r.DisplayName)
+	}, cfg, queryAPI, producer, accountDB, limiter)
+}
+
+// SetAvatarURL implements PUT /profile/{userID}/avatar_url
+func SetAvatarURL(
+	req *http.Request, userID string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	producer *producers.RoomserverProducer, accountDB *accounts.Database, limiter *ratelimit.Limiter,
+) util.JSONResponse {
+	var r avatarURLRequest
+	return setProfileField(req, userID, &r, func(localpart string) error {
+		return accountDB.SetAvatarURL(localpart, r.AvatarURL)
+	}, cfg, queryAPI, producer, accountDB, limiter)
+}
+
+// setProfileField parses the request body into r and calls store to save the new value in the
+// profile of the requesting user. It then sends the updated profile into the user's rooms in the
+// background, since a user in many rooms could take a long time to update.
+func setProfileField(
+	req *http.Request, userID string, r interface{}, store func(localpart string) error,
+	cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI, producer *producers.RoomserverProducer,
+	accountDB *accounts.Database, limiter *ratelimit.Limiter,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	if userID != device.UserID {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("Cannot set the profile of another user"),
+		}
+	}
+	if resErr = httputil.UnmarshalJSONRequest(req, r); resErr != nil {
+		return *resErr
+	}
+
+	localpart, err := auth.LocalpartFromUserID(userID, cfg.Matrix.ServerName)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if err = store(localpart); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	logger := util.GetLogger(req.Context()).WithField("userID", userID)
+	go sendProfileUpdates(logger, userID, localpart, cfg, queryAPI, producer, accountDB, limiter)
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// sendProfileUpdates sends an m.room.member event with the current profile of the user into
+// every room they are joined to. The events are throttled by the limiter so that users who are
+// in a large number of rooms don't flood the roomserver.
+func sendProfileUpdates(
+	logger *log.Entry, userID, localpart string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI,
+	producer *producers.RoomserverProducer, accountDB *accounts.Database, limiter *ratelimit.Limiter,
+) {
+	roomIDs, err := accountDB.GetRoomIDsByLocalpart(localpart)
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up joined rooms to send profile update")
+		return
+	}
+
+	for _, roomID := range roomIDs {
+		for {
+			ok, wait := limiter.Allow(userID)
+			if ok {
+				break
+			}
+			time.Sleep(wait)
+		}
+		// Load the profile for every room so that a later change which finished first
+		// isn't overwritten by this one.
+		profile, err := accountDB.GetProfileByLocalpart(localpart)
+		if err != nil {
+			logger.WithError(err).Error("Failed to load profile to send profile update")
+			return
+		}
+		if err = sendProfileUpdate(userID, roomID, profile, cfg, queryAPI, producer); err != nil {
+			logger.WithError(err).WithField("roomID", roomID).Error("Failed to send profile update")
+		}
+	}
+}
+
+// sendProfileUpdate sends an m.room.member event with the given profile into the room, keeping
+// the rest of the user's current membership. Nothing is sent if the user isn't joined to the room.
+func sendProfileUpdate(
+	userID, roomID string, profile *authtypes.Profile, cfg *config.Dendrite,
+	queryAPI api.RoomserverQueryAPI, producer *producers.RoomserverProducer,
+) error {
+	queryReq := api.QueryLatestEventsAndStateRequest{
+		RoomID:       roomID,
+		StateToFetch: []gomatrixserverlib.StateKeyTuple{{EventType: "m.room.member", StateKey: userID}},
+	}
+	var queryRes api.QueryLatestEventsAndStateResponse
+	if err := queryAPI.QueryLatestEventsAndState(&queryReq, &queryRes); err != nil {
+		return err
+	}
+	if !queryRes.RoomExists || len(queryRes.StateEvents) == 0 {
+		return nil
+	}
+	var content events.MemberContent
+	if err := json.Unmarshal(queryRes.StateEvents[0].Content(), &content); err != nil {
+		return err
+	}
+	if content.Membership != "join" {
+		return nil
+	}
+	if content.DisplayName == profile.DisplayName && content.AvatarURL == profile.AvatarURL {
+		return nil
+	}
+	content.DisplayName = profile.DisplayName
+	content.AvatarURL = profile.AvatarURL
+
+	builder := gomatrixserverlib.EventBuilder{
+		Sender:   userID,
+		RoomID:   roomID,
+		Type:     "m.room.member",
+		StateKey: &userID,
+	}
+	if err := builder.SetContent(content); err != nil {
+		return err
+	}
+	e, err := events.BuildEvent(&builder, cfg, queryAPI, nil)
+	if err != nil {
+		return err
+	}
+	return producer.SendEvents([]gomatrixserverlib.Event{*e})
+}
+
+// loadProfile returns the profile of the local user with the given user ID.
+func loadProfile(userID string, cfg *config.Dendrite, accountDB *accounts.Database) (*authtypes.Profile, error) {
+	localpart, err := auth.LocalpartFromUserID(userID, cfg.Matrix.ServerName)
+	if err != nil {
+		return nil, err
+	}
+	return accountDB.GetProfileByLocalpart(localpart)
+}
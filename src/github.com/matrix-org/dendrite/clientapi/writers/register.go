@@ -0,0 +1,269 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/authtypes"
+	"github.com/matrix-org/dendrite/clientapi/auth/interactive"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/util"
+)
+
+const (
+	minPasswordLength = 8   // http://matrix.org/docs/spec/client_server/r0.2.0.html#password-based
+	maxPasswordLength = 512 // https://github.com/matrix-org/synapse/blob/v0.20.0/synapse/rest/client/v2_alpha/register.py#L161
+	maxUsernameLength = 254 // http://matrix.org/speculator/spec/HEAD/intro.html#user-identifiers TODO account for domain
+)
+
+// The characters which are allowed in the localpart of a user ID.
+// http://matrix.org/speculator/spec/HEAD/appendices.html#user-identifiers
+var validUsernameRegex = regexp.MustCompile(`^[0-9a-z_\-./=]+$`)
+
+// registerRequest represents the submitted registration request.
+// It can be broken down into 2 sections: the auth dictionary and registration parameters.
+// The registration parameters must be supplied with every request in the session.
+type registerRequest struct {
+	// registration parameters
+	Username           string  `json:"username"`
+	Password           string  `json:"password"`
+	DeviceID           string  `json:"device_id"`
+	InitialDisplayName *string `json:"initial_device_display_name"`
+	InhibitLogin       bool    `json:"inhibit_login"`
+	// user-interactive auth params
+	Auth json.RawMessage `json:"auth"`
+}
+
+// registrationPasswordAuthDict is the auth dictionary of the m.login.password registration stage.
+type registrationPasswordAuthDict struct {
+	Type     authtypes.LoginType `json:"type"`
+	Password string              `json:"password"`
+}
+
+// registrationPasswordStage implements m.login.password for registration. Unlike the
+// interactive.PasswordStage there is no account yet, so the stage only confirms the
+// password chosen in the registration parameters.
+type registrationPasswordStage struct{}
+
+func (registrationPasswordStage) Type() authtypes.LoginType { return authtypes.LoginTypePassword }
+
+func (registrationPasswordStage) Params() interface{} { return nil }
+
+func (registrationPasswordStage) Validate(req *http.Request, rawAuthDict json.RawMessage, userID string) *jsonerror.MatrixError {
+	var dict registrationPasswordAuthDict
+	if err := json.Unmarshal(rawAuthDict, &dict); err != nil {
+		return jsonerror.BadJSON("The 'auth' dictionary could not be parsed: " + err.Error())
+	}
+	if dict.Password == "" {
+		return jsonerror.MissingParam("'password' must be supplied.")
+	}
+	return nil
+}
+
+// http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#post-matrix-client-unstable-register
+type registerResponse struct {
+	UserID      string `json:"user_id"`
+	AccessToken string `json:"access_token,omitempty"`
+	HomeServer  string `json:"home_server"`
+	DeviceID    string `json:"device_id,omitempty"`
+}
+
+// registrationAuth holds the user-interactive auth sessions for /register.
+// TODO: Server admins should be able to change the registration flows.
+var registrationAuth = interactive.New(
+	interactive.DefaultSessionTimeout,
+	[]interactive.Stage{interactive.DummyStage{}},
+	[]interactive.Stage{registrationPasswordStage{}},
+)
+
+// Validate returns an error response if the request fails to validate.
+func (r *registerRequest) Validate() *util.JSONResponse {
+	if resErr := validateLocalpart(r.Username); resErr != nil {
+		return resErr
+	}
+	// Check length of password
+	if len(r.Password) > maxPasswordLength {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON(fmt.Sprintf("'password' >%d characters", maxPasswordLength)),
+		}
+	} else if r.Password != "" && len(r.Password) < minPasswordLength {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.WeakPassword(fmt.Sprintf("password too weak: min %d chars", minPasswordLength)),
+		}
+	}
+	return nil
+}
+
+// validateLocalpart returns an error response if the given localpart can't be used in a user ID.
+func validateLocalpart(localpart string) *util.JSONResponse {
+	if localpart == "" {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.InvalidUsername("'username' must be supplied."),
+		}
+	}
+	if len(localpart) > maxUsernameLength {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.InvalidUsername(fmt.Sprintf("'username' >%d characters", maxUsernameLength)),
+		}
+	}
+	// This rejects whitespace and ':', which would break parsers splitting the user ID into 2 segments.
+	if !validUsernameRegex.MatchString(localpart) {
+		return &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.InvalidUsername("User ID can only contain characters a-z, 0-9, or '_-./='"),
+		}
+	}
+	return nil
+}
+
+// Register processes a /register request. http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#post-matrix-client-unstable-register
+func Register(req *http.Request, accountDB *accounts.Database, cfg *config.Dendrite) util.JSONResponse {
+	var r registerRequest
+	resErr := httputil.UnmarshalJSONRequest(req, &r)
+	if resErr != nil {
+		return *resErr
+	}
+
+	// A password supplied in the m.login.password stage must match the registration parameters.
+	if len(r.Auth) > 0 {
+		var dict registrationPasswordAuthDict
+		if err := json.Unmarshal(r.Auth, &dict); err == nil && dict.Type == authtypes.LoginTypePassword {
+			if r.Password == "" {
+				r.Password = dict.Password
+			}
+			if dict.Password != r.Password {
+				return util.JSONResponse{
+					Code: 400,
+					JSON: jsonerror.BadJSON("'auth.password' does not match 'password'"),
+				}
+			}
+		}
+	}
+
+	// Authenticate first, so that clients can discover the flows by sending an empty request.
+	if resErr = registrationAuth.Verify(req, r.Auth, ""); resErr != nil {
+		return *resErr
+	}
+
+	if resErr = r.Validate(); resErr != nil {
+		return *resErr
+	}
+
+	acc, err := accountDB.GetAccountByLocalpart(r.Username)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if acc != nil {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.UserInUse("Desired user ID is already taken."),
+		}
+	}
+
+	util.GetLogger(req.Context()).WithField("username", r.Username).Info("Registering account")
+
+	return completeRegistration(req, accountDB, cfg, r)
+}
+
+// completeRegistration creates the account and, unless inhibit_login was set, logs the new user in.
+func completeRegistration(req *http.Request, accountDB *accounts.Database, cfg *config.Dendrite, r registerRequest) util.JSONResponse {
+	acc, err := accountDB.CreateAccount(r.Username, r.Password)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if acc == nil {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.UserInUse("Desired user ID is already taken."),
+		}
+	}
+
+	userID := makeUserID(acc.Localpart, cfg.Matrix.ServerName)
+	if r.InhibitLogin {
+		return util.JSONResponse{
+			Code: 200,
+			JSON: registerResponse{
+				UserID:     userID,
+				HomeServer: cfg.Matrix.ServerName,
+			},
+		}
+	}
+
+	deviceID := r.DeviceID
+	if deviceID == "" {
+		deviceID = auth.GenerateDeviceID()
+	}
+	token, err := auth.GenerateAccessToken()
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if err = accountDB.CreateDevice(userID, deviceID, r.InitialDisplayName, token, auth.RemoteIP(req)); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: registerResponse{
+			UserID:      userID,
+			AccessToken: token,
+			HomeServer:  cfg.Matrix.ServerName,
+			DeviceID:    deviceID,
+		},
+	}
+}
+
+// RegisterAvailable checks if the username is valid and available.
+// http://matrix.org/speculator/spec/HEAD/client_server/unstable.html#get-matrix-client-unstable-register-available
+func RegisterAvailable(req *http.Request, accountDB *accounts.Database) util.JSONResponse {
+	username := req.URL.Query().Get("username")
+
+	if resErr := validateLocalpart(username); resErr != nil {
+		return *resErr
+	}
+
+	acc, err := accountDB.GetAccountByLocalpart(username)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if acc != nil {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.UserInUse("Desired user ID is already taken."),
+		}
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct {
+			Available bool `json:"available"`
+		}{true},
+	}
+}
+
+func makeUserID(localpart, domain string) string {
+	return fmt.Sprintf("@%s:%s", localpart, domain)
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/interactive"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+)
+
+func TestValidateLocalpart(t *testing.T) {
+	tests := []struct {
+		localpart string
+		errcode   string
+	}{
+		{"alice", ""},
+		{"alice.bob-2_=/", ""},
+		{"", "M_INVALID_USERNAME"},
+		{"Alice", "M_INVALID_USERNAME"},
+		{"alice bob", "M_INVALID_USERNAME"},
+		{"alice:localhost", "M_INVALID_USERNAME"},
+		{"@alice", "M_INVALID_USERNAME"},
+		{strings.Repeat("a", maxUsernameLength+1), "M_INVALID_USERNAME"},
+	}
+	for _, tc := range tests {
+		res := validateLocalpart(tc.localpart)
+		if tc.errcode == "" {
+			if res != nil {
+				t.Errorf("validateLocalpart(%q): want no error, got %v", tc.localpart, res.JSON)
+			}
+			continue
+		}
+		if res == nil {
+			t.Errorf("validateLocalpart(%q): want %s, got no error", tc.localpart, tc.errcode)
+			continue
+		}
+		if e, ok := res.JSON.(*jsonerror.MatrixError); !ok || e.ErrCode != tc.errcode {
+			t.Errorf("validateLocalpart(%q): want %s, got %v", tc.localpart, tc.errcode, res.JSON)
+		}
+	}
+}
+
+func TestRegisterWithoutAuthReturnsFlows(t *testing.T) {
+	req := httptest.NewRequest("POST", "/_matrix/client/r0/register", strings.NewReader("{}"))
+	// The flows are returned before the request is validated or the database is used.
+	res := Register(req, nil, nil)
+	if res.Code != 401 {
+		t.Fatalf("want 401, got %d: %v", res.Code, res.JSON)
+	}
+	body, ok := res.JSON.(interactive.Response)
+	if !ok || len(body.Flows) == 0 || body.Session == "" {
+		t.Errorf("want the flows and a session, got %v", res.JSON)
+	}
+}
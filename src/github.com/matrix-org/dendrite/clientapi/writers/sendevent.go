@@ -17,14 +17,13 @@ package writers
 import (
 	"net/http"
 
-	"fmt"
-	"time"
-
 	"github.com/matrix-org/dendrite/clientapi/auth"
-	"github.com/matrix-org/dendrite/clientapi/config"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
 	"github.com/matrix-org/dendrite/clientapi/httputil"
 	"github.com/matrix-org/dendrite/clientapi/jsonerror"
 	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/dendrite/common/config"
 	"github.com/matrix-org/dendrite/roomserver/api"
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/util"
@@ -39,12 +38,13 @@ type sendEventResponse struct {
 // SendEvent implements:
 //   /rooms/{roomID}/send/{eventType}/{txnID}
 //   /rooms/{roomID}/state/{eventType}/{stateKey}
-func SendEvent(req *http.Request, roomID, eventType, txnID string, stateKey *string, cfg config.ClientAPI, queryAPI api.RoomserverQueryAPI, producer *producers.RoomserverProducer) util.JSONResponse {
+func SendEvent(req *http.Request, roomID, eventType string, stateKey *string, cfg *config.Dendrite, queryAPI api.RoomserverQueryAPI, producer *producers.RoomserverProducer, accountDB *accounts.Database) util.JSONResponse {
 	// parse the incoming http request
-	userID, resErr := auth.VerifyAccessToken(req)
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
 	if resErr != nil {
 		return *resErr
 	}
+	userID := device.UserID
 	var r map[string]interface{} // must be a JSON object
 	resErr = httputil.UnmarshalJSONRequest(req, &r)
 	if resErr != nil {
@@ -60,56 +60,23 @@ func SendEvent(req *http.Request, roomID, eventType, txnID string, stateKey *str
 	}
 	builder.SetContent(r)
 
-	// work out what will be required in order to send this event
-	needed, err := gomatrixserverlib.StateNeededForEventBuilder(&builder)
-	if err != nil {
-		return httputil.LogThenError(req, err)
-	}
-
-	// Ask the roomserver for information about this room
-	queryReq := api.QueryLatestEventsAndStateRequest{
-		RoomID:       roomID,
-		StateToFetch: needed.Tuples(),
-	}
-	var queryRes api.QueryLatestEventsAndStateResponse
-	if queryErr := queryAPI.QueryLatestEventsAndState(&queryReq, &queryRes); queryErr != nil {
-		return httputil.LogThenError(req, queryErr)
-	}
-	if !queryRes.RoomExists {
+	e, err := events.BuildEvent(&builder, cfg, queryAPI, nil)
+	if err == events.ErrRoomNoExists {
 		return util.JSONResponse{
 			Code: 404,
 			JSON: jsonerror.NotFound("Room does not exist"),
 		}
-	}
-
-	// set the fields we previously couldn't do and build the event
-	builder.PrevEvents = queryRes.LatestEvents // the current events will be the prev events of the new event
-	var refs []gomatrixserverlib.EventReference
-	for _, e := range queryRes.StateEvents {
-		refs = append(refs, e.EventReference())
-	}
-	builder.AuthEvents = refs
-	eventID := fmt.Sprintf("$%s:%s", util.RandomString(16), cfg.ServerName)
-	e, err := builder.Build(eventID, time.Now(), cfg.ServerName, cfg.KeyID, cfg.PrivateKey)
-	if err != nil {
-		return httputil.LogThenError(req, err)
-	}
-
-	// check to see if this user can perform this operation
-	stateEvents := make([]*gomatrixserverlib.Event, len(queryRes.StateEvents))
-	for i := range queryRes.StateEvents {
-		stateEvents[i] = &queryRes.StateEvents[i]
-	}
-	provider := gomatrixserverlib.NewAuthEvents(stateEvents)
-	if err = gomatrixserverlib.Allowed(e, &provider); err != nil {
+	} else if _, ok := err.(*gomatrixserverlib.NotAllowed); ok {
 		return util.JSONResponse{
 			Code: 403,
 			JSON: jsonerror.Forbidden(err.Error()), // TODO: Is this error string comprehensible to the client?
 		}
+	} else if err != nil {
+		return httputil.LogThenError(req, err)
 	}
 
 	// pass the new event to the roomserver
-	if err := producer.SendEvents([]gomatrixserverlib.Event{e}); err != nil {
+	if err := producer.SendEvents([]gomatrixserverlib.Event{*e}); err != nil {
 		return httputil.LogThenError(req, err)
 	}
 
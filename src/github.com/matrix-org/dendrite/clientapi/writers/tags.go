@@ -0,0 +1,108 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/clientapi/producers"
+	"github.com/matrix-org/util"
+)
+
+// PutTag implements PUT /user/{userID}/rooms/{roomID}/tags/{tag}
+func PutTag(
+	req *http.Request, userID, roomID, tag string, accountDB *accounts.Database,
+	syncProducer *producers.SyncAPIProducer,
+) util.JSONResponse {
+	if resErr := checkTagsUser(req, userID, accountDB); resErr != nil {
+		return *resErr
+	}
+
+	var content map[string]json.RawMessage
+	if resErr := httputil.UnmarshalJSONRequest(req, &content); resErr != nil {
+		return *resErr
+	}
+	if content == nil {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("The tag must be a JSON object"),
+		}
+	}
+	if order, ok := content["order"]; ok {
+		var f float64
+		if err := json.Unmarshal(order, &f); err != nil {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON("'order' must be a number"),
+			}
+		}
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	if err = accountDB.SaveTag(userID, roomID, tag, string(contentJSON)); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	return sendTagsChanged(req, userID, roomID, syncProducer)
+}
+
+// DeleteTag implements DELETE /user/{userID}/rooms/{roomID}/tags/{tag}
+func DeleteTag(
+	req *http.Request, userID, roomID, tag string, accountDB *accounts.Database,
+	syncProducer *producers.SyncAPIProducer,
+) util.JSONResponse {
+	if resErr := checkTagsUser(req, userID, accountDB); resErr != nil {
+		return *resErr
+	}
+	if err := accountDB.RemoveTag(userID, roomID, tag); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	return sendTagsChanged(req, userID, roomID, syncProducer)
+}
+
+// checkTagsUser returns an error response unless the request is authenticated as the given user.
+func checkTagsUser(req *http.Request, userID string, accountDB *accounts.Database) *util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return resErr
+	}
+	if userID != device.UserID {
+		return &util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("Cannot change the tags of another user"),
+		}
+	}
+	return nil
+}
+
+// sendTagsChanged tells the sync server that the m.tag account data of the room changed.
+func sendTagsChanged(
+	req *http.Request, userID, roomID string, syncProducer *producers.SyncAPIProducer,
+) util.JSONResponse {
+	if err := syncProducer.SendData(userID, roomID, "m.tag"); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
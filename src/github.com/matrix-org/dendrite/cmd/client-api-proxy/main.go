@@ -47,9 +47,10 @@ Arguments:
 `
 
 var (
-	syncServerURL = flag.String("sync-api-server-url", "", "The base URL of the listening 'dendrite-sync-api-server' process. E.g. 'http://localhost:4200'")
-	clientAPIURL  = flag.String("client-api-server-url", "", "The base URL of the listening 'dendrite-client-api-server' process. E.g. 'http://localhost:4321'")
-	bindAddress   = flag.String("bind-address", ":8008", "The listening port for the proxy.")
+	syncServerURL     = flag.String("sync-api-server-url", "", "The base URL of the listening 'dendrite-sync-api-server' process. E.g. 'http://localhost:4200'")
+	clientAPIURL      = flag.String("client-api-server-url", "", "The base URL of the listening 'dendrite-client-api-server' process. E.g. 'http://localhost:4321'")
+	publicRoomsAPIURL = flag.String("public-rooms-api-server-url", "", "The base URL of the listening 'dendrite-public-rooms-api-server' process. E.g. 'http://localhost:7775'. Optional.")
+	bindAddress       = flag.String("bind-address", ":8008", "The listening port for the proxy.")
 )
 
 func makeProxy(targetURL string) (*httputil.ReverseProxy, error) {
@@ -89,6 +90,27 @@ func makeProxy(targetURL string) (*httputil.ReverseProxy, error) {
 	}, nil
 }
 
+// syncRoomAPIs are the /rooms/{roomID}/{api} APIs which are served by the sync server.
+var syncRoomAPIs = map[string]bool{
+	"members":  true,
+	"messages": true,
+	"context":  true,
+}
+
+// roomsProxy sends the /rooms/ APIs which are served by the sync server to the sync server, and the
+// rest to the client API server.
+func roomsProxy(syncProxy, clientProxy http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The path is /_matrix/client/r0/rooms/{roomID}/{api}/...
+		parts := strings.Split(req.URL.Path, "/")
+		if len(parts) > 6 && syncRoomAPIs[parts[6]] {
+			syncProxy.ServeHTTP(w, req)
+			return
+		}
+		clientProxy.ServeHTTP(w, req)
+	})
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, usage, os.Args[0])
@@ -119,7 +141,16 @@ func main() {
 	}
 
 	http.Handle("/_matrix/client/r0/sync", syncProxy)
+	http.Handle("/_matrix/client/r0/rooms/", roomsProxy(syncProxy, clientProxy))
 	http.Handle("/", clientProxy)
+	if *publicRoomsAPIURL != "" {
+		publicRoomsProxy, err := makeProxy(*publicRoomsAPIURL)
+		if err != nil {
+			panic(err)
+		}
+		http.Handle("/_matrix/client/r0/publicRooms", publicRoomsProxy)
+		http.Handle("/_matrix/client/r0/directory/list/", publicRoomsProxy)
+	}
 
 	srv := &http.Server{
 		Addr:         *bindAddress,
@@ -129,6 +160,13 @@ func main() {
 
 	fmt.Println("Proxying requests to:")
 	fmt.Println("  /_matrix/client/r0/sync  => ", *syncServerURL+"/api/_matrix/client/r0/sync")
+	fmt.Println("  /_matrix/client/r0/rooms/{roomID}/members  => ", *syncServerURL+"/api/_matrix/client/r0/rooms/{roomID}/members")
+	fmt.Println("  /_matrix/client/r0/rooms/{roomID}/messages => ", *syncServerURL+"/api/_matrix/client/r0/rooms/{roomID}/messages")
+	fmt.Println("  /_matrix/client/r0/rooms/{roomID}/context/* => ", *syncServerURL+"/api/_matrix/client/r0/rooms/{roomID}/context/*")
+	if *publicRoomsAPIURL != "" {
+		fmt.Println("  /_matrix/client/r0/publicRooms      => ", *publicRoomsAPIURL+"/api/_matrix/client/r0/publicRooms")
+		fmt.Println("  /_matrix/client/r0/directory/list/* => ", *publicRoomsAPIURL+"/api/_matrix/client/r0/directory/list/*")
+	}
 	fmt.Println("  /*                       => ", *clientAPIURL+"/api/*")
 	fmt.Println("Listening on ", *bindAddress)
 	srv.ListenAndServe()
@@ -15,70 +15,80 @@
 package main
 
 import (
+	"flag"
 	"net/http"
-	"os"
-	"strings"
 
-	"golang.org/x/crypto/ed25519"
-
-	"github.com/matrix-org/dendrite/clientapi/config"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/consumers"
 	"github.com/matrix-org/dendrite/clientapi/producers"
 	"github.com/matrix-org/dendrite/clientapi/routing"
 	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/common/config"
+	publicrooms "github.com/matrix-org/dendrite/publicroomsapi/api"
 	"github.com/matrix-org/dendrite/roomserver/api"
 
 	log "github.com/Sirupsen/logrus"
 )
 
-var (
-	kafkaURIs            = strings.Split(os.Getenv("KAFKA_URIS"), ",")
-	bindAddr             = os.Getenv("BIND_ADDRESS")
-	logDir               = os.Getenv("LOG_DIR")
-	roomserverURL        = os.Getenv("ROOMSERVER_URL")
-	clientAPIOutputTopic = os.Getenv("CLIENTAPI_OUTPUT_TOPIC")
-)
+var configPath = flag.String("config", "dendrite-config.yaml", "The path to the config file. For more information, see the config file in this repository.")
 
 func main() {
-	common.SetupLogging(logDir)
-	if bindAddr == "" {
-		log.Panic("No BIND_ADDRESS environment variable found.")
-	}
-	if len(kafkaURIs) == 0 {
-		// the kafka default is :9092
-		kafkaURIs = []string{"localhost:9092"}
+	flag.Parse()
+
+	if *configPath == "" {
+		log.Fatal("--config must be supplied")
 	}
-	if roomserverURL == "" {
-		log.Panic("No ROOMSERVER_URL environment variable found.")
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Invalid config file: %s", err)
 	}
-	if clientAPIOutputTopic == "" {
-		log.Panic("No CLIENTAPI_OUTPUT_TOPIC environment variable found. This should match the roomserver input topic.")
+
+	common.SetupLogging(string(cfg.Logging.Directory))
+
+	log.Info("Starting clientapi")
+
+	roomserverProducer, err := producers.NewRoomserverProducer(
+		cfg.Kafka.Addresses, string(cfg.Kafka.Topics.InputRoomEvent),
+	)
+	if err != nil {
+		log.Panicf("Failed to setup kafka producers(%q): %s", cfg.Kafka.Addresses, err)
 	}
 
-	// TODO: Rather than generating a new key on every startup, we should be
-	//       reading a PEM formatted file instead.
-	_, privKey, err := ed25519.GenerateKey(nil)
+	logoutProducer, err := producers.NewLogoutProducer(
+		cfg.Kafka.Addresses, string(cfg.Kafka.Topics.OutputClientLogout),
+	)
 	if err != nil {
-		log.Panicf("Failed to generate private key: %s", err)
+		log.Panicf("Failed to setup kafka producers(%q): %s", cfg.Kafka.Addresses, err)
 	}
 
-	cfg := config.ClientAPI{
-		ServerName:           "localhost",
-		KeyID:                "ed25519:something",
-		PrivateKey:           privKey,
-		KafkaProducerURIs:    kafkaURIs,
-		ClientAPIOutputTopic: clientAPIOutputTopic,
-		RoomserverURL:        roomserverURL,
+	syncProducer, err := producers.NewSyncAPIProducer(
+		cfg.Kafka.Addresses, string(cfg.Kafka.Topics.OutputClientData),
+	)
+	if err != nil {
+		log.Panicf("Failed to setup kafka producers(%q): %s", cfg.Kafka.Addresses, err)
 	}
 
-	log.Info("Starting clientapi")
+	queryAPI := api.NewRoomserverQueryAPIHTTP(cfg.RoomServerURL(), nil)
+	aliasAPI := api.NewRoomserverAliasAPIHTTP(cfg.RoomServerURL(), nil)
+	// The public rooms server is optional, so only publish rooms if there is one.
+	var publicRoomsAPI publicrooms.PublicRoomsAPI
+	if cfg.PublicRoomsAPIURL() != "" {
+		publicRoomsAPI = publicrooms.NewPublicRoomsAPIHTTP(cfg.PublicRoomsAPIURL(), nil)
+	}
 
-	roomserverProducer, err := producers.NewRoomserverProducer(cfg.KafkaProducerURIs, cfg.ClientAPIOutputTopic)
+	accountDB, err := accounts.NewDatabase(string(cfg.Database.Account))
 	if err != nil {
-		log.Panicf("Failed to setup kafka producers(%s): %s", cfg.KafkaProducerURIs, err)
+		log.Panicf("Failed to setup account database(%q): %s", cfg.Database.Account, err)
 	}
 
-	queryAPI := api.NewRoomserverQueryAPIHTTP(cfg.RoomserverURL, nil)
+	roomConsumer, err := consumers.NewOutputRoomEvent(cfg, accountDB)
+	if err != nil {
+		log.Panicf("startup: failed to create room server consumer: %s", err)
+	}
+	if err = roomConsumer.Start(); err != nil {
+		log.Panicf("startup: failed to start room server consumer")
+	}
 
-	routing.Setup(http.DefaultServeMux, http.DefaultClient, cfg, roomserverProducer, queryAPI)
-	log.Fatal(http.ListenAndServe(bindAddr, nil))
+	routing.Setup(http.DefaultServeMux, http.DefaultClient, cfg, roomserverProducer, queryAPI, aliasAPI, publicRoomsAPI, accountDB, logoutProducer, syncProducer)
+	log.Fatal(http.ListenAndServe(string(cfg.Listen.ClientAPI), nil))
 }
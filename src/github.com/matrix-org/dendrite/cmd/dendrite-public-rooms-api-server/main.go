@@ -0,0 +1,71 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/publicroomsapi/consumers"
+	"github.com/matrix-org/dendrite/publicroomsapi/routing"
+	"github.com/matrix-org/dendrite/publicroomsapi/storage"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var configPath = flag.String("config", "dendrite-config.yaml", "The path to the config file. For more information, see the config file in this repository.")
+
+func main() {
+	flag.Parse()
+
+	if *configPath == "" {
+		log.Fatal("--config must be supplied")
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Invalid config file: %s", err)
+	}
+
+	common.SetupLogging(string(cfg.Logging.Directory))
+
+	if cfg.Database.PublicRoomsAPI == "" || cfg.Listen.PublicRoomsAPI == "" {
+		log.Fatal("database.public_rooms_api and listen.public_rooms_api must be set to run the public rooms server")
+	}
+
+	db, err := storage.NewPublicRoomsServerDatabase(string(cfg.Database.PublicRoomsAPI))
+	if err != nil {
+		log.Panicf("startup: failed to create public rooms server database with data source %s : %s", cfg.Database.PublicRoomsAPI, err)
+	}
+
+	accountDB, err := accounts.NewDatabase(string(cfg.Database.Account))
+	if err != nil {
+		log.Panicf("startup: failed to create account database with data source %s : %s", cfg.Database.Account, err)
+	}
+
+	roomConsumer, err := consumers.NewOutputRoomEvent(cfg, db)
+	if err != nil {
+		log.Panicf("startup: failed to create room server consumer: %s", err)
+	}
+	if err = roomConsumer.Start(); err != nil {
+		log.Panicf("startup: failed to start room server consumer")
+	}
+
+	log.Info("Starting public rooms server on ", cfg.Listen.PublicRoomsAPI)
+	routing.Setup(http.DefaultServeMux, cfg, db, accountDB)
+	log.Fatal(http.ListenAndServe(string(cfg.Listen.PublicRoomsAPI), nil))
+}
@@ -16,62 +16,46 @@ package main
 
 import (
 	"flag"
-	"io/ioutil"
 	"net/http"
-	"os"
 
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
 	"github.com/matrix-org/dendrite/common"
-	"github.com/matrix-org/dendrite/syncapi/config"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
 	"github.com/matrix-org/dendrite/syncapi/consumers"
 	"github.com/matrix-org/dendrite/syncapi/routing"
 	"github.com/matrix-org/dendrite/syncapi/storage"
 	"github.com/matrix-org/dendrite/syncapi/sync"
 
 	log "github.com/Sirupsen/logrus"
-	yaml "gopkg.in/yaml.v2"
 )
 
-var configPath = flag.String("config", "sync-server-config.yaml", "The path to the config file. For more information, see the config file in this repository.")
-var bindAddr = flag.String("listen", ":4200", "The port to listen on.")
-
-func loadConfig(configPath string) (*config.Sync, error) {
-	contents, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		return nil, err
-	}
-	var cfg config.Sync
-	if err = yaml.Unmarshal(contents, &cfg); err != nil {
-		return nil, err
-	}
-	// check required fields
-	return &cfg, nil
-}
+var configPath = flag.String("config", "dendrite-config.yaml", "The path to the config file. For more information, see the config file in this repository.")
 
 func main() {
-	common.SetupLogging(os.Getenv("LOG_DIR"))
-
 	flag.Parse()
 
 	if *configPath == "" {
 		log.Fatal("--config must be supplied")
 	}
-	cfg, err := loadConfig(*configPath)
+	cfg, err := config.Load(*configPath)
 	if err != nil {
 		log.Fatalf("Invalid config file: %s", err)
 	}
 
-	if *bindAddr == "" {
-		log.Fatal("--listen must be supplied")
-	}
+	common.SetupLogging(string(cfg.Logging.Directory))
 
-	log.Info("sync server config: ", cfg)
+	db, err := storage.NewSyncServerDatabase(string(cfg.Database.SyncAPI))
+	if err != nil {
+		log.Panicf("startup: failed to create sync server database with data source %s : %s", cfg.Database.SyncAPI, err)
+	}
 
-	db, err := storage.NewSyncServerDatabase(cfg.DataSource)
+	accountDB, err := accounts.NewDatabase(string(cfg.Database.Account))
 	if err != nil {
-		log.Panicf("startup: failed to create sync server database with data source %s : %s", cfg.DataSource, err)
+		log.Panicf("startup: failed to create account database with data source %s : %s", cfg.Database.Account, err)
 	}
 
-	rp, err := sync.NewRequestPool(db)
+	rp, err := sync.NewRequestPool(db, accountDB)
 	if err != nil {
 		log.Panicf("startup: Failed to create request pool : %s", err)
 	}
@@ -84,7 +68,25 @@ func main() {
 		log.Panicf("startup: failed to start sync server")
 	}
 
-	log.Info("Starting sync server on ", *bindAddr)
-	routing.SetupSyncServerListeners(http.DefaultServeMux, http.DefaultClient, *cfg, rp)
-	log.Fatal(http.ListenAndServe(*bindAddr, nil))
+	logoutConsumer, err := consumers.NewLogoutConsumer(cfg, rp, db)
+	if err != nil {
+		log.Panicf("startup: failed to create logout consumer: %s", err)
+	}
+	if err = logoutConsumer.Start(); err != nil {
+		log.Panicf("startup: failed to start logout consumer")
+	}
+
+	clientDataConsumer, err := consumers.NewOutputClientData(cfg, rp, db)
+	if err != nil {
+		log.Panicf("startup: failed to create client API data consumer: %s", err)
+	}
+	if err = clientDataConsumer.Start(); err != nil {
+		log.Panicf("startup: failed to start client API data consumer")
+	}
+
+	queryAPI := api.NewRoomserverQueryAPIHTTP(cfg.RoomServerURL(), nil)
+
+	log.Info("Starting sync server on ", cfg.Listen.SyncAPI)
+	routing.SetupSyncServerListeners(http.DefaultServeMux, http.DefaultClient, cfg, rp, db, queryAPI, accountDB)
+	log.Fatal(http.ListenAndServe(string(cfg.Listen.SyncAPI), nil))
 }
@@ -0,0 +1,58 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/matrix-org/dendrite/common/config"
+)
+
+const usage = `Usage: %s
+
+Writes a commented config file with the default values to stdout.
+The config refers to a signing key which can be made with generate-keys.
+
+Example:
+
+	./generate-config --server-name example.com > dendrite-config.yaml
+	./generate-keys --private-key server.key
+
+Arguments:
+
+`
+
+var serverName = flag.String("server-name", "localhost", "The name of the server, e.g. 'matrix.org'")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *serverName == "" {
+		fmt.Fprintln(os.Stderr, "no --server-name specified")
+		os.Exit(1)
+	}
+
+	if _, err := os.Stdout.Write(config.Default(*serverName)); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write config:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/matrix-org/dendrite/common"
+	"golang.org/x/crypto/ed25519"
+)
+
+const usage = `Usage: %s
+
+Generates a new ed25519 signing key for the server.
+
+To rotate keys, pass --old-key: the public half of the existing key at --private-key is written
+to that path as an old key which has expired now, and a new key is written to --private-key. Add
+the old key to old_verify_keys in the config so that events signed with it can still be verified.
+
+Example:
+
+	./generate-keys --private-key server.key
+	./generate-keys --private-key server.key --old-key old-server.key
+
+Arguments:
+
+`
+
+var (
+	privateKeyPath = flag.String("private-key", "", "REQUIRED: the path to write the new signing key to")
+	format         = flag.String("format", "pem", "The format of the new key file: 'pem' or 'matrix' (the format of synapse's signing.key)")
+	oldKeyPath     = flag.String("old-key", "", "The path to write the public half of the existing key at --private-key to as an expired key")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *privateKeyPath == "" {
+		fmt.Fprintln(os.Stderr, "no --private-key specified")
+		os.Exit(1)
+	}
+	if *format != "pem" && *format != "matrix" {
+		fmt.Fprintln(os.Stderr, "--format must be 'pem' or 'matrix'")
+		os.Exit(1)
+	}
+
+	if *oldKeyPath != "" {
+		keyID, privateKey, err := common.LoadSigningKey(*privateKeyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load existing key:", err)
+			os.Exit(1)
+		}
+		expiredTS := time.Now().UnixNano() / int64(time.Millisecond)
+		err = writeKeyFile(*oldKeyPath, false, func(w io.Writer) error {
+			return common.WriteOldVerifyKeyPEM(w, keyID, privateKey.Public().(ed25519.PublicKey), expiredTS)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write old key:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote old key %s to %s\n", keyID, *oldKeyPath)
+	}
+
+	keyID, privateKey, err := common.GenerateSigningKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to generate key:", err)
+		os.Exit(1)
+	}
+	// Only overwrite the existing key if it was saved as an old key first.
+	err = writeKeyFile(*privateKeyPath, *oldKeyPath != "", func(w io.Writer) error {
+		if *format == "matrix" {
+			return common.WriteSigningKeyMatrix(w, keyID, privateKey)
+		}
+		return common.WriteSigningKeyPEM(w, keyID, privateKey)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write key:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote new key %s to %s\n", keyID, *privateKeyPath)
+}
+
+func writeKeyFile(path string, overwrite bool, write func(io.Writer) error) (err error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return write(f)
+}
@@ -16,13 +16,18 @@ package main
 
 import (
 	"fmt"
-	"github.com/matrix-org/dendrite/roomserver/api"
-	"github.com/matrix-org/gomatrixserverlib"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var (
@@ -217,20 +222,22 @@ func testRoomserver(input []string, wantOutput []string, checkQueries func(api.R
 		panic(err)
 	}
 
-	cmd := exec.Command(filepath.Join(filepath.Dir(os.Args[0]), "dendrite-room-server"))
+	dir, err := ioutil.TempDir("", "roomserver-integration-tests")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath, err := writeConfig(dir, inputTopic, outputTopic)
+	if err != nil {
+		panic(err)
+	}
+
+	cmd := exec.Command(filepath.Join(filepath.Dir(os.Args[0]), "dendrite-room-server"), "--config", configPath)
 
-	// Append the roomserver config to the existing environment.
-	// We append to the environment rather than replacing so that any additional
+	// Run the roomserver with the existing environment so that any additional
 	// postgres and golang environment variables such as PGHOST are passed to
 	// the roomserver process.
-	cmd.Env = append(
-		os.Environ(),
-		fmt.Sprintf("DATABASE=%s", testDatabase),
-		fmt.Sprintf("KAFKA_URIS=%s", kafkaURI),
-		fmt.Sprintf("TOPIC_INPUT_ROOM_EVENT=%s", inputTopic),
-		fmt.Sprintf("TOPIC_OUTPUT_ROOM_EVENT=%s", outputTopic),
-		fmt.Sprintf("BIND_ADDRESS=%s", roomserverAddr),
-	)
+	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 
 	gotOutput, err := runAndReadFromTopic(cmd, outputTopic, len(wantOutput), func() {
@@ -252,6 +259,52 @@ func testRoomserver(input []string, wantOutput []string, checkQueries func(api.R
 	}
 }
 
+// writeConfig writes a config file for the roomserver under test, along with the
+// signing key it refers to, to the given directory. Returns the path to the config file.
+func writeConfig(dir, inputTopic, outputTopic string) (string, error) {
+	keyID, privateKey, err := common.GenerateSigningKey()
+	if err != nil {
+		return "", err
+	}
+	keyFile, err := os.Create(filepath.Join(dir, "server.key"))
+	if err != nil {
+		return "", err
+	}
+	defer keyFile.Close()
+	if err = common.WriteSigningKeyPEM(keyFile, keyID, privateKey); err != nil {
+		return "", err
+	}
+
+	var cfg config.Dendrite
+	cfg.Version = config.Version
+	cfg.Matrix.ServerName = "localhost"
+	cfg.Matrix.PrivateKeyPath = "server.key"
+	cfg.Kafka.Addresses = []string{kafkaURI}
+	cfg.Kafka.Topics.InputRoomEvent = config.Topic(inputTopic)
+	cfg.Kafka.Topics.OutputRoomEvent = config.Topic(outputTopic)
+	cfg.Kafka.Topics.OutputClientLogout = "clientapiLogout"
+	cfg.Kafka.Topics.OutputClientData = "clientapiOutput"
+	cfg.Database.RoomServer = config.DataSource(testDatabase)
+	// The roomserver doesn't use these, but they must be set for the config to be valid.
+	cfg.Database.Account = config.DataSource(testDatabase)
+	cfg.Database.SyncAPI = config.DataSource(testDatabase)
+	cfg.Database.PublicRoomsAPI = config.DataSource(testDatabase)
+	cfg.Listen.RoomServer = config.Address(roomserverAddr)
+	cfg.Listen.ClientAPI = "localhost:7771"
+	cfg.Listen.SyncAPI = "localhost:7773"
+	cfg.Listen.PublicRoomsAPI = "localhost:7775"
+
+	configData, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return "", err
+	}
+	configPath := filepath.Join(dir, "dendrite.yaml")
+	if err = ioutil.WriteFile(configPath, configData, 0600); err != nil {
+		return "", err
+	}
+	return configPath, nil
+}
+
 func canonicalJSONInput(jsonData []string) []string {
 	for i := range jsonData {
 		jsonBytes, err := gomatrixserverlib.CanonicalJSON([]byte(jsonData[i]))
@@ -0,0 +1,89 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrix-org/dendrite/common"
+)
+
+func TestLoadDefaultConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dendrite-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyID, privateKey, err := common.GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, err := os.Create(filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = common.WriteSigningKeyPEM(keyFile, keyID, privateKey); err != nil {
+		t.Fatal(err)
+	}
+	keyFile.Close()
+	configPath := filepath.Join(dir, "dendrite.yaml")
+	if err = ioutil.WriteFile(configPath, Default("example.com"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load(default config) failed: %s", err)
+	}
+	if cfg.Matrix.ServerName != "example.com" {
+		t.Errorf("want server name example.com, got %q", cfg.Matrix.ServerName)
+	}
+	if cfg.Matrix.KeyID != keyID {
+		t.Errorf("want key ID %s, got %s", keyID, cfg.Matrix.KeyID)
+	}
+	if cfg.RoomServerURL() != "http://localhost:7770" {
+		t.Errorf("want roomserver URL http://localhost:7770, got %s", cfg.RoomServerURL())
+	}
+	if len(cfg.Listen.TrustedProxyNets) != 2 || !cfg.Listen.TrustedProxyNets[0].Contains(net.ParseIP("127.0.0.1")) {
+		t.Errorf("want the loopback addresses as trusted proxies, got %v", cfg.Listen.TrustedProxyNets)
+	}
+	if cfg.RateLimits.Messages != (RateLimit{PerSecond: 0.2, Burst: 10}) {
+		t.Errorf("want message rate limit of 0.2/s with bursts of 10, got %+v", cfg.RateLimits.Messages)
+	}
+}
+
+func TestCheckReportsMissingKeys(t *testing.T) {
+	_, err := loadConfig("/", []byte("version: 0\nmatrix:\n  server_name: localhost\n"))
+	if err == nil {
+		t.Fatal("want error for incomplete config, got nil")
+	}
+	cfgErr, ok := err.(Error)
+	if !ok {
+		t.Fatalf("want config.Error, got %T: %s", err, err)
+	}
+	if len(cfgErr.Problems) < 2 || !strings.Contains(cfgErr.Problems[0], "matrix.private_key") {
+		t.Errorf("want problems starting with matrix.private_key, got %v", cfgErr.Problems)
+	}
+
+	if _, err = loadConfig("/", []byte("version: 1\n")); err == nil {
+		t.Error("want error for unknown config version, got nil")
+	}
+}
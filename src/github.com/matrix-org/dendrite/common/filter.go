@@ -0,0 +1,145 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import "strings"
+
+// Filter is a filter which clients can use to select what they want in /sync responses. It can
+// be uploaded to the server to get a filter ID, or be given inline in the /sync request.
+// See https://matrix.org/docs/spec/client_server/r0.2.0.html#post-matrix-client-r0-user-userid-filter
+type Filter struct {
+	// The fields of each event to include, e.g. "content.body". A '.' in a field name can be escaped
+	// with a '\'. If empty then all fields are included.
+	EventFields []string `json:"event_fields,omitempty"`
+	// The presence updates to include.
+	Presence EventFilter `json:"presence"`
+	// The global account data to include.
+	AccountData EventFilter `json:"account_data"`
+	// The rooms and the events in them to include.
+	Room RoomFilter `json:"room"`
+}
+
+// EventFilter is a filter which selects events by their type and sender.
+type EventFilter struct {
+	// The maximum number of events to return.
+	Limit int `json:"limit,omitempty"`
+	// The event types to include. A '*' can be used as a wildcard. If empty then all types are included.
+	Types []string `json:"types,omitempty"`
+	// The event types to exclude. A '*' can be used as a wildcard. Takes precedence over Types.
+	NotTypes []string `json:"not_types,omitempty"`
+	// The senders to include. If empty then all senders are included.
+	Senders []string `json:"senders,omitempty"`
+	// The senders to exclude. Takes precedence over Senders.
+	NotSenders []string `json:"not_senders,omitempty"`
+}
+
+// RoomEventFilter is a filter which clients can use to select which room events they want.
+type RoomEventFilter struct {
+	EventFilter
+	// The room IDs to include. If empty then all rooms are included.
+	Rooms []string `json:"rooms,omitempty"`
+	// The room IDs to exclude. Takes precedence over Rooms.
+	NotRooms []string `json:"not_rooms,omitempty"`
+}
+
+// RoomFilter is the part of a Filter which selects rooms and the events in each section of them.
+type RoomFilter struct {
+	// The room IDs to include. If empty then all rooms are included.
+	Rooms []string `json:"rooms,omitempty"`
+	// The room IDs to exclude. Takes precedence over Rooms.
+	NotRooms []string `json:"not_rooms,omitempty"`
+	// Whether to include the rooms which the user has left.
+	IncludeLeave bool `json:"include_leave,omitempty"`
+	// The events to include in the state of each room.
+	State RoomEventFilter `json:"state"`
+	// The events to include in the timeline of each room.
+	Timeline RoomEventFilter `json:"timeline"`
+	// The ephemeral events, such as typing notifications, to include for each room.
+	Ephemeral RoomEventFilter `json:"ephemeral"`
+	// The account data to include for each room.
+	AccountData RoomEventFilter `json:"account_data"`
+}
+
+// AllowsEvent returns whether an event with the given type and sender passes the filter.
+// As in the filters which are applied by the database, a nil list doesn't restrict the events
+// but an empty list matches nothing.
+func (f *EventFilter) AllowsEvent(eventType, sender string) bool {
+	if f.Types != nil && !matchesAnyType(f.Types, eventType) {
+		return false
+	}
+	if matchesAnyType(f.NotTypes, eventType) {
+		return false
+	}
+	if f.Senders != nil && !contains(f.Senders, sender) {
+		return false
+	}
+	return !contains(f.NotSenders, sender)
+}
+
+// AllowsRoom returns whether the events in the given room pass the filter.
+func (f *RoomEventFilter) AllowsRoom(roomID string) bool {
+	return allowsRoom(f.Rooms, f.NotRooms, roomID)
+}
+
+// AllowsRoom returns whether the given room passes the filter.
+func (f *RoomFilter) AllowsRoom(roomID string) bool {
+	return allowsRoom(f.Rooms, f.NotRooms, roomID)
+}
+
+func allowsRoom(rooms, notRooms []string, roomID string) bool {
+	if rooms != nil && !contains(rooms, roomID) {
+		return false
+	}
+	return !contains(notRooms, roomID)
+}
+
+func matchesAnyType(patterns []string, eventType string) bool {
+	for _, pattern := range patterns {
+		if matchesType(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesType returns whether the event type matches the pattern, where a '*' in the pattern
+// matches any sequence of characters.
+func matchesType(pattern, eventType string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == eventType
+	}
+	if !strings.HasPrefix(eventType, parts[0]) {
+		return false
+	}
+	rest := eventType[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	return strings.HasSuffix(rest, parts[len(parts)-1])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
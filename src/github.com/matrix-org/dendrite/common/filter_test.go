@@ -0,0 +1,84 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMatchesType(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		eventType string
+		want      bool
+	}{
+		{"m.room.message", "m.room.message", true},
+		{"m.room.message", "m.room.message.feedback", false},
+		{"m.room.*", "m.room.message", true},
+		{"m.room.*", "m.presence", false},
+		{"*", "m.room.message", true},
+		{"*.member", "m.room.member", true},
+		{"m.*.member", "m.room.member", true},
+		{"m.*.member", "m.member", false},
+		{"m.*member*", "m.room.member", true},
+	}
+	for _, test := range tests {
+		if got := matchesType(test.pattern, test.eventType); got != test.want {
+			t.Errorf("matchesType(%q, %q): wanted %v got %v", test.pattern, test.eventType, test.want, got)
+		}
+	}
+}
+
+func TestEventFilterAllowsEvent(t *testing.T) {
+	var f EventFilter
+	if err := json.Unmarshal([]byte(`{"types":["m.room.*"],"not_types":["m.room.member"],"not_senders":["@spam:localhost"]}`), &f); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		eventType string
+		sender    string
+		want      bool
+	}{
+		{"m.room.message", "@alice:localhost", true},
+		{"m.room.member", "@alice:localhost", false},
+		{"m.presence", "@alice:localhost", false},
+		{"m.room.message", "@spam:localhost", false},
+	}
+	for _, test := range tests {
+		if got := f.AllowsEvent(test.eventType, test.sender); got != test.want {
+			t.Errorf("AllowsEvent(%q, %q): wanted %v got %v", test.eventType, test.sender, test.want, got)
+		}
+	}
+
+	// An empty list of types matches nothing, whereas a missing list matches everything.
+	if err := json.Unmarshal([]byte(`{"types":[]}`), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.AllowsEvent("m.room.message", "@alice:localhost") {
+		t.Error("AllowsEvent: wanted an empty list of types to exclude all events")
+	}
+}
+
+func TestRoomFilterAllowsRoom(t *testing.T) {
+	f := RoomFilter{NotRooms: []string{"!excluded:localhost"}}
+	if !f.AllowsRoom("!room:localhost") || f.AllowsRoom("!excluded:localhost") {
+		t.Errorf("AllowsRoom: wanted only !excluded:localhost to be excluded by %+v", f)
+	}
+	f = RoomFilter{Rooms: []string{"!room:localhost", "!excluded:localhost"}, NotRooms: []string{"!excluded:localhost"}}
+	if !f.AllowsRoom("!room:localhost") || f.AllowsRoom("!excluded:localhost") || f.AllowsRoom("!other:localhost") {
+		t.Errorf("AllowsRoom: wanted only !room:localhost to be included by %+v", f)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+	"golang.org/x/crypto/ed25519"
+)
+
+// The PEM block type used for server signing keys.
+const signingKeyPEMBlockType = "MATRIX PRIVATE KEY"
+
+// The PEM block type used for the public halves of expired signing keys.
+const oldVerifyKeyPEMBlockType = "MATRIX OLD VERIFY KEY"
+
+// The algorithm prefix of the key IDs of ed25519 keys.
+const ed25519KeyIDPrefix = "ed25519:"
+
+// An OldVerifyKey is the public half of a signing key which this server no longer signs events with.
+// It is kept so that events which were signed before the key expired can still be verified.
+type OldVerifyKey struct {
+	// The ID of the key e.g "ed25519:auto"
+	KeyID string
+	// The public key.
+	PublicKey ed25519.PublicKey
+	// When the key stopped being used for signing events, as a unix timestamp (ms resolution).
+	ExpiredTS int64
+}
+
+// A signingKeyFile is the contents of a key file.
+type signingKeyFile struct {
+	keyID      string
+	privateKey ed25519.PrivateKey
+}
+
+// GenerateSigningKey creates a new ed25519 signing key with a random key ID.
+func GenerateSigningKey() (keyID string, privateKey ed25519.PrivateKey, err error) {
+	_, privateKey, err = ed25519.GenerateKey(nil)
+	if err != nil {
+		return
+	}
+	keyID = ed25519KeyIDPrefix + "a_" + util.RandomString(4)
+	return
+}
+
+// LoadSigningKey reads the signing key which the server should sign events with from a file.
+// The file can either be PEM encoded, or use the same format as synapse's signing.key files.
+func LoadSigningKey(path string) (keyID string, privateKey ed25519.PrivateKey, err error) {
+	kf, err := readSigningKeyFile(path)
+	if err != nil {
+		return
+	}
+	return kf.keyID, kf.privateKey, nil
+}
+
+// LoadOldVerifyKey reads the public half of a signing key which the server no longer signs
+// events with from a file written by WriteOldVerifyKeyPEM.
+func LoadOldVerifyKey(path string) (*OldVerifyKey, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	old, err := parsePEMOldVerifyKey(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read old verify key from %s: %s", path, err)
+	}
+	return old, nil
+}
+
+// WriteSigningKeyPEM writes a signing key in PEM format.
+func WriteSigningKeyPEM(w io.Writer, keyID string, privateKey ed25519.PrivateKey) error {
+	return pem.Encode(w, &pem.Block{
+		Type: signingKeyPEMBlockType,
+		Headers: map[string]string{
+			"Key-ID": keyID,
+		},
+		Bytes: privateKey[:32], // the seed
+	})
+}
+
+// WriteOldVerifyKeyPEM writes the public half of a signing key which expired at expiredTS, as a
+// unix timestamp (ms resolution), in PEM format. The private key isn't needed to verify the
+// events signed before it expired, so it isn't kept.
+func WriteOldVerifyKeyPEM(w io.Writer, keyID string, publicKey ed25519.PublicKey, expiredTS int64) error {
+	return pem.Encode(w, &pem.Block{
+		Type: oldVerifyKeyPEMBlockType,
+		Headers: map[string]string{
+			"Key-ID":     keyID,
+			"Expired-TS": strconv.FormatInt(expiredTS, 10),
+		},
+		Bytes: publicKey,
+	})
+}
+
+// WriteSigningKeyMatrix writes a signing key in the format of synapse's signing.key files,
+// e.g "ed25519 a_abcd <unpadded base64 seed>".
+func WriteSigningKeyMatrix(w io.Writer, keyID string, privateKey ed25519.PrivateKey) error {
+	if !strings.HasPrefix(keyID, ed25519KeyIDPrefix) {
+		return fmt.Errorf("key ID %q must start with %q", keyID, ed25519KeyIDPrefix)
+	}
+	_, err := fmt.Fprintf(
+		w, "ed25519 %s %s\n",
+		strings.TrimPrefix(keyID, ed25519KeyIDPrefix), base64.RawStdEncoding.EncodeToString(privateKey[:32]),
+	)
+	return err
+}
+
+// VerifyOwnEventSignature checks that an event was signed by this server. Signatures made with
+// an old key are only accepted if the event was sent before the key expired.
+func VerifyOwnEventSignature(
+	event gomatrixserverlib.Event, serverName, keyID string, privateKey ed25519.PrivateKey, oldVerifyKeys []OldVerifyKey,
+) error {
+	for _, signedKeyID := range event.KeyIDs(serverName) {
+		if signedKeyID == keyID {
+			return event.Verify(serverName, keyID, privateKey.Public().(ed25519.PublicKey))
+		}
+		for _, old := range oldVerifyKeys {
+			if signedKeyID != old.KeyID {
+				continue
+			}
+			if event.OriginServerTS() >= old.ExpiredTS {
+				return fmt.Errorf("event %s was sent after key %s expired", event.EventID(), old.KeyID)
+			}
+			return event.Verify(serverName, old.KeyID, old.PublicKey)
+		}
+	}
+	return fmt.Errorf("event %s is not signed with a known key for %s", event.EventID(), serverName)
+}
+
+// serverKeys is the body of a /_matrix/key/v2/server response, before it is signed.
+type serverKeys struct {
+	ServerName      string                      `json:"server_name"`
+	VerifyKeys      map[string]verifyKey        `json:"verify_keys"`
+	OldVerifyKeys   map[string]oldVerifyKeyJSON `json:"old_verify_keys"`
+	TLSFingerprints []struct{}                  `json:"tls_fingerprints"`
+	ValidUntilTS    int64                       `json:"valid_until_ts"`
+}
+
+type verifyKey struct {
+	Key gomatrixserverlib.Base64String `json:"key"`
+}
+
+type oldVerifyKeyJSON struct {
+	Key       gomatrixserverlib.Base64String `json:"key"`
+	ExpiredTS int64                          `json:"expired_ts"`
+}
+
+// SignedServerKeys returns the JSON which this server publishes at /_matrix/key/v2/server, signed
+// with its current key. It lists the current key in "verify_keys" and the old keys, with the time
+// they expired, in "old_verify_keys" so that other servers can check the events signed with them.
+func SignedServerKeys(
+	serverName, keyID string, privateKey ed25519.PrivateKey, oldVerifyKeys []OldVerifyKey, validUntil time.Time,
+) ([]byte, error) {
+	keys := serverKeys{
+		ServerName: serverName,
+		VerifyKeys: map[string]verifyKey{
+			keyID: {gomatrixserverlib.Base64String(privateKey.Public().(ed25519.PublicKey))},
+		},
+		OldVerifyKeys: make(map[string]oldVerifyKeyJSON),
+		// TODO: List the fingerprints of our TLS certificates once we serve federation traffic.
+		TLSFingerprints: []struct{}{},
+		ValidUntilTS:    validUntil.UnixNano() / int64(time.Millisecond),
+	}
+	for _, old := range oldVerifyKeys {
+		keys.OldVerifyKeys[old.KeyID] = oldVerifyKeyJSON{gomatrixserverlib.Base64String(old.PublicKey), old.ExpiredTS}
+	}
+	unsigned, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	return gomatrixserverlib.SignJSON(serverName, keyID, privateKey, unsigned)
+}
+
+func readSigningKeyFile(path string) (*signingKeyFile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf *signingKeyFile
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("-----BEGIN")) {
+		kf, err = parsePEMSigningKey(contents)
+	} else {
+		kf, err = parseMatrixSigningKey(contents)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key from %s: %s", path, err)
+	}
+	return kf, nil
+}
+
+func parsePEMSigningKey(contents []byte) (*signingKeyFile, error) {
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if block.Type != signingKeyPEMBlockType {
+		return nil, fmt.Errorf("unexpected PEM block type %q, want %q", block.Type, signingKeyPEMBlockType)
+	}
+	var err error
+	kf := signingKeyFile{keyID: block.Headers["Key-ID"]}
+	if !strings.HasPrefix(kf.keyID, ed25519KeyIDPrefix) {
+		return nil, fmt.Errorf("Key-ID %q must start with %q", kf.keyID, ed25519KeyIDPrefix)
+	}
+	if kf.privateKey, err = privateKeyFromSeed(block.Bytes); err != nil {
+		return nil, err
+	}
+	return &kf, nil
+}
+
+func parsePEMOldVerifyKey(contents []byte) (*OldVerifyKey, error) {
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if block.Type != oldVerifyKeyPEMBlockType {
+		return nil, fmt.Errorf("unexpected PEM block type %q, want %q", block.Type, oldVerifyKeyPEMBlockType)
+	}
+	var err error
+	old := OldVerifyKey{KeyID: block.Headers["Key-ID"]}
+	if !strings.HasPrefix(old.KeyID, ed25519KeyIDPrefix) {
+		return nil, fmt.Errorf("Key-ID %q must start with %q", old.KeyID, ed25519KeyIDPrefix)
+	}
+	expiredTS := block.Headers["Expired-TS"]
+	if old.ExpiredTS, err = strconv.ParseInt(expiredTS, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid Expired-TS %q: %s", expiredTS, err)
+	}
+	if len(block.Bytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("ed25519 public key must be %d bytes, got %d", ed25519.PublicKeySize, len(block.Bytes))
+	}
+	old.PublicKey = ed25519.PublicKey(block.Bytes)
+	return &old, nil
+}
+
+func parseMatrixSigningKey(contents []byte) (*signingKeyFile, error) {
+	fields := strings.Fields(string(contents))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("expected \"<algorithm> <version> <seed>\", got %d fields", len(fields))
+	}
+	if fields[0] != "ed25519" {
+		return nil, fmt.Errorf("unsupported key algorithm %q", fields[0])
+	}
+	seed, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(fields[2], "="))
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := privateKeyFromSeed(seed)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKeyFile{keyID: ed25519KeyIDPrefix + fields[1], privateKey: privateKey}, nil
+}
+
+func privateKeyFromSeed(seed []byte) (ed25519.PrivateKey, error) {
+	if len(seed) != 32 {
+		return nil, fmt.Errorf("ed25519 seed must be 32 bytes, got %d", len(seed))
+	}
+	_, privateKey, err := ed25519.GenerateKey(bytes.NewReader(seed))
+	return privateKey, err
+}
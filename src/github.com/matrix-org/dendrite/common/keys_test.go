@@ -0,0 +1,183 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/gomatrixserverlib"
+	"golang.org/x/crypto/ed25519"
+)
+
+func writeTempKeyFile(t *testing.T, dir, name string, write func(*bytes.Buffer) error) string {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		t.Fatalf("failed to encode key: %s", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write key file: %s", err)
+	}
+	return path
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dendrite-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyID, privateKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey failed: %s", err)
+	}
+
+	pemPath := writeTempKeyFile(t, dir, "key.pem", func(b *bytes.Buffer) error {
+		return WriteSigningKeyPEM(b, keyID, privateKey)
+	})
+	matrixPath := writeTempKeyFile(t, dir, "signing.key", func(b *bytes.Buffer) error {
+		return WriteSigningKeyMatrix(b, keyID, privateKey)
+	})
+	for _, path := range []string{pemPath, matrixPath} {
+		gotKeyID, gotKey, err := LoadSigningKey(path)
+		if err != nil {
+			t.Errorf("LoadSigningKey(%s) failed: %s", path, err)
+			continue
+		}
+		if gotKeyID != keyID || !bytes.Equal(gotKey, privateKey) {
+			t.Errorf("LoadSigningKey(%s): want key %s, got %s", path, keyID, gotKeyID)
+		}
+	}
+
+	if _, err = LoadOldVerifyKey(pemPath); err == nil {
+		t.Errorf("LoadOldVerifyKey(%s): want error for a signing key", pemPath)
+	}
+
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	oldPath := writeTempKeyFile(t, dir, "old.pem", func(b *bytes.Buffer) error {
+		return WriteOldVerifyKeyPEM(b, keyID, publicKey, 1234)
+	})
+	if _, _, err = LoadSigningKey(oldPath); err == nil {
+		t.Errorf("LoadSigningKey(%s): want error for an old verify key", oldPath)
+	}
+	old, err := LoadOldVerifyKey(oldPath)
+	if err != nil {
+		t.Fatalf("LoadOldVerifyKey(%s) failed: %s", oldPath, err)
+	}
+	if old.KeyID != keyID || old.ExpiredTS != 1234 || !bytes.Equal(old.PublicKey, publicKey) {
+		t.Errorf("LoadOldVerifyKey(%s): got %+v", oldPath, old)
+	}
+	oldContents, err := ioutil.ReadFile(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(oldContents, []byte(base64.StdEncoding.EncodeToString(privateKey[:32]))) {
+		t.Errorf("LoadOldVerifyKey(%s): want the private key to be discarded", oldPath)
+	}
+}
+
+func TestSignedServerKeys(t *testing.T) {
+	oldKeyID, oldKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey failed: %s", err)
+	}
+	keyID, key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey failed: %s", err)
+	}
+	oldVerifyKeys := []OldVerifyKey{{oldKeyID, oldKey.Public().(ed25519.PublicKey), 1234}}
+
+	signed, err := SignedServerKeys("localhost", keyID, key, oldVerifyKeys, time.Unix(1500000000, 0))
+	if err != nil {
+		t.Fatalf("SignedServerKeys failed: %s", err)
+	}
+	if err = gomatrixserverlib.VerifyJSON("localhost", keyID, key.Public().(ed25519.PublicKey), signed); err != nil {
+		t.Errorf("want keys signed with the current key: %s", err)
+	}
+	var keys gomatrixserverlib.ServerKeys
+	if err = json.Unmarshal(signed, &keys); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keys.VerifyKeys[keyID].Key, key.Public().(ed25519.PublicKey)) {
+		t.Errorf("want current key %s in verify_keys, got %v", keyID, keys.VerifyKeys)
+	}
+	if old := keys.OldVerifyKeys[oldKeyID]; !bytes.Equal(old.Key, oldKey.Public().(ed25519.PublicKey)) || old.ExpiredTS != 1234 {
+		t.Errorf("want old key %s in old_verify_keys, got %v", oldKeyID, keys.OldVerifyKeys)
+	}
+	if keys.ValidUntilTS != 1500000000000 {
+		t.Errorf("want valid_until_ts 1500000000000, got %d", keys.ValidUntilTS)
+	}
+}
+
+func TestVerifyOwnEventSignature(t *testing.T) {
+	oldKeyID, oldKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey failed: %s", err)
+	}
+	keyID, key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey failed: %s", err)
+	}
+	rotatedAt := time.Unix(1500000000, 0)
+	oldVerifyKeys := []OldVerifyKey{{
+		KeyID:     oldKeyID,
+		PublicKey: oldKey.Public().(ed25519.PublicKey),
+		ExpiredTS: rotatedAt.UnixNano() / int64(time.Millisecond),
+	}}
+
+	build := func(now time.Time, keyID string, key ed25519.PrivateKey) gomatrixserverlib.Event {
+		eb := gomatrixserverlib.EventBuilder{
+			Sender: "@alice:localhost",
+			RoomID: "!room:localhost",
+			Type:   "m.room.message",
+		}
+		if err := eb.SetContent(map[string]string{"body": "hello"}); err != nil {
+			t.Fatal(err)
+		}
+		ev, err := eb.Build("$event:localhost", now, "localhost", keyID, key)
+		if err != nil {
+			t.Fatalf("failed to build event: %s", err)
+		}
+		return ev
+	}
+
+	tests := []struct {
+		name    string
+		event   gomatrixserverlib.Event
+		wantErr bool
+	}{
+		{"current key", build(rotatedAt.Add(time.Hour), keyID, key), false},
+		{"old key before expiry", build(rotatedAt.Add(-time.Hour), oldKeyID, oldKey), false},
+		{"old key after expiry", build(rotatedAt.Add(time.Hour), oldKeyID, oldKey), true},
+		{"unknown key", build(rotatedAt, "ed25519:unknown", oldKey), true},
+	}
+	for _, tt := range tests {
+		err := VerifyOwnEventSignature(tt.event, "localhost", keyID, key, oldVerifyKeys)
+		if tt.wantErr && err == nil {
+			t.Errorf("VerifyOwnEventSignature(%s): want error, got nil", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("VerifyOwnEventSignature(%s): want success, got %s", tt.name, err)
+		}
+	}
+}
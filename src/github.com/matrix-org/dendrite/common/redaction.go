@@ -0,0 +1,43 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+// RedactEvent returns the redacted form of an event, as it should be served to clients once it has
+// been redacted by the given m.room.redaction event. This strips the content keys which aren't
+// needed for authorising events and records the redaction in "unsigned.redacted_because".
+func RedactEvent(event, redactedBecause gomatrixserverlib.Event) (gomatrixserverlib.Event, error) {
+	var eventJSON map[string]json.RawMessage
+	if err := json.Unmarshal(event.Redact().JSON(), &eventJSON); err != nil {
+		return gomatrixserverlib.Event{}, err
+	}
+	unsigned, err := json.Marshal(struct {
+		RedactedBecause json.RawMessage `json:"redacted_because"`
+	}{redactedBecause.JSON()})
+	if err != nil {
+		return gomatrixserverlib.Event{}, err
+	}
+	eventJSON["unsigned"] = unsigned
+	redactedJSON, err := json.Marshal(eventJSON)
+	if err != nil {
+		return gomatrixserverlib.Event{}, err
+	}
+	return gomatrixserverlib.NewEventFromTrustedJSON(redactedJSON, true)
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+func TestRedactEvent(t *testing.T) {
+	event, err := gomatrixserverlib.NewEventFromTrustedJSON([]byte(`{
+		"event_id": "$message:localhost", "room_id": "!room:localhost", "type": "m.room.message",
+		"sender": "@alice:localhost", "origin_server_ts": 1, "depth": 3,
+		"content": {"msgtype": "m.text", "body": "oops"}, "unsigned": {"txn_id": "1"}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redaction, err := gomatrixserverlib.NewEventFromTrustedJSON([]byte(`{
+		"event_id": "$redaction:localhost", "room_id": "!room:localhost", "type": "m.room.redaction",
+		"sender": "@alice:localhost", "origin_server_ts": 2, "depth": 4,
+		"redacts": "$message:localhost", "content": {"reason": "typo"}
+	}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redacted, err := RedactEvent(event, redaction)
+	if err != nil {
+		t.Fatalf("RedactEvent failed: %s", err)
+	}
+	if !redacted.Redacted() {
+		t.Error("want the event to be marked as redacted")
+	}
+	if redacted.EventID() != event.EventID() || redacted.Sender() != event.Sender() {
+		t.Errorf("want the event ID and sender to be kept, got %s", string(redacted.JSON()))
+	}
+	if string(redacted.Content()) != "{}" {
+		t.Errorf("want the content to be pruned, got %s", string(redacted.Content()))
+	}
+	var unsigned struct {
+		RedactedBecause struct {
+			EventID string `json:"event_id"`
+		} `json:"redacted_because"`
+		TxnID string `json:"txn_id"`
+	}
+	if err = json.Unmarshal(redacted.Unsigned(), &unsigned); err != nil {
+		t.Fatalf("failed to parse unsigned: %s", err)
+	}
+	if unsigned.RedactedBecause.EventID != redaction.EventID() {
+		t.Errorf("want redacted_because to be %q, got %s", redaction.EventID(), string(redacted.Unsigned()))
+	}
+	if unsigned.TxnID != "" {
+		t.Errorf("want the other unsigned keys to be removed, got %s", string(redacted.Unsigned()))
+	}
+}
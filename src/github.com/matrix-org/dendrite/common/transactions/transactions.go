@@ -0,0 +1,165 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transactions caches the responses to client requests which carry a transaction ID, so
+// that a client retrying a request gets the original response instead of repeating its effects.
+package transactions
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/matrix-org/util"
+)
+
+// DefaultTTL is how long responses are kept for by default. Clients should retry well within this.
+const DefaultTTL = 30 * time.Minute
+
+// DefaultMaxEntries is how many responses are kept at most by default. Once the cache is full the
+// oldest responses are forgotten first, even if they are younger than the TTL.
+const DefaultMaxEntries = 100000
+
+// Cache holds the responses to requests, keyed on the device which made the request, the
+// transaction ID and the path of the request. Responses are forgotten once they are older than
+// the TTL, or once the cache is full and they are the oldest.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	// now is swapped out in tests.
+	now       func() time.Time
+	mutex     sync.Mutex
+	responses map[txnKey]*list.Element
+	// The cached responses, oldest first.
+	order *list.List
+	// The transactions which have been reserved but don't have a response yet. The channel
+	// is closed when the transaction is added or released.
+	inFlight map[txnKey]chan struct{}
+}
+
+type txnKey struct {
+	userID   string
+	deviceID string
+	txnID    string
+	path     string
+}
+
+type cachedResponse struct {
+	key   txnKey
+	res   util.JSONResponse
+	added time.Time
+}
+
+// New makes an empty Cache which keeps up to maxEntries responses for the given duration.
+func New(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		responses:  map[txnKey]*list.Element{},
+		order:      list.New(),
+		inFlight:   map[txnKey]chan struct{}{},
+	}
+}
+
+// ReserveTransaction returns the response to an earlier request from the same device with the
+// same transaction ID and path, if there was one within the TTL. If there wasn't then the
+// transaction is reserved, and the caller must either add the response with AddTransaction or
+// give up with ReleaseTransaction. Requests for a reserved transaction wait until then rather
+// than being handled concurrently with it.
+func (c *Cache) ReserveTransaction(userID, deviceID, txnID, path string) (*util.JSONResponse, bool) {
+	key := txnKey{userID, deviceID, txnID, path}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for {
+		if res, ok := c.fetch(key); ok {
+			return res, true
+		}
+		done, ok := c.inFlight[key]
+		if !ok {
+			break
+		}
+		c.mutex.Unlock()
+		<-done
+		c.mutex.Lock()
+	}
+	c.inFlight[key] = make(chan struct{})
+	return nil, false
+}
+
+// ReleaseTransaction gives up a reservation made by ReserveTransaction without adding a
+// response, so that the next request for the transaction is handled. Does nothing if the
+// transaction isn't reserved.
+func (c *Cache) ReleaseTransaction(userID, deviceID, txnID, path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.release(txnKey{userID, deviceID, txnID, path})
+}
+
+// AddTransaction stores the response to a request so that it can be returned by
+// ReserveTransaction. Any reservation of the transaction is released.
+func (c *Cache) AddTransaction(userID, deviceID, txnID, path string, res *util.JSONResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	c.prune(now)
+	key := txnKey{userID, deviceID, txnID, path}
+	if elem, ok := c.responses[key]; ok {
+		c.order.Remove(elem)
+	}
+	for c.order.Len() >= c.maxEntries && c.order.Len() > 0 {
+		c.remove(c.order.Front())
+	}
+	c.responses[key] = c.order.PushBack(&cachedResponse{key, *res, now})
+	c.release(key)
+}
+
+func (c *Cache) fetch(key txnKey) (*util.JSONResponse, bool) {
+	elem, ok := c.responses[key]
+	if !ok {
+		return nil, false
+	}
+	cached := elem.Value.(*cachedResponse)
+	if c.now().Sub(cached.added) > c.ttl {
+		return nil, false
+	}
+	res := cached.res
+	return &res, true
+}
+
+func (c *Cache) release(key txnKey) {
+	if done, ok := c.inFlight[key]; ok {
+		close(done)
+		delete(c.inFlight, key)
+	}
+}
+
+// prune removes the responses which are older than the TTL. The responses are in the order
+// they were added, so it stops at the first one which is still young enough.
+func (c *Cache) prune(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if now.Sub(elem.Value.(*cachedResponse).added) <= c.ttl {
+			return
+		}
+		c.remove(elem)
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	delete(c.responses, elem.Value.(*cachedResponse).key)
+	c.order.Remove(elem)
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transactions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matrix-org/util"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestCache(ttl time.Duration, maxEntries int) (*Cache, *fakeClock) {
+	clock := &fakeClock{time.Unix(1500000000, 0)}
+	c := New(ttl, maxEntries)
+	c.now = clock.now
+	return c, clock
+}
+
+func TestCacheFetchesAddedTransaction(t *testing.T) {
+	c, _ := newTestCache(time.Minute, DefaultMaxEntries)
+	path := "/_matrix/client/r0/rooms/!room:localhost/send/m.room.message/1"
+	res := util.JSONResponse{Code: 200, JSON: "$event:localhost"}
+	c.AddTransaction("@alice:localhost", "DEVICE", "1", path, &res)
+
+	got, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", path)
+	if !ok {
+		t.Fatal("want the transaction to be cached, got nothing")
+	}
+	if got.Code != res.Code || got.JSON != res.JSON {
+		t.Errorf("want %+v, got %+v", res, *got)
+	}
+	if _, ok := c.ReserveTransaction("@alice:localhost", "OTHER", "1", path); ok {
+		t.Error("want transactions to be per device, got a cached response")
+	}
+	if _, ok := c.ReserveTransaction("@bob:localhost", "DEVICE", "1", path); ok {
+		t.Error("want transactions to be per user, got a cached response")
+	}
+	if _, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "2", path); ok {
+		t.Error("want transactions to be per transaction ID, got a cached response")
+	}
+	if _, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/_matrix/client/r0/sendToDevice/m.test/1"); ok {
+		t.Error("want transactions to be per path, got a cached response")
+	}
+}
+
+func TestCacheExpiresTransactions(t *testing.T) {
+	c, clock := newTestCache(time.Minute, DefaultMaxEntries)
+	res := util.JSONResponse{Code: 200}
+	c.AddTransaction("@alice:localhost", "DEVICE", "1", "/path", &res)
+	clock.advance(time.Minute)
+	if _, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/path"); !ok {
+		t.Error("want the transaction to be cached until the TTL passes, got nothing")
+	}
+	clock.advance(time.Second)
+	if _, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/path"); ok {
+		t.Error("want the transaction to expire after the TTL, got a cached response")
+	}
+	c.AddTransaction("@alice:localhost", "DEVICE", "2", "/path", &res)
+	if len(c.responses) != 1 {
+		t.Errorf("want expired transactions to be pruned, got %d cached responses", len(c.responses))
+	}
+}
+
+func TestCacheEvictsOldestTransactionsWhenFull(t *testing.T) {
+	c, _ := newTestCache(time.Minute, 2)
+	res := util.JSONResponse{Code: 200}
+	c.AddTransaction("@alice:localhost", "DEVICE", "1", "/path", &res)
+	c.AddTransaction("@alice:localhost", "DEVICE", "2", "/path", &res)
+	c.AddTransaction("@alice:localhost", "DEVICE", "3", "/path", &res)
+	if len(c.responses) != 2 {
+		t.Errorf("want the cache to hold at most 2 responses, got %d", len(c.responses))
+	}
+	if _, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/path"); ok {
+		t.Error("want the oldest transaction to be evicted, got a cached response")
+	}
+	if _, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "3", "/path"); !ok {
+		t.Error("want the newest transaction to be cached, got nothing")
+	}
+}
+
+func TestReserveTransactionWaitsForInFlightRequest(t *testing.T) {
+	c, _ := newTestCache(time.Minute, DefaultMaxEntries)
+	if _, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/path"); ok {
+		t.Fatal("want the first request to reserve the transaction, got a cached response")
+	}
+
+	retried := make(chan *util.JSONResponse)
+	go func() {
+		res, _ := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/path")
+		retried <- res
+	}()
+	select {
+	case <-retried:
+		t.Fatal("want the retry to wait for the first request, got a response")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	res := util.JSONResponse{Code: 200, JSON: "$event:localhost"}
+	c.AddTransaction("@alice:localhost", "DEVICE", "1", "/path", &res)
+	got := <-retried
+	if got == nil || got.JSON != res.JSON {
+		t.Errorf("want the retry to get %+v, got %+v", res, got)
+	}
+}
+
+func TestReleaseTransactionLetsRetryProceed(t *testing.T) {
+	c, _ := newTestCache(time.Minute, DefaultMaxEntries)
+	c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/path")
+
+	retried := make(chan bool)
+	go func() {
+		_, ok := c.ReserveTransaction("@alice:localhost", "DEVICE", "1", "/path")
+		retried <- ok
+	}()
+	c.ReleaseTransaction("@alice:localhost", "DEVICE", "1", "/path")
+	if <-retried {
+		t.Error("want the retry to reserve the released transaction, got a cached response")
+	}
+	if _, ok := c.inFlight[txnKey{"@alice:localhost", "DEVICE", "1", "/path"}]; !ok {
+		t.Error("want the retry to hold the reservation, got none")
+	}
+}
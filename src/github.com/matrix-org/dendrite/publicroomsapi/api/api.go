@@ -0,0 +1,90 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// PublishRoomRequest is a request to PublishRoom
+type PublishRoomRequest struct {
+	// ID of the room to publish in the directory
+	RoomID string `json:"room_id"`
+}
+
+// PublishRoomResponse is a response to PublishRoom
+type PublishRoomResponse struct{}
+
+// PublicRoomsAPI is used by the other components to manage the room directory
+type PublicRoomsAPI interface {
+	// Publish a room in the directory
+	PublishRoom(
+		req *PublishRoomRequest,
+		response *PublishRoomResponse,
+	) error
+}
+
+// PublicRoomsPublishRoomPath is the HTTP path for the PublishRoom API.
+const PublicRoomsPublishRoomPath = "/api/publicrooms/PublishRoom"
+
+// NewPublicRoomsAPIHTTP creates a PublicRoomsAPI implemented by talking to a HTTP POST API.
+// If httpClient is nil then it uses the http.DefaultClient
+func NewPublicRoomsAPIHTTP(publicRoomsURL string, httpClient *http.Client) PublicRoomsAPI {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &httpPublicRoomsAPI{publicRoomsURL, *httpClient}
+}
+
+type httpPublicRoomsAPI struct {
+	publicRoomsURL string
+	httpClient     http.Client
+}
+
+// PublishRoom implements PublicRoomsAPI
+func (h *httpPublicRoomsAPI) PublishRoom(
+	request *PublishRoomRequest,
+	response *PublishRoomResponse,
+) error {
+	apiURL := h.publicRoomsURL + PublicRoomsPublishRoomPath
+	return postJSON(h.httpClient, apiURL, request, response)
+}
+
+func postJSON(httpClient http.Client, apiURL string, request, response interface{}) error {
+	jsonBytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	res, err := httpClient.Post(apiURL, "application/json", bytes.NewReader(jsonBytes))
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != 200 {
+		var errorBody struct {
+			Message string `json:"message"`
+		}
+		if err = json.NewDecoder(res.Body).Decode(&errorBody); err != nil {
+			return err
+		}
+		return fmt.Errorf("api: %d: %s", res.StatusCode, errorBody.Message)
+	}
+	return json.NewDecoder(res.Body).Decode(response)
+}
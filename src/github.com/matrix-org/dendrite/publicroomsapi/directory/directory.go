@@ -0,0 +1,172 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package directory
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/publicroomsapi/api"
+	"github.com/matrix-org/dendrite/publicroomsapi/storage"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-directory-list-room-roomid
+type roomVisibility struct {
+	Visibility string `json:"visibility"`
+}
+
+// GetVisibility implements GET /directory/list/room/{roomID}
+func GetVisibility(
+	req *http.Request, publicRoomsDatabase *storage.PublicRoomsServerDatabase, roomID string,
+) util.JSONResponse {
+	published, found, err := publicRoomsDatabase.GetRoomVisibility(roomID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !found {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room " + roomID + " not found."),
+		}
+	}
+
+	var v roomVisibility
+	if published {
+		v.Visibility = "public"
+	} else {
+		v.Visibility = "private"
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: v,
+	}
+}
+
+// SetVisibility implements PUT /directory/list/room/{roomID}
+func SetVisibility(
+	req *http.Request, publicRoomsDatabase *storage.PublicRoomsServerDatabase,
+	accountDB *accounts.Database, roomID string,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	var v roomVisibility
+	if reqErr := httputil.UnmarshalJSONRequest(req, &v); reqErr != nil {
+		return *reqErr
+	}
+	if v.Visibility != "public" && v.Visibility != "private" {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.BadJSON("visibility must be either 'public' or 'private'"),
+		}
+	}
+
+	membership, err := publicRoomsDatabase.GetMembership(roomID, device.UserID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if membership != "join" {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You must be in the room to change whether it is published"),
+		}
+	}
+	stateEvents, err := publicRoomsDatabase.GetCurrentState(roomID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	allowed, err := canChangeVisibility(stateEvents, device.UserID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !allowed {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You don't have permission to change whether the room is published"),
+		}
+	}
+
+	found, err := publicRoomsDatabase.SetRoomVisibility(roomID, v.Visibility == "public")
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !found {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room " + roomID + " not found."),
+		}
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: struct{}{},
+	}
+}
+
+// PublishRoom implements the internal PublishRoom API, which the client API uses to
+// publish rooms created with a "public" visibility.
+func PublishRoom(req *http.Request, publicRoomsDatabase *storage.PublicRoomsServerDatabase) util.JSONResponse {
+	var request api.PublishRoomRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		return util.ErrorResponse(err)
+	}
+	if err := publicRoomsDatabase.PublishRoom(request.RoomID); err != nil {
+		return util.ErrorResponse(err)
+	}
+	return util.JSONResponse{Code: 200, JSON: &api.PublishRoomResponse{}}
+}
+
+// canChangeVisibility returns whether the user has a high enough power level in the room to
+// send an m.room.canonical_alias event, which is what we require to publish or unpublish it.
+func canChangeVisibility(stateEvents []gomatrixserverlib.Event, userID string) (bool, error) {
+	var creator string
+	for _, ev := range stateEvents {
+		switch ev.Type() {
+		case "m.room.power_levels":
+			// state_default is 50 if the power levels event doesn't set it.
+			content := events.PowerLevelContent{StateDefault: 50}
+			if err := json.Unmarshal(ev.Content(), &content); err != nil {
+				return false, err
+			}
+			userLevel, ok := content.Users[userID]
+			if !ok {
+				userLevel = content.UsersDefault
+			}
+			required, ok := content.Events["m.room.canonical_alias"]
+			if !ok {
+				required = content.StateDefault
+			}
+			return userLevel >= required, nil
+		case "m.room.create":
+			var content events.CreateContent
+			if err := json.Unmarshal(ev.Content(), &content); err != nil {
+				return false, err
+			}
+			creator = content.Creator
+		}
+	}
+	// Without a power levels event only the creator may send state events.
+	return creator == userID, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package directory
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/publicroomsapi/storage"
+	"github.com/matrix-org/dendrite/publicroomsapi/types"
+	"github.com/matrix-org/util"
+)
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#post-matrix-client-r0-publicrooms
+type publicRoomReq struct {
+	Since  string `json:"since,omitempty"`
+	Limit  int64  `json:"limit,omitempty"`
+	Filter filter `json:"filter,omitempty"`
+}
+
+type filter struct {
+	SearchTerms string `json:"generic_search_term,omitempty"`
+}
+
+// https://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-publicrooms
+type publicRoomRes struct {
+	Chunk     []types.PublicRoom `json:"chunk"`
+	NextBatch string             `json:"next_batch,omitempty"`
+	PrevBatch string             `json:"prev_batch,omitempty"`
+	Estimate  int64              `json:"total_room_count_estimate,omitempty"`
+}
+
+// GetPublicRooms implements GET and POST /publicRooms
+func GetPublicRooms(req *http.Request, publicRoomDatabase *storage.PublicRoomsServerDatabase) util.JSONResponse {
+	var request publicRoomReq
+	if fillErr := fillPublicRoomsReq(req, &request); fillErr != nil {
+		return *fillErr
+	}
+
+	// The pagination tokens are the number of rooms to skip.
+	var offset int64
+	if request.Since != "" {
+		var err error
+		offset, err = strconv.ParseInt(request.Since, 10, 64)
+		if err != nil || offset < 0 {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.Unknown("since must be a token returned by a previous request"),
+			}
+		}
+	}
+	if request.Limit < 0 {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.Unknown("limit must not be negative"),
+		}
+	}
+
+	estimate, err := publicRoomDatabase.CountPublicRooms(request.Filter.SearchTerms)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	rooms, err := publicRoomDatabase.GetPublicRooms(offset, request.Limit, request.Filter.SearchTerms)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	response := publicRoomRes{
+		Chunk:    rooms,
+		Estimate: estimate,
+	}
+	if offset > 0 {
+		prev := offset - request.Limit
+		if request.Limit == 0 || prev < 0 {
+			prev = 0
+		}
+		response.PrevBatch = strconv.FormatInt(prev, 10)
+	}
+	if request.Limit > 0 && offset+request.Limit < estimate {
+		response.NextBatch = strconv.FormatInt(offset+request.Limit, 10)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: response,
+	}
+}
+
+// fillPublicRoomsReq fills the request from the query parameters of a GET request
+// or from the body of a POST request.
+func fillPublicRoomsReq(httpReq *http.Request, request *publicRoomReq) *util.JSONResponse {
+	if httpReq.Method == "POST" {
+		return httputil.UnmarshalJSONRequest(httpReq, request)
+	}
+
+	query := httpReq.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if request.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			return &util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.Unknown("limit must be an integer"),
+			}
+		}
+	}
+	request.Since = query.Get("since")
+	return nil
+}
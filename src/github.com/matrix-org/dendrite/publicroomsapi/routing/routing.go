@@ -0,0 +1,58 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/publicroomsapi/api"
+	"github.com/matrix-org/dendrite/publicroomsapi/directory"
+	"github.com/matrix-org/dendrite/publicroomsapi/storage"
+	"github.com/matrix-org/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const pathPrefixR0 = "/_matrix/client/r0"
+
+// Setup configures the given mux with publicroomsapi server listeners
+func Setup(servMux *http.ServeMux, cfg *config.Dendrite, publicRoomsDB *storage.PublicRoomsServerDatabase, accountDB *accounts.Database) {
+	apiMux := mux.NewRouter()
+	r0mux := apiMux.PathPrefix(pathPrefixR0).Subrouter()
+	r0mux.Handle("/directory/list/room/{roomID}", make("directory_list", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return directory.GetVisibility(req, publicRoomsDB, vars["roomID"])
+	}))).Methods("GET")
+	r0mux.Handle("/directory/list/room/{roomID}", make("directory_list_set", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return directory.SetVisibility(req, publicRoomsDB, accountDB, vars["roomID"])
+	}))).Methods("PUT")
+	r0mux.Handle("/publicRooms", make("public_rooms", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return directory.GetPublicRooms(req, publicRoomsDB)
+	}))).Methods("GET", "POST")
+	servMux.Handle(api.PublicRoomsPublishRoomPath, make("publish_room", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		return directory.PublishRoom(req, publicRoomsDB)
+	})))
+	servMux.Handle("/metrics", prometheus.Handler())
+	servMux.Handle("/api/", http.StripPrefix("/api", httputil.TrustProxies(cfg.Listen.TrustedProxyNets, apiMux)))
+}
+
+// make a util.JSONRequestHandler into an http.Handler
+func make(metricsName string, h util.JSONRequestHandler) http.Handler {
+	return prometheus.InstrumentHandler(metricsName, util.MakeJSONAPI(h))
+}
@@ -0,0 +1,293 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	// Import the postgres database driver.
+	_ "github.com/lib/pq"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/publicroomsapi/types"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+// directoryStateTypes are the types of the state events which affect how a room is listed
+// in the directory, or who may change whether it is listed.
+var directoryStateTypes = map[string]bool{
+	"m.room.create":             true,
+	"m.room.member":             true,
+	"m.room.power_levels":       true,
+	"m.room.aliases":            true,
+	"m.room.canonical_alias":    true,
+	"m.room.name":               true,
+	"m.room.topic":              true,
+	"m.room.avatar":             true,
+	"m.room.history_visibility": true,
+	"m.room.guest_access":       true,
+}
+
+// PublicRoomsServerDatabase represents a public rooms server database
+type PublicRoomsServerDatabase struct {
+	db          *sql.DB
+	partitions  common.PartitionOffsetStatements
+	stateEvents roomStateEventsStatements
+	publicRooms publicRoomsStatements
+}
+
+// NewPublicRoomsServerDatabase creates a new public rooms server database
+func NewPublicRoomsServerDatabase(dataSourceName string) (*PublicRoomsServerDatabase, error) {
+	var db *sql.DB
+	var err error
+	if db, err = sql.Open("postgres", dataSourceName); err != nil {
+		return nil, err
+	}
+	partitions := common.PartitionOffsetStatements{}
+	if err = partitions.Prepare(db); err != nil {
+		return nil, err
+	}
+	stateEvents := roomStateEventsStatements{}
+	if err = stateEvents.prepare(db); err != nil {
+		return nil, err
+	}
+	publicRooms := publicRoomsStatements{}
+	if err = publicRooms.prepare(db); err != nil {
+		return nil, err
+	}
+	return &PublicRoomsServerDatabase{db, partitions, stateEvents, publicRooms}, nil
+}
+
+// PartitionOffsets implements common.PartitionStorer
+func (d *PublicRoomsServerDatabase) PartitionOffsets(topic string) ([]common.PartitionOffset, error) {
+	return d.partitions.SelectPartitionOffsets(topic)
+}
+
+// SetPartitionOffset implements common.PartitionStorer
+func (d *PublicRoomsServerDatabase) SetPartitionOffset(topic string, partition int32, offset int64) error {
+	return d.partitions.UpsertPartitionOffset(topic, partition, offset)
+}
+
+// UpdateRoomFromEvent updates the summary of the event's room using the state changes made by the
+// event. Only the state events which affect the directory are stored. If redactedEventID is not empty
+// then the event is an m.room.redaction and the stored copy of the redacted event, if any, is replaced
+// with its redacted form. Returns an error if there was a problem talking to the database.
+func (d *PublicRoomsServerDatabase) UpdateRoomFromEvent(
+	ev *gomatrixserverlib.Event, addStateEventIDs, removeStateEventIDs []string, redactedEventID string,
+) error {
+	return runTransaction(d.db, func(txn *sql.Tx) error {
+		if ev.StateKey() != nil && directoryStateTypes[ev.Type()] {
+			var membership *string
+			if ev.Type() == "m.room.member" {
+				var content events.MemberContent
+				if err := json.Unmarshal(ev.Content(), &content); err != nil {
+					return err
+				}
+				membership = &content.Membership
+			}
+			if err := d.stateEvents.insertRoomStateEvent(txn, ev, membership); err != nil {
+				return err
+			}
+		}
+
+		redacted := false
+		if redactedEventID != "" {
+			var err error
+			if redacted, err = d.redactStateEvent(txn, redactedEventID, ev); err != nil {
+				return err
+			}
+		}
+
+		if len(addStateEventIDs) == 0 && len(removeStateEventIDs) == 0 && !redacted {
+			// The current state of the room hasn't changed.
+			return nil
+		}
+
+		// The added events have all been output by the roomserver before, or are the event itself,
+		// so any of them which affect the directory will already be stored.
+		if err := d.stateEvents.updateIsCurrent(txn, removeStateEventIDs, false); err != nil {
+			return err
+		}
+		if err := d.stateEvents.updateIsCurrent(txn, addStateEventIDs, true); err != nil {
+			return err
+		}
+
+		stateEvents, err := d.stateEvents.selectCurrentState(txn, ev.RoomID())
+		if err != nil {
+			return err
+		}
+		joinedMembers, err := d.stateEvents.selectJoinedMemberCount(txn, ev.RoomID())
+		if err != nil {
+			return err
+		}
+		room := summariseRoom(ev.RoomID(), stateEvents, joinedMembers)
+		return d.publicRooms.upsertRoomSummary(txn, &room)
+	})
+}
+
+// redactStateEvent replaces the stored copy of the redacted event with its redacted form, so that
+// a redacted name or topic is no longer listed. Returns false if the event isn't stored, which is
+// the case for events that don't affect the directory.
+func (d *PublicRoomsServerDatabase) redactStateEvent(
+	txn *sql.Tx, redactedEventID string, redaction *gomatrixserverlib.Event,
+) (bool, error) {
+	target, err := d.stateEvents.selectRoomStateEvent(txn, redactedEventID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	redacted, err := common.RedactEvent(target, *redaction)
+	if err != nil {
+		return false, err
+	}
+	return true, d.stateEvents.updateEventJSON(txn, &redacted)
+}
+
+// GetRoomVisibility returns whether the room is published in the directory.
+// Returns false for found if the room isn't known.
+// Returns an error if there was a problem talking to the database.
+func (d *PublicRoomsServerDatabase) GetRoomVisibility(roomID string) (visibility, found bool, err error) {
+	visibility, err = d.publicRooms.selectRoomVisibility(roomID)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	return visibility, err == nil, err
+}
+
+// SetRoomVisibility publishes or unpublishes the room in the directory.
+// Returns false if the room isn't known.
+func (d *PublicRoomsServerDatabase) SetRoomVisibility(roomID string, visibility bool) (bool, error) {
+	updated, err := d.publicRooms.updateRoomVisibility(roomID, visibility)
+	return updated > 0, err
+}
+
+// PublishRoom publishes the room in the directory. Unlike SetRoomVisibility this works
+// for rooms whose events haven't reached the public rooms server yet, so a room can be
+// published as soon as it is created.
+func (d *PublicRoomsServerDatabase) PublishRoom(roomID string) error {
+	return d.publicRooms.upsertRoomVisibility(roomID, true)
+}
+
+// GetMembership returns the current membership of the user in the room, e.g. "join".
+// Returns an empty string if the user has never been a member of the room.
+func (d *PublicRoomsServerDatabase) GetMembership(roomID, userID string) (string, error) {
+	membership, err := d.stateEvents.selectMembership(roomID, userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return membership, err
+}
+
+// GetCurrentState returns the current state events of the room which affect the directory,
+// excluding membership events.
+func (d *PublicRoomsServerDatabase) GetCurrentState(roomID string) ([]gomatrixserverlib.Event, error) {
+	return d.stateEvents.selectCurrentState(nil, roomID)
+}
+
+// CountPublicRooms returns the number of published rooms whose name, topic or aliases contain
+// the search term. An empty search term matches every published room.
+func (d *PublicRoomsServerDatabase) CountPublicRooms(searchTerm string) (int64, error) {
+	return d.publicRooms.countPublicRooms(likePattern(searchTerm))
+}
+
+// GetPublicRooms returns the published rooms whose name, topic or aliases contain the search
+// term, ordered by the number of joined members. Skips the first offset rooms and returns at
+// most limit rooms. If limit is 0 then all the remaining rooms are returned.
+func (d *PublicRoomsServerDatabase) GetPublicRooms(offset, limit int64, searchTerm string) ([]types.PublicRoom, error) {
+	var limitPtr *int64
+	if limit > 0 {
+		limitPtr = &limit
+	}
+	return d.publicRooms.selectPublicRooms(likePattern(searchTerm), offset, limitPtr)
+}
+
+// summariseRoom builds the directory entry for a room from its current state.
+// Events which can't be parsed are ignored.
+func summariseRoom(roomID string, stateEvents []gomatrixserverlib.Event, joinedMembers int64) types.PublicRoom {
+	room := types.PublicRoom{
+		RoomID:           roomID,
+		Aliases:          []string{},
+		NumJoinedMembers: joinedMembers,
+	}
+	for _, ev := range stateEvents {
+		switch ev.Type() {
+		case "m.room.aliases":
+			var content events.AliasesContent
+			if json.Unmarshal(ev.Content(), &content) == nil {
+				room.Aliases = append(room.Aliases, content.Aliases...)
+			}
+		case "m.room.canonical_alias":
+			var content events.CanonicalAliasContent
+			if json.Unmarshal(ev.Content(), &content) == nil {
+				room.CanonicalAlias = content.Alias
+			}
+		case "m.room.name":
+			var content events.NameContent
+			if json.Unmarshal(ev.Content(), &content) == nil {
+				room.Name = content.Name
+			}
+		case "m.room.topic":
+			var content events.TopicContent
+			if json.Unmarshal(ev.Content(), &content) == nil {
+				room.Topic = content.Topic
+			}
+		case "m.room.avatar":
+			var content events.AvatarContent
+			if json.Unmarshal(ev.Content(), &content) == nil {
+				room.AvatarURL = content.URL
+			}
+		case "m.room.history_visibility":
+			var content events.HistoryVisibilityContent
+			if json.Unmarshal(ev.Content(), &content) == nil {
+				room.WorldReadable = content.HistoryVisibility == "world_readable"
+			}
+		case "m.room.guest_access":
+			var content events.GuestAccessContent
+			if json.Unmarshal(ev.Content(), &content) == nil {
+				room.GuestCanJoin = content.GuestAccess == "can_join"
+			}
+		}
+	}
+	return room
+}
+
+// likePattern returns an ILIKE pattern which matches strings containing the search term.
+func likePattern(searchTerm string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(searchTerm)
+	return "%" + escaped + "%"
+}
+
+func runTransaction(db *sql.DB, fn func(txn *sql.Tx) error) (err error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			txn.Rollback()
+			panic(r)
+		} else if err != nil {
+			txn.Rollback()
+		} else {
+			err = txn.Commit()
+		}
+	}()
+	err = fn(txn)
+	return
+}
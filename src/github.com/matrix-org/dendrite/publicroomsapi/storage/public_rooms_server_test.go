@@ -0,0 +1,79 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/matrix-org/dendrite/publicroomsapi/types"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+func stateEvent(t *testing.T, eventType, stateKey, content string) gomatrixserverlib.Event {
+	eventJSON := fmt.Sprintf(
+		`{"event_id":"$%s:localhost","room_id":"!room:localhost","type":%q,"state_key":%q,"sender":"@alice:localhost","content":%s}`,
+		eventType, eventType, stateKey, content,
+	)
+	ev, err := gomatrixserverlib.NewEventFromTrustedJSON([]byte(eventJSON), false)
+	if err != nil {
+		t.Fatalf("failed to create event: %s", err)
+	}
+	return ev
+}
+
+func TestSummariseRoom(t *testing.T) {
+	stateEvents := []gomatrixserverlib.Event{
+		stateEvent(t, "m.room.create", "", `{"creator":"@alice:localhost"}`),
+		stateEvent(t, "m.room.aliases", "localhost", `{"aliases":["#room:localhost","#other:localhost"]}`),
+		stateEvent(t, "m.room.canonical_alias", "", `{"alias":"#room:localhost"}`),
+		stateEvent(t, "m.room.name", "", `{"name":"The Room"}`),
+		stateEvent(t, "m.room.topic", "", `{"topic":"Things"}`),
+		stateEvent(t, "m.room.avatar", "", `{"url":"mxc://localhost/avatar"}`),
+		stateEvent(t, "m.room.history_visibility", "", `{"history_visibility":"world_readable"}`),
+		stateEvent(t, "m.room.guest_access", "", `{"guest_access":"forbidden"}`),
+	}
+	want := types.PublicRoom{
+		RoomID:           "!room:localhost",
+		Aliases:          []string{"#room:localhost", "#other:localhost"},
+		CanonicalAlias:   "#room:localhost",
+		Name:             "The Room",
+		Topic:            "Things",
+		AvatarURL:        "mxc://localhost/avatar",
+		NumJoinedMembers: 3,
+		WorldReadable:    true,
+		GuestCanJoin:     false,
+	}
+	got := summariseRoom("!room:localhost", stateEvents, 3)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	tests := map[string]string{
+		"":           "%%",
+		"matrix":     "%matrix%",
+		"100%":       `%100\%%`,
+		"a_b":        `%a\_b%`,
+		`back\slash`: `%back\\slash%`,
+	}
+	for searchTerm, want := range tests {
+		if got := likePattern(searchTerm); got != want {
+			t.Errorf("likePattern(%q): want %q, got %q", searchTerm, want, got)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/matrix-org/dendrite/publicroomsapi/types"
+)
+
+const publicRoomsSchema = `
+-- Stores a summary of every room the server knows about, for listing in the room directory.
+CREATE TABLE IF NOT EXISTS public_rooms (
+    -- The room ID.
+    room_id TEXT NOT NULL PRIMARY KEY,
+    -- Whether the room has been published in the directory.
+    visibility BOOLEAN NOT NULL DEFAULT FALSE,
+    -- The number of users currently joined to the room.
+    joined_members BIGINT NOT NULL DEFAULT 0,
+    -- The aliases of the room, taken from the m.room.aliases events.
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    -- The 'content.alias' value of the m.room.canonical_alias event, or ''.
+    canonical_alias TEXT NOT NULL DEFAULT '',
+    -- The 'content.name' value of the m.room.name event, or ''.
+    name TEXT NOT NULL DEFAULT '',
+    -- The 'content.topic' value of the m.room.topic event, or ''.
+    topic TEXT NOT NULL DEFAULT '',
+    -- The 'content.url' value of the m.room.avatar event, or ''.
+    avatar_url TEXT NOT NULL DEFAULT '',
+    -- Whether the history visibility of the room is 'world_readable'.
+    world_readable BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Whether the guest access of the room is 'can_join'.
+    guest_can_join BOOLEAN NOT NULL DEFAULT FALSE
+);
+-- for listing the published rooms, largest first
+CREATE INDEX IF NOT EXISTS public_rooms_joined_members_idx ON public_rooms(joined_members DESC, room_id) WHERE visibility;
+`
+
+const upsertRoomSummarySQL = "" +
+	"INSERT INTO public_rooms (room_id, joined_members, aliases, canonical_alias, name, topic, avatar_url, world_readable, guest_can_join)" +
+	" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)" +
+	" ON CONFLICT (room_id) DO UPDATE SET joined_members = $2, aliases = $3, canonical_alias = $4," +
+	" name = $5, topic = $6, avatar_url = $7, world_readable = $8, guest_can_join = $9"
+
+const updateRoomVisibilitySQL = "" +
+	"UPDATE public_rooms SET visibility = $2 WHERE room_id = $1"
+
+const upsertRoomVisibilitySQL = "" +
+	"INSERT INTO public_rooms (room_id, visibility) VALUES ($1, $2)" +
+	" ON CONFLICT (room_id) DO UPDATE SET visibility = $2"
+
+const selectRoomVisibilitySQL = "" +
+	"SELECT visibility FROM public_rooms WHERE room_id = $1"
+
+// The search term is a LIKE pattern which is matched against the names, topics and aliases of the rooms.
+const publicRoomsFilterSQL = "" +
+	" WHERE visibility AND (name ILIKE $1 OR topic ILIKE $1 OR canonical_alias ILIKE $1" +
+	" OR array_to_string(aliases, ' ') ILIKE $1)"
+
+const countPublicRoomsSQL = "" +
+	"SELECT COUNT(*) FROM public_rooms" + publicRoomsFilterSQL
+
+const selectPublicRoomsSQL = "" +
+	"SELECT room_id, joined_members, aliases, canonical_alias, name, topic, avatar_url, world_readable, guest_can_join" +
+	" FROM public_rooms" + publicRoomsFilterSQL +
+	" ORDER BY joined_members DESC, room_id ASC OFFSET $2 LIMIT $3"
+
+type publicRoomsStatements struct {
+	upsertRoomSummaryStmt    *sql.Stmt
+	updateRoomVisibilityStmt *sql.Stmt
+	upsertRoomVisibilityStmt *sql.Stmt
+	selectRoomVisibilityStmt *sql.Stmt
+	countPublicRoomsStmt     *sql.Stmt
+	selectPublicRoomsStmt    *sql.Stmt
+}
+
+func (s *publicRoomsStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(publicRoomsSchema)
+	if err != nil {
+		return
+	}
+	if s.upsertRoomSummaryStmt, err = db.Prepare(upsertRoomSummarySQL); err != nil {
+		return
+	}
+	if s.updateRoomVisibilityStmt, err = db.Prepare(updateRoomVisibilitySQL); err != nil {
+		return
+	}
+	if s.upsertRoomVisibilityStmt, err = db.Prepare(upsertRoomVisibilitySQL); err != nil {
+		return
+	}
+	if s.selectRoomVisibilityStmt, err = db.Prepare(selectRoomVisibilitySQL); err != nil {
+		return
+	}
+	if s.countPublicRoomsStmt, err = db.Prepare(countPublicRoomsSQL); err != nil {
+		return
+	}
+	if s.selectPublicRoomsStmt, err = db.Prepare(selectPublicRoomsSQL); err != nil {
+		return
+	}
+	return
+}
+
+// upsertRoomSummary stores the summary of a room, leaving its visibility unchanged.
+// Rooms which weren't known before are not published.
+func (s *publicRoomsStatements) upsertRoomSummary(txn *sql.Tx, room *types.PublicRoom) error {
+	_, err := txn.Stmt(s.upsertRoomSummaryStmt).Exec(
+		room.RoomID, room.NumJoinedMembers, pq.StringArray(room.Aliases), room.CanonicalAlias,
+		room.Name, room.Topic, room.AvatarURL, room.WorldReadable, room.GuestCanJoin,
+	)
+	return err
+}
+
+// updateRoomVisibility publishes or unpublishes the room. Returns the number of rooms updated,
+// which is 0 if the room isn't known.
+func (s *publicRoomsStatements) updateRoomVisibility(roomID string, visibility bool) (int64, error) {
+	res, err := s.updateRoomVisibilityStmt.Exec(roomID, visibility)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// upsertRoomVisibility publishes or unpublishes the room, adding it if it isn't known yet.
+func (s *publicRoomsStatements) upsertRoomVisibility(roomID string, visibility bool) error {
+	_, err := s.upsertRoomVisibilityStmt.Exec(roomID, visibility)
+	return err
+}
+
+// selectRoomVisibility returns whether the room is published.
+// Returns sql.ErrNoRows if the room isn't known.
+func (s *publicRoomsStatements) selectRoomVisibility(roomID string) (visibility bool, err error) {
+	err = s.selectRoomVisibilityStmt.QueryRow(roomID).Scan(&visibility)
+	return
+}
+
+// countPublicRooms returns the number of published rooms matching the pattern.
+func (s *publicRoomsStatements) countPublicRooms(pattern string) (count int64, err error) {
+	err = s.countPublicRoomsStmt.QueryRow(pattern).Scan(&count)
+	return
+}
+
+// selectPublicRooms returns the published rooms matching the pattern, largest first.
+// If limit is nil then all the rooms after the offset are returned.
+func (s *publicRoomsStatements) selectPublicRooms(pattern string, offset int64, limit *int64) ([]types.PublicRoom, error) {
+	rows, err := s.selectPublicRoomsStmt.Query(pattern, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rooms := []types.PublicRoom{}
+	for rows.Next() {
+		var room types.PublicRoom
+		var aliases pq.StringArray
+		if err := rows.Scan(
+			&room.RoomID, &room.NumJoinedMembers, &aliases, &room.CanonicalAlias,
+			&room.Name, &room.Topic, &room.AvatarURL, &room.WorldReadable, &room.GuestCanJoin,
+		); err != nil {
+			return nil, err
+		}
+		room.Aliases = aliases
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
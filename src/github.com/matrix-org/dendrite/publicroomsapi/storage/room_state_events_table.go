@@ -0,0 +1,182 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+const roomStateEventsSchema = `
+-- Stores the state events which affect how rooms are listed in the directory,
+-- along with whether each event is part of the current state of its room.
+CREATE TABLE IF NOT EXISTS room_state_events (
+    -- The state event ID
+    event_id TEXT NOT NULL PRIMARY KEY,
+    -- The 'room_id' key for the state event.
+    room_id TEXT NOT NULL,
+    -- The state event type e.g 'm.room.name'
+    type TEXT NOT NULL,
+    -- The state_key value for this state event e.g ''
+    state_key TEXT NOT NULL,
+    -- The 'content.membership' value if this event is an m.room.member event. For other
+    -- events, this will be NULL.
+    membership TEXT,
+    -- The JSON for the event. Stored as TEXT because this should be valid UTF-8.
+    event_json TEXT NOT NULL,
+    -- Whether this event is part of the current state of the room.
+    is_current BOOLEAN NOT NULL DEFAULT FALSE
+);
+-- for looking up the current state of a room
+CREATE INDEX IF NOT EXISTS room_state_events_current_idx ON room_state_events(room_id, type, state_key) WHERE is_current;
+`
+
+const insertRoomStateEventSQL = "" +
+	"INSERT INTO room_state_events (event_id, room_id, type, state_key, membership, event_json)" +
+	" VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (event_id) DO NOTHING"
+
+const selectRoomStateEventSQL = "" +
+	"SELECT event_json FROM room_state_events WHERE event_id = $1"
+
+const updateEventJSONSQL = "" +
+	"UPDATE room_state_events SET event_json = $2 WHERE event_id = $1"
+
+const updateIsCurrentSQL = "" +
+	"UPDATE room_state_events SET is_current = $2 WHERE event_id = ANY($1)"
+
+const selectCurrentStateSQL = "" +
+	"SELECT event_json FROM room_state_events" +
+	" WHERE room_id = $1 AND is_current AND type != 'm.room.member'"
+
+const selectJoinedMemberCountSQL = "" +
+	"SELECT COUNT(*) FROM room_state_events" +
+	" WHERE room_id = $1 AND is_current AND type = 'm.room.member' AND membership = 'join'"
+
+const selectMembershipSQL = "" +
+	"SELECT membership FROM room_state_events" +
+	" WHERE room_id = $1 AND is_current AND type = 'm.room.member' AND state_key = $2"
+
+type roomStateEventsStatements struct {
+	insertRoomStateEventStmt    *sql.Stmt
+	selectRoomStateEventStmt    *sql.Stmt
+	updateEventJSONStmt         *sql.Stmt
+	updateIsCurrentStmt         *sql.Stmt
+	selectCurrentStateStmt      *sql.Stmt
+	selectJoinedMemberCountStmt *sql.Stmt
+	selectMembershipStmt        *sql.Stmt
+}
+
+func (s *roomStateEventsStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(roomStateEventsSchema)
+	if err != nil {
+		return
+	}
+	if s.insertRoomStateEventStmt, err = db.Prepare(insertRoomStateEventSQL); err != nil {
+		return
+	}
+	if s.selectRoomStateEventStmt, err = db.Prepare(selectRoomStateEventSQL); err != nil {
+		return
+	}
+	if s.updateEventJSONStmt, err = db.Prepare(updateEventJSONSQL); err != nil {
+		return
+	}
+	if s.updateIsCurrentStmt, err = db.Prepare(updateIsCurrentSQL); err != nil {
+		return
+	}
+	if s.selectCurrentStateStmt, err = db.Prepare(selectCurrentStateSQL); err != nil {
+		return
+	}
+	if s.selectJoinedMemberCountStmt, err = db.Prepare(selectJoinedMemberCountSQL); err != nil {
+		return
+	}
+	if s.selectMembershipStmt, err = db.Prepare(selectMembershipSQL); err != nil {
+		return
+	}
+	return
+}
+
+// insertRoomStateEvent stores a state event which isn't yet part of the current state.
+// Does nothing if the event is already stored.
+func (s *roomStateEventsStatements) insertRoomStateEvent(txn *sql.Tx, event *gomatrixserverlib.Event, membership *string) error {
+	_, err := txn.Stmt(s.insertRoomStateEventStmt).Exec(
+		event.EventID(), event.RoomID(), event.Type(), *event.StateKey(), membership, event.JSON(),
+	)
+	return err
+}
+
+// selectRoomStateEvent returns the stored state event with the given ID.
+// Returns sql.ErrNoRows if the event isn't stored.
+func (s *roomStateEventsStatements) selectRoomStateEvent(txn *sql.Tx, eventID string) (gomatrixserverlib.Event, error) {
+	var eventBytes []byte
+	if err := txn.Stmt(s.selectRoomStateEventStmt).QueryRow(eventID).Scan(&eventBytes); err != nil {
+		return gomatrixserverlib.Event{}, err
+	}
+	return gomatrixserverlib.NewEventFromTrustedJSON(eventBytes, false)
+}
+
+// updateEventJSON replaces the JSON of a stored state event with the JSON of the given event,
+// which must have the same event ID. This is used to store the redacted form of events.
+func (s *roomStateEventsStatements) updateEventJSON(txn *sql.Tx, event *gomatrixserverlib.Event) error {
+	_, err := txn.Stmt(s.updateEventJSONStmt).Exec(event.EventID(), event.JSON())
+	return err
+}
+
+// updateIsCurrent marks the given events as being part of the current state or not.
+// Event IDs which aren't stored are ignored.
+func (s *roomStateEventsStatements) updateIsCurrent(txn *sql.Tx, eventIDs []string, isCurrent bool) error {
+	_, err := txn.Stmt(s.updateIsCurrentStmt).Exec(pq.StringArray(eventIDs), isCurrent)
+	return err
+}
+
+// selectCurrentState returns the current state events of the room, excluding membership events.
+func (s *roomStateEventsStatements) selectCurrentState(txn *sql.Tx, roomID string) ([]gomatrixserverlib.Event, error) {
+	stmt := s.selectCurrentStateStmt
+	if txn != nil {
+		stmt = txn.Stmt(stmt)
+	}
+	rows, err := stmt.Query(roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []gomatrixserverlib.Event
+	for rows.Next() {
+		var eventBytes []byte
+		if err := rows.Scan(&eventBytes); err != nil {
+			return nil, err
+		}
+		ev, err := gomatrixserverlib.NewEventFromTrustedJSON(eventBytes, false)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ev)
+	}
+	return result, rows.Err()
+}
+
+// selectJoinedMemberCount returns the number of users currently joined to the room.
+func (s *roomStateEventsStatements) selectJoinedMemberCount(txn *sql.Tx, roomID string) (count int64, err error) {
+	err = txn.Stmt(s.selectJoinedMemberCountStmt).QueryRow(roomID).Scan(&count)
+	return
+}
+
+// selectMembership returns the current membership of the user in the room.
+// Returns sql.ErrNoRows if the user has no membership event in the room.
+func (s *roomStateEventsStatements) selectMembership(roomID, userID string) (membership string, err error) {
+	err = s.selectMembershipStmt.QueryRow(roomID, userID).Scan(&membership)
+	return
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alias
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RoomserverAliasAPIDatabase has the storage APIs needed to implement the alias API.
+type RoomserverAliasAPIDatabase interface {
+	// Save a given room alias with the room ID it refers to and the user who created it.
+	// Returns false if the alias already refers to a room.
+	// Returns an error if there was a problem talking to the database.
+	SetRoomAlias(alias, roomID, creatorID string) (bool, error)
+	// Lookup the room ID a given alias refers to, and the user who created the alias.
+	// Returns empty strings if the alias isn't known.
+	// Returns an error if there was a problem talking to the database.
+	GetRoomIDFromAlias(alias string) (roomID, creatorID string, err error)
+	// Lookup all aliases referring to a given room ID.
+	// Returns an error if there was a problem talking to the database.
+	GetAliasesFromRoomID(roomID string) ([]string, error)
+	// Remove a given room alias.
+	// Returns an error if there was a problem talking to the database.
+	RemoveRoomAlias(alias string) error
+}
+
+// RoomserverAliasAPI is an implementation of api.RoomserverAliasAPI
+type RoomserverAliasAPI struct {
+	DB RoomserverAliasAPIDatabase
+}
+
+// SetRoomAlias implements api.RoomserverAliasAPI
+func (r *RoomserverAliasAPI) SetRoomAlias(
+	request *api.SetRoomAliasRequest,
+	response *api.SetRoomAliasResponse,
+) error {
+	inserted, err := r.DB.SetRoomAlias(request.Alias, request.RoomID, request.UserID)
+	if err != nil {
+		return err
+	}
+	response.AliasExists = !inserted
+	return nil
+}
+
+// GetAliasRoomID implements api.RoomserverAliasAPI
+func (r *RoomserverAliasAPI) GetAliasRoomID(
+	request *api.GetAliasRoomIDRequest,
+	response *api.GetAliasRoomIDResponse,
+) (err error) {
+	response.RoomID, response.CreatorID, err = r.DB.GetRoomIDFromAlias(request.Alias)
+	return
+}
+
+// GetAliasesForRoomID implements api.RoomserverAliasAPI
+func (r *RoomserverAliasAPI) GetAliasesForRoomID(
+	request *api.GetAliasesForRoomIDRequest,
+	response *api.GetAliasesForRoomIDResponse,
+) (err error) {
+	response.Aliases, err = r.DB.GetAliasesFromRoomID(request.RoomID)
+	return
+}
+
+// RemoveRoomAlias implements api.RoomserverAliasAPI
+func (r *RoomserverAliasAPI) RemoveRoomAlias(
+	request *api.RemoveRoomAliasRequest,
+	response *api.RemoveRoomAliasResponse,
+) error {
+	return r.DB.RemoveRoomAlias(request.Alias)
+}
+
+// SetupHTTP adds the RoomserverAliasAPI handlers to the http.ServeMux.
+func (r *RoomserverAliasAPI) SetupHTTP(servMux *http.ServeMux) {
+	servMux.Handle(
+		api.RoomserverSetRoomAliasPath,
+		makeAPI("set_room_alias", func(req *http.Request) util.JSONResponse {
+			var request api.SetRoomAliasRequest
+			var response api.SetRoomAliasResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.SetRoomAlias(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+	servMux.Handle(
+		api.RoomserverGetAliasRoomIDPath,
+		makeAPI("get_alias_room_id", func(req *http.Request) util.JSONResponse {
+			var request api.GetAliasRoomIDRequest
+			var response api.GetAliasRoomIDResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.GetAliasRoomID(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+	servMux.Handle(
+		api.RoomserverGetAliasesForRoomIDPath,
+		makeAPI("get_aliases_for_room_id", func(req *http.Request) util.JSONResponse {
+			var request api.GetAliasesForRoomIDRequest
+			var response api.GetAliasesForRoomIDResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.GetAliasesForRoomID(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+	servMux.Handle(
+		api.RoomserverRemoveRoomAliasPath,
+		makeAPI("remove_room_alias", func(req *http.Request) util.JSONResponse {
+			var request api.RemoveRoomAliasRequest
+			var response api.RemoveRoomAliasResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.RemoveRoomAlias(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+}
+
+func makeAPI(metric string, apiFunc func(req *http.Request) util.JSONResponse) http.Handler {
+	return prometheus.InstrumentHandler(metric, util.MakeJSONAPI(util.NewJSONRequestHandler(apiFunc)))
+}
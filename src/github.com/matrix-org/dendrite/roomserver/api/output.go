@@ -43,6 +43,10 @@ type OutputRoomEvent struct {
 	// If the LastSentEventID doesn't match what they were expecting it to be
 	// they can use the LatestEventIDs to request the full current state.
 	LastSentEventID string
+	// If the event is an m.room.redaction which was allowed to redact its target then this
+	// is the ID of the redacted event. Consumers should replace their copy of that event
+	// with the redacted form, see common.RedactEvent.
+	RedactedEventID string
 }
 
 // UnmarshalJSON implements json.Unmarshaller
@@ -58,6 +62,7 @@ func (ore *OutputRoomEvent) UnmarshalJSON(data []byte) error {
 		AddsStateEventIDs    []string
 		RemovesStateEventIDs []string
 		LastSentEventID      string
+		RedactedEventID      string
 	}
 	if err := json.Unmarshal(data, &content); err != nil {
 		return err
@@ -70,6 +75,7 @@ func (ore *OutputRoomEvent) UnmarshalJSON(data []byte) error {
 	ore.AddsStateEventIDs = content.AddsStateEventIDs
 	ore.RemovesStateEventIDs = content.RemovesStateEventIDs
 	ore.LastSentEventID = content.LastSentEventID
+	ore.RedactedEventID = content.RedactedEventID
 	return nil
 }
 
@@ -80,6 +86,7 @@ func (ore OutputRoomEvent) MarshalJSON() ([]byte, error) {
 	// We use json.RawMessage so that the event JSON is sent as JSON rather than
 	// being base64 encoded which is the default for []byte.
 	event := json.RawMessage(ore.Event)
+	// RedactedEventID is left out when empty so that the output for other events is unchanged.
 	content := struct {
 		Event                *json.RawMessage
 		VisibilityEventIDs   []string
@@ -87,6 +94,7 @@ func (ore OutputRoomEvent) MarshalJSON() ([]byte, error) {
 		AddsStateEventIDs    []string
 		RemovesStateEventIDs []string
 		LastSentEventID      string
+		RedactedEventID      string `json:",omitempty"`
 	}{
 		Event:                &event,
 		VisibilityEventIDs:   ore.VisibilityEventIDs,
@@ -94,6 +102,7 @@ func (ore OutputRoomEvent) MarshalJSON() ([]byte, error) {
 		AddsStateEventIDs:    ore.AddsStateEventIDs,
 		RemovesStateEventIDs: ore.RemovesStateEventIDs,
 		LastSentEventID:      ore.LastSentEventID,
+		RedactedEventID:      ore.RedactedEventID,
 	}
 	return json.Marshal(&content)
 }
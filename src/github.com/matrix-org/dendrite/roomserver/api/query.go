@@ -44,6 +44,112 @@ type QueryLatestEventsAndStateResponse struct {
 	StateEvents []gomatrixserverlib.Event
 }
 
+// QueryEventsByIDRequest is a request to QueryEventsByID
+type QueryEventsByIDRequest struct {
+	// The event IDs to look up.
+	EventIDs []string
+}
+
+// QueryEventsByIDResponse is a response to QueryEventsByID
+type QueryEventsByIDResponse struct {
+	// Copy of the request for debugging.
+	QueryEventsByIDRequest
+	// The events requested, in the order they were requested.
+	// Events which the room server doesn't know about are omitted.
+	Events []gomatrixserverlib.Event
+}
+
+// QueryStateForUserRequest is a request to QueryStateForUser
+type QueryStateForUserRequest struct {
+	// The room ID to query the state of.
+	RoomID string
+	// The user asking for the state. If the user is joined to the room then the current state
+	// is returned. If the user has left or been banned then the state when they left is returned.
+	UserID string
+	// The state key tuples to fetch from the room state.
+	// If this list is empty or nil then the full state is returned.
+	StateToFetch []gomatrixserverlib.StateKeyTuple
+}
+
+// QueryStateForUserResponse is a response to QueryStateForUser
+type QueryStateForUserResponse struct {
+	// Copy of the request for debugging.
+	QueryStateForUserRequest
+	// Does the room exist?
+	// If the room doesn't exist this will be false and StateEvents will be empty.
+	RoomExists bool
+	// Is the user joined to the room, or have they left or been banned from it?
+	// If not then this will be false and StateEvents will be empty.
+	HasBeenInRoom bool
+	// The state events requested.
+	StateEvents []gomatrixserverlib.Event
+}
+
+// QueryMembershipsForRoomRequest is a request to QueryMembershipsForRoom
+type QueryMembershipsForRoomRequest struct {
+	// The room ID to query the members of.
+	RoomID string
+	// The user asking for the members. If the user is joined to the room then the current members
+	// are returned. If the user has left or been banned then the members when they left are returned.
+	UserID string
+	// If not empty then the members after this event are returned instead, provided the
+	// event is in the room and is not after the user left.
+	AtEventID string
+}
+
+// QueryMembershipsForRoomResponse is a response to QueryMembershipsForRoom
+type QueryMembershipsForRoomResponse struct {
+	// Copy of the request for debugging.
+	QueryMembershipsForRoomRequest
+	// Does the room exist?
+	// If the room doesn't exist this will be false and MemberEvents will be empty.
+	RoomExists bool
+	// Is the user joined to the room, or have they left or been banned from it?
+	// If not then this will be false and MemberEvents will be empty.
+	HasBeenInRoom bool
+	// The m.room.member events in the room state, one for each user with a membership.
+	MemberEvents []gomatrixserverlib.Event
+}
+
+// QueryEventsVisibleToUserRequest is a request to QueryEventsVisibleToUser
+type QueryEventsVisibleToUserRequest struct {
+	// The user to check the visibility of the events for.
+	UserID string
+	// The IDs of the events to check. Events which the room server doesn't know about aren't visible.
+	EventIDs []string
+}
+
+// QueryEventsVisibleToUserResponse is a response to QueryEventsVisibleToUser
+type QueryEventsVisibleToUserResponse struct {
+	// Copy of the request for debugging.
+	QueryEventsVisibleToUserRequest
+	// The IDs of the requested events which the user is allowed to see given the
+	// m.room.history_visibility of the room, in the order they were requested.
+	VisibleEventIDs []string
+}
+
+// QueryStateAtEventRequest is a request to QueryStateAtEvent
+type QueryStateAtEventRequest struct {
+	// The user asking for the state. The state is only returned if the user can see the event.
+	UserID string
+	// The ID of the event to return the room state at.
+	EventID string
+}
+
+// QueryStateAtEventResponse is a response to QueryStateAtEvent
+type QueryStateAtEventResponse struct {
+	// Copy of the request for debugging.
+	QueryStateAtEventRequest
+	// Does the room server know about the event?
+	// If not then this will be false and StateEvents will be empty.
+	EventExists bool
+	// Is the user allowed to see the event given the m.room.history_visibility of the room?
+	// If not then this will be false and StateEvents will be empty.
+	VisibleToUser bool
+	// The state events in the room before the event.
+	StateEvents []gomatrixserverlib.Event
+}
+
 // RoomserverQueryAPI is used to query information from the room server.
 type RoomserverQueryAPI interface {
 	// Query the latest events and state for a room from the room server.
@@ -51,11 +157,56 @@ type RoomserverQueryAPI interface {
 		request *QueryLatestEventsAndStateRequest,
 		response *QueryLatestEventsAndStateResponse,
 	) error
+
+	// Query a list of events by their event ID.
+	QueryEventsByID(
+		request *QueryEventsByIDRequest,
+		response *QueryEventsByIDResponse,
+	) error
+
+	// Query the state of a room which a user is allowed to see.
+	QueryStateForUser(
+		request *QueryStateForUserRequest,
+		response *QueryStateForUserResponse,
+	) error
+
+	// Query the membership events of a room which a user is allowed to see.
+	QueryMembershipsForRoom(
+		request *QueryMembershipsForRoomRequest,
+		response *QueryMembershipsForRoomResponse,
+	) error
+
+	// Query which of a list of events a user is allowed to see.
+	QueryEventsVisibleToUser(
+		request *QueryEventsVisibleToUserRequest,
+		response *QueryEventsVisibleToUserResponse,
+	) error
+
+	// Query the state of the room before an event, if the user is allowed to see the event.
+	QueryStateAtEvent(
+		request *QueryStateAtEventRequest,
+		response *QueryStateAtEventResponse,
+	) error
 }
 
 // RoomserverQueryLatestEventsAndStatePath is the HTTP path for the QueryLatestEventsAndState API.
 const RoomserverQueryLatestEventsAndStatePath = "/api/roomserver/QueryLatestEventsAndState"
 
+// RoomserverQueryEventsByIDPath is the HTTP path for the QueryEventsByID API.
+const RoomserverQueryEventsByIDPath = "/api/roomserver/QueryEventsByID"
+
+// RoomserverQueryStateForUserPath is the HTTP path for the QueryStateForUser API.
+const RoomserverQueryStateForUserPath = "/api/roomserver/QueryStateForUser"
+
+// RoomserverQueryMembershipsForRoomPath is the HTTP path for the QueryMembershipsForRoom API.
+const RoomserverQueryMembershipsForRoomPath = "/api/roomserver/QueryMembershipsForRoom"
+
+// RoomserverQueryEventsVisibleToUserPath is the HTTP path for the QueryEventsVisibleToUser API.
+const RoomserverQueryEventsVisibleToUserPath = "/api/roomserver/QueryEventsVisibleToUser"
+
+// RoomserverQueryStateAtEventPath is the HTTP path for the QueryStateAtEvent API.
+const RoomserverQueryStateAtEventPath = "/api/roomserver/QueryStateAtEvent"
+
 // NewRoomserverQueryAPIHTTP creates a RoomserverQueryAPI implemented by talking to a HTTP POST API.
 // If httpClient is nil then it uses the http.DefaultClient
 func NewRoomserverQueryAPIHTTP(roomserverURL string, httpClient *http.Client) RoomserverQueryAPI {
@@ -79,6 +230,51 @@ func (h *httpRoomserverQueryAPI) QueryLatestEventsAndState(
 	return postJSON(h.httpClient, apiURL, request, response)
 }
 
+// QueryEventsByID implements RoomserverQueryAPI
+func (h *httpRoomserverQueryAPI) QueryEventsByID(
+	request *QueryEventsByIDRequest,
+	response *QueryEventsByIDResponse,
+) error {
+	apiURL := h.roomserverURL + RoomserverQueryEventsByIDPath
+	return postJSON(h.httpClient, apiURL, request, response)
+}
+
+// QueryStateForUser implements RoomserverQueryAPI
+func (h *httpRoomserverQueryAPI) QueryStateForUser(
+	request *QueryStateForUserRequest,
+	response *QueryStateForUserResponse,
+) error {
+	apiURL := h.roomserverURL + RoomserverQueryStateForUserPath
+	return postJSON(h.httpClient, apiURL, request, response)
+}
+
+// QueryMembershipsForRoom implements RoomserverQueryAPI
+func (h *httpRoomserverQueryAPI) QueryMembershipsForRoom(
+	request *QueryMembershipsForRoomRequest,
+	response *QueryMembershipsForRoomResponse,
+) error {
+	apiURL := h.roomserverURL + RoomserverQueryMembershipsForRoomPath
+	return postJSON(h.httpClient, apiURL, request, response)
+}
+
+// QueryEventsVisibleToUser implements RoomserverQueryAPI
+func (h *httpRoomserverQueryAPI) QueryEventsVisibleToUser(
+	request *QueryEventsVisibleToUserRequest,
+	response *QueryEventsVisibleToUserResponse,
+) error {
+	apiURL := h.roomserverURL + RoomserverQueryEventsVisibleToUserPath
+	return postJSON(h.httpClient, apiURL, request, response)
+}
+
+// QueryStateAtEvent implements RoomserverQueryAPI
+func (h *httpRoomserverQueryAPI) QueryStateAtEvent(
+	request *QueryStateAtEventRequest,
+	response *QueryStateAtEventResponse,
+) error {
+	apiURL := h.roomserverURL + RoomserverQueryStateAtEventPath
+	return postJSON(h.httpClient, apiURL, request, response)
+}
+
 func postJSON(httpClient http.Client, apiURL string, request, response interface{}) error {
 	jsonBytes, err := json.Marshal(request)
 	if err != nil {
@@ -18,10 +18,13 @@ package input
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync/atomic"
 
 	"github.com/matrix-org/dendrite/common"
 	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/gomatrixserverlib"
+	"golang.org/x/crypto/ed25519"
 	sarama "gopkg.in/Shopify/sarama.v1"
 )
 
@@ -50,6 +53,13 @@ type Consumer struct {
 	// The kafkaesque topic to output new room events to.
 	// This is the name used in kafka to identify the stream to write events to.
 	OutputRoomEventTopic string
+	// The name of this server and the keys it signs events with. Events sent by local users must be
+	// signed with the current key, or with an old key which hadn't expired when the event was sent.
+	// If ServerName is empty then no signatures are checked.
+	ServerName    string
+	KeyID         string
+	PrivateKey    ed25519.PrivateKey
+	OldVerifyKeys []common.OldVerifyKey
 	// The ErrorLogger for this consumer.
 	// If left as nil then the consumer will panic when it encounters an error
 	ErrorLogger ErrorLogger
@@ -76,6 +86,19 @@ func (c *Consumer) WriteOutputRoomEvent(output api.OutputRoomEvent) error {
 	return err
 }
 
+// VerifyOwnEvent implements OwnEventVerifier
+func (c *Consumer) VerifyOwnEvent(event gomatrixserverlib.Event) error {
+	if c.ServerName == "" {
+		return nil
+	}
+	// The sender is "@localpart:domain", and the domain may include a port.
+	parts := strings.SplitN(event.Sender(), ":", 2)
+	if len(parts) != 2 || parts[1] != c.ServerName {
+		return nil
+	}
+	return common.VerifyOwnEventSignature(event, c.ServerName, c.KeyID, c.PrivateKey, c.OldVerifyKeys)
+}
+
 // Start starts the consumer consuming.
 // Starts up a goroutine for each partition in the kafka stream.
 // Returns nil once all the goroutines are started.
@@ -92,7 +115,7 @@ func (c *Consumer) processMessage(message *sarama.ConsumerMessage) error {
 		// If the message is invalid then log it and move onto the next message in the stream.
 		c.logError(message, err)
 	} else {
-		if err := processRoomEvent(c.DB, c, input); err != nil {
+		if err := processRoomEvent(c.DB, c, c, input); err != nil {
 			// If there was an error processing the message then log it and
 			// move onto the next message in the stream.
 			// TODO: If the error was due to a problem talking to the database
@@ -48,6 +48,11 @@ type RoomEventDatabase interface {
 	GetLatestEventsForUpdate(roomNID types.RoomNID) (updater types.RoomRecentEventsUpdater, err error)
 	// Lookup the string event IDs for a list of numeric event IDs
 	EventIDs(eventNIDs []types.EventNID) (map[types.EventNID]string, error)
+	// Lookup the numeric event IDs for a list of string event IDs.
+	// Event IDs which aren't in the database are missing from the returned map.
+	EventNIDs(eventIDs []string) (map[string]types.EventNID, error)
+	// Replace the stored JSON of an event with its redacted form.
+	RedactEvent(eventNID types.EventNID, redactedEvent gomatrixserverlib.Event) error
 }
 
 // OutputRoomEventWriter has the APIs needed to write an event to the output logs.
@@ -56,13 +61,23 @@ type OutputRoomEventWriter interface {
 	WriteOutputRoomEvent(output api.OutputRoomEvent) error
 }
 
-func processRoomEvent(db RoomEventDatabase, ow OutputRoomEventWriter, input api.InputRoomEvent) error {
+// OwnEventVerifier checks the signatures of the events which were sent by this server.
+type OwnEventVerifier interface {
+	// Returns an error if the event was sent by a local user but wasn't signed with one of our keys.
+	VerifyOwnEvent(event gomatrixserverlib.Event) error
+}
+
+func processRoomEvent(db RoomEventDatabase, ow OutputRoomEventWriter, verifier OwnEventVerifier, input api.InputRoomEvent) error {
 	// Parse and validate the event JSON
 	event, err := gomatrixserverlib.NewEventFromUntrustedJSON(input.Event)
 	if err != nil {
 		return err
 	}
 
+	if err = verifier.VerifyOwnEvent(event); err != nil {
+		return err
+	}
+
 	// Check that the event passes authentication checks and work out the numeric IDs for the auth events.
 	authEventNIDs, err := checkAuthEvents(db, event, input.AuthEventIDs)
 	if err != nil {
@@ -110,8 +125,15 @@ func processRoomEvent(db RoomEventDatabase, ow OutputRoomEventWriter, input api.
 		panic("Not implemented")
 	}
 
+	var redactedEventID string
+	if event.Type() == "m.room.redaction" {
+		if redactedEventID, err = processRedaction(db, event, authEventNIDs); err != nil {
+			return err
+		}
+	}
+
 	// Update the extremities of the event graph for the room
-	if err := updateLatestEvents(db, ow, roomNID, stateAtEvent, event); err != nil {
+	if err := updateLatestEvents(db, ow, roomNID, stateAtEvent, event, redactedEventID); err != nil {
 		return err
 	}
 
@@ -23,7 +23,7 @@ import (
 )
 
 // updateLatestEvents updates the list of latest events for this room in the database and writes the
-// event to the output log.
+// event to the output log. redactedEventID is the ID of the event redacted by the event, if any.
 // The latest events are the events that aren't referenced by another event in the database:
 //
 //     Time goes down the page. 1 is the m.room.create event (root).
@@ -40,6 +40,7 @@ import (
 //
 func updateLatestEvents(
 	db RoomEventDatabase, ow OutputRoomEventWriter, roomNID types.RoomNID, stateAtEvent types.StateAtEvent, event gomatrixserverlib.Event,
+	redactedEventID string,
 ) (err error) {
 	updater, err := db.GetLatestEventsForUpdate(roomNID)
 	if err != nil {
@@ -59,12 +60,13 @@ func updateLatestEvents(
 		}
 	}()
 
-	err = doUpdateLatestEvents(db, updater, ow, roomNID, stateAtEvent, event)
+	err = doUpdateLatestEvents(db, updater, ow, roomNID, stateAtEvent, event, redactedEventID)
 	return
 }
 
 func doUpdateLatestEvents(
 	db RoomEventDatabase, updater types.RoomRecentEventsUpdater, ow OutputRoomEventWriter, roomNID types.RoomNID, stateAtEvent types.StateAtEvent, event gomatrixserverlib.Event,
+	redactedEventID string,
 ) error {
 	var err error
 	var prevEvents []gomatrixserverlib.EventReference
@@ -118,7 +120,7 @@ func doUpdateLatestEvents(
 	// send the event asynchronously but we would need to ensure that 1) the events are written to the log in
 	// the correct order, 2) that pending writes are resent across restarts. In order to avoid writing all the
 	// necessary bookkeeping we'll keep the event sending synchronous for now.
-	if err = writeEvent(db, ow, lastEventIDSent, event, newLatest, removed, added); err != nil {
+	if err = writeEvent(db, ow, lastEventIDSent, event, redactedEventID, newLatest, removed, added); err != nil {
 		return err
 	}
 
@@ -168,7 +170,7 @@ func calculateLatest(oldLatest []types.StateAtEventAndReference, alreadyReferenc
 
 func writeEvent(
 	db RoomEventDatabase, ow OutputRoomEventWriter, lastEventIDSent string,
-	event gomatrixserverlib.Event, latest []types.StateAtEventAndReference,
+	event gomatrixserverlib.Event, redactedEventID string, latest []types.StateAtEventAndReference,
 	removed, added []types.StateEntry,
 ) error {
 
@@ -181,6 +183,7 @@ func writeEvent(
 		Event:           event.JSON(),
 		LastSentEventID: lastEventIDSent,
 		LatestEventIDs:  latestEventIDs,
+		RedactedEventID: redactedEventID,
 	}
 
 	var stateEventNIDs []types.EventNID
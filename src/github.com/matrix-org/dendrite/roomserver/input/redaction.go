@@ -0,0 +1,126 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"encoding/json"
+
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/roomserver/types"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+// processRedaction replaces the stored JSON of the event redacted by an m.room.redaction event
+// with its redacted form. Returns the ID of the redacted event, or an empty string if the
+// redaction had no effect because the target is unknown, is in a different room or has already
+// been redacted, or because the sender isn't allowed to redact it.
+func processRedaction(db RoomEventDatabase, redaction gomatrixserverlib.Event, authEventNIDs []types.EventNID) (string, error) {
+	eventNIDs, err := db.EventNIDs([]string{redaction.Redacts()})
+	if err != nil {
+		return "", err
+	}
+	targetNID, ok := eventNIDs[redaction.Redacts()]
+	if !ok {
+		// TODO: Apply the redaction when the target event arrives.
+		return "", nil
+	}
+	targets, err := db.Events([]types.EventNID{targetNID})
+	if err != nil {
+		return "", err
+	}
+	if len(targets) == 0 {
+		return "", nil
+	}
+	target := targets[0].Event
+	if target.RoomID() != redaction.RoomID() || target.Redacted() {
+		return "", nil
+	}
+
+	// The auth checks only ensure that the redaction comes from the same server as the
+	// target. Users may redact their own events, but need the "redact" power level to
+	// redact anyone else's.
+	if target.Sender() != redaction.Sender() {
+		authEvents, err := db.Events(authEventNIDs)
+		if err != nil {
+			return "", err
+		}
+		allowed, err := canRedactOthers(authEvents, redaction.Sender())
+		if err != nil || !allowed {
+			return "", err
+		}
+	}
+
+	redacted, err := common.RedactEvent(target, redaction)
+	if err != nil {
+		return "", err
+	}
+	if err = db.RedactEvent(targetNID, redacted); err != nil {
+		return "", err
+	}
+	return target.EventID(), nil
+}
+
+// canRedactOthers returns whether the user's power level is at least the "redact" level
+// of the room, given the auth events of the redaction.
+func canRedactOthers(authEvents []types.Event, userID string) (bool, error) {
+	// These are the defaults used by the auth checks when a room has no power levels event.
+	userLevel, redactLevel := int64(0), int64(50)
+	var powerLevels *gomatrixserverlib.Event
+	for i := range authEvents {
+		ev := &authEvents[i].Event
+		switch ev.Type() {
+		case "m.room.power_levels":
+			powerLevels = ev
+		case "m.room.create":
+			var content struct {
+				Creator string `json:"creator"`
+			}
+			if err := json.Unmarshal(ev.Content(), &content); err != nil {
+				return false, err
+			}
+			if content.Creator == userID {
+				userLevel = 100
+			}
+		}
+	}
+
+	if powerLevels != nil {
+		// Power levels may be given as numbers or as strings containing numbers.
+		var content struct {
+			Users        map[string]json.Number `json:"users"`
+			UsersDefault json.Number            `json:"users_default"`
+			Redact       json.Number            `json:"redact"`
+		}
+		if err := json.Unmarshal(powerLevels.Content(), &content); err != nil {
+			return false, err
+		}
+		userLevel = levelOrDefault(content.UsersDefault, 0)
+		if level, ok := content.Users[userID]; ok {
+			userLevel = levelOrDefault(level, userLevel)
+		}
+		redactLevel = levelOrDefault(content.Redact, redactLevel)
+	}
+
+	return userLevel >= redactLevel, nil
+}
+
+// levelOrDefault returns the value of a power level, or the default if it is missing or invalid.
+func levelOrDefault(level json.Number, defaultLevel int64) int64 {
+	value, err := level.Int64()
+	if err != nil {
+		return defaultLevel
+	}
+	return value
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/matrix-org/dendrite/roomserver/types"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+func authEvent(t *testing.T, eventType, content string) types.Event {
+	eventJSON := fmt.Sprintf(
+		`{"event_id":"$%s:localhost","room_id":"!room:localhost","type":%q,"state_key":"","sender":"@alice:localhost","content":%s}`,
+		eventType, eventType, content,
+	)
+	ev, err := gomatrixserverlib.NewEventFromTrustedJSON([]byte(eventJSON), false)
+	if err != nil {
+		t.Fatalf("failed to create event: %s", err)
+	}
+	return types.Event{Event: ev}
+}
+
+func TestCanRedactOthers(t *testing.T) {
+	create := authEvent(t, "m.room.create", `{"creator":"@alice:localhost"}`)
+	powerLevels := authEvent(t, "m.room.power_levels", `{"users":{"@alice:localhost":100,"@bob:localhost":"60"},"users_default":0,"redact":50}`)
+	tests := []struct {
+		authEvents []types.Event
+		userID     string
+		want       bool
+	}{
+		{[]types.Event{create}, "@alice:localhost", true},
+		{[]types.Event{create}, "@bob:localhost", false},
+		{[]types.Event{create, powerLevels}, "@alice:localhost", true},
+		{[]types.Event{create, powerLevels}, "@bob:localhost", true},
+		{[]types.Event{create, powerLevels}, "@charlie:localhost", false},
+	}
+	for _, tc := range tests {
+		got, err := canRedactOthers(tc.authEvents, tc.userID)
+		if err != nil {
+			t.Fatalf("canRedactOthers failed: %s", err)
+		}
+		if got != tc.want {
+			t.Errorf("canRedactOthers(%d events, %q): want %v, got %v", len(tc.authEvents), tc.userID, tc.want, got)
+		}
+	}
+}
@@ -38,6 +38,13 @@ type RoomserverQueryAPIDatabase interface {
 	// Lookup the Events for a list of numeric event IDs.
 	// Returns a list of events sorted by numeric event ID.
 	Events(eventNIDs []types.EventNID) ([]types.Event, error)
+	// Lookup the numeric IDs for a list of string event IDs.
+	// Returns a map from string event ID to numeric ID. Events which aren't known are omitted.
+	EventNIDs(eventIDs []string) (map[string]types.EventNID, error)
+	// Lookup the state of the room at each of a list of string event IDs.
+	// Returns an error if there is an error talking to the database
+	// or if the room state for the event IDs aren't in the database
+	StateAtEventIDs(eventIDs []string) ([]types.StateAtEvent, error)
 }
 
 // RoomserverQueryAPI is an implementation of RoomserverQueryAPI
@@ -88,6 +95,299 @@ func (r *RoomserverQueryAPI) QueryLatestEventsAndState(
 	return nil
 }
 
+// QueryEventsByID implements api.RoomserverQueryAPI
+func (r *RoomserverQueryAPI) QueryEventsByID(
+	request *api.QueryEventsByIDRequest,
+	response *api.QueryEventsByIDResponse,
+) error {
+	response.QueryEventsByIDRequest = *request
+	eventNIDMap, err := r.DB.EventNIDs(request.EventIDs)
+	if err != nil {
+		return err
+	}
+	var eventNIDs []types.EventNID
+	for _, eventID := range request.EventIDs {
+		if eventNID, ok := eventNIDMap[eventID]; ok {
+			eventNIDs = append(eventNIDs, eventNID)
+		}
+	}
+	if len(eventNIDs) == 0 {
+		return nil
+	}
+
+	events, err := r.DB.Events(eventNIDs)
+	if err != nil {
+		return err
+	}
+	eventsByNID := map[types.EventNID]gomatrixserverlib.Event{}
+	for _, event := range events {
+		eventsByNID[event.EventNID] = event.Event
+	}
+	for _, eventNID := range eventNIDs {
+		if event, ok := eventsByNID[eventNID]; ok {
+			response.Events = append(response.Events, event)
+		}
+	}
+	return nil
+}
+
+// QueryStateForUser implements api.RoomserverQueryAPI
+func (r *RoomserverQueryAPI) QueryStateForUser(
+	request *api.QueryStateForUserRequest,
+	response *api.QueryStateForUserResponse,
+) error {
+	response.QueryStateForUserRequest = *request
+	roomNID, err := r.DB.RoomNID(request.RoomID)
+	if err != nil {
+		return err
+	}
+	if roomNID == 0 {
+		return nil
+	}
+	response.RoomExists = true
+
+	stateEntries, hasBeenInRoom, err := r.stateVisibleToUser(roomNID, request.UserID, "")
+	if err != nil || !hasBeenInRoom {
+		return err
+	}
+	response.HasBeenInRoom = true
+
+	stateEvents, err := r.loadEvents(stateEntries)
+	if err != nil {
+		return err
+	}
+	if len(request.StateToFetch) == 0 {
+		response.StateEvents = stateEvents
+		return nil
+	}
+	for _, event := range stateEvents {
+		for _, tuple := range request.StateToFetch {
+			if event.Type() == tuple.EventType && event.StateKeyEquals(tuple.StateKey) {
+				response.StateEvents = append(response.StateEvents, event)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// QueryMembershipsForRoom implements api.RoomserverQueryAPI
+func (r *RoomserverQueryAPI) QueryMembershipsForRoom(
+	request *api.QueryMembershipsForRoomRequest,
+	response *api.QueryMembershipsForRoomResponse,
+) error {
+	response.QueryMembershipsForRoomRequest = *request
+	roomNID, err := r.DB.RoomNID(request.RoomID)
+	if err != nil {
+		return err
+	}
+	if roomNID == 0 {
+		return nil
+	}
+	response.RoomExists = true
+
+	stateEntries, hasBeenInRoom, err := r.stateVisibleToUser(roomNID, request.UserID, request.AtEventID)
+	if err != nil || !hasBeenInRoom {
+		return err
+	}
+	response.HasBeenInRoom = true
+
+	var memberEntries []types.StateEntry
+	for _, entry := range stateEntries {
+		if entry.EventTypeNID == types.MRoomMemberNID {
+			memberEntries = append(memberEntries, entry)
+		}
+	}
+	response.MemberEvents, err = r.loadEvents(memberEntries)
+	return err
+}
+
+// QueryEventsVisibleToUser implements api.RoomserverQueryAPI
+func (r *RoomserverQueryAPI) QueryEventsVisibleToUser(
+	request *api.QueryEventsVisibleToUserRequest,
+	response *api.QueryEventsVisibleToUserResponse,
+) error {
+	response.QueryEventsVisibleToUserRequest = *request
+	eventNIDMap, err := r.DB.EventNIDs(request.EventIDs)
+	if err != nil {
+		return err
+	}
+	var eventIDs []string
+	var eventNIDs []types.EventNID
+	for _, eventID := range request.EventIDs {
+		if eventNID, ok := eventNIDMap[eventID]; ok {
+			eventIDs = append(eventIDs, eventID)
+			eventNIDs = append(eventNIDs, eventNID)
+		}
+	}
+	if len(eventIDs) == 0 {
+		return nil
+	}
+
+	events, err := r.DB.Events(eventNIDs)
+	if err != nil {
+		return err
+	}
+	eventsByNID := map[types.EventNID]gomatrixserverlib.Event{}
+	for _, event := range events {
+		eventsByNID[event.EventNID] = event.Event
+	}
+	stateAtEvents, err := r.DB.StateAtEventIDs(eventIDs)
+	if err != nil {
+		return err
+	}
+	beforeStateSnapshotNIDs := map[types.EventNID]types.StateSnapshotNID{}
+	for _, stateAtEvent := range stateAtEvents {
+		beforeStateSnapshotNIDs[stateAtEvent.EventNID] = stateAtEvent.BeforeStateSnapshotNID
+	}
+
+	sharedHistoryDepths := map[string]int64{}
+	for i, eventID := range eventIDs {
+		visible, err := r.isEventVisibleToUser(
+			request.UserID, eventsByNID[eventNIDs[i]], beforeStateSnapshotNIDs[eventNIDs[i]], sharedHistoryDepths,
+		)
+		if err != nil {
+			return err
+		}
+		if visible {
+			response.VisibleEventIDs = append(response.VisibleEventIDs, eventID)
+		}
+	}
+	return nil
+}
+
+// QueryStateAtEvent implements api.RoomserverQueryAPI
+func (r *RoomserverQueryAPI) QueryStateAtEvent(
+	request *api.QueryStateAtEventRequest,
+	response *api.QueryStateAtEventResponse,
+) error {
+	response.QueryStateAtEventRequest = *request
+	eventNIDs, err := r.DB.EventNIDs([]string{request.EventID})
+	if err != nil {
+		return err
+	}
+	eventNID, ok := eventNIDs[request.EventID]
+	if !ok {
+		return nil
+	}
+	response.EventExists = true
+
+	events, err := r.DB.Events([]types.EventNID{eventNID})
+	if err != nil {
+		return err
+	}
+	stateAtEvents, err := r.DB.StateAtEventIDs([]string{request.EventID})
+	if err != nil {
+		return err
+	}
+	beforeStateSnapshotNID := stateAtEvents[0].BeforeStateSnapshotNID
+
+	visible, err := r.isEventVisibleToUser(
+		request.UserID, events[0].Event, beforeStateSnapshotNID, map[string]int64{},
+	)
+	if err != nil || !visible {
+		return err
+	}
+	response.VisibleToUser = true
+
+	stateEntries, err := state.LoadStateAtSnapshot(r.DB, beforeStateSnapshotNID)
+	if err != nil {
+		return err
+	}
+	response.StateEvents, err = r.loadEvents(stateEntries)
+	return err
+}
+
+// stateVisibleToUser returns the room state which the user is allowed to see. This is the current
+// state if the user is joined to the room, or the state just after their membership event if they
+// have left or been banned. If atEventID names an event in the room then the state after that
+// event is returned instead, unless it comes after the user left.
+// Returns false if the user has never been in the room.
+func (r *RoomserverQueryAPI) stateVisibleToUser(
+	roomNID types.RoomNID, userID, atEventID string,
+) ([]types.StateEntry, bool, error) {
+	_, currentStateSnapshotNID, err := r.DB.LatestEventIDs(roomNID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	memberEvent, membership, err := r.membershipAtSnapshot(currentStateSnapshotNID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The event whose state the user gets to see, or nil for the current state.
+	var visibleAt *gomatrixserverlib.Event
+	switch membership {
+	case "join":
+	case "leave", "ban":
+		visibleAt = memberEvent
+	default:
+		return nil, false, nil
+	}
+
+	if atEventID != "" {
+		atEvent, err := r.loadEventInRoom(atEventID, memberEvent.RoomID())
+		if err != nil {
+			return nil, false, err
+		}
+		if atEvent != nil && (visibleAt == nil || atEvent.Depth() < visibleAt.Depth()) {
+			visibleAt = atEvent
+		}
+	}
+
+	if visibleAt == nil {
+		stateEntries, err := state.LoadStateAtSnapshot(r.DB, currentStateSnapshotNID)
+		return stateEntries, true, err
+	}
+	prevStates, err := r.DB.StateAtEventIDs([]string{visibleAt.EventID()})
+	if err != nil {
+		return nil, false, err
+	}
+	stateEntries, err := state.LoadCombinedStateAfterEvents(r.DB, prevStates)
+	return stateEntries, true, err
+}
+
+// loadEventInRoom returns the event with the given ID if it is known and is in the given room.
+// Returns nil otherwise.
+func (r *RoomserverQueryAPI) loadEventInRoom(eventID, roomID string) (*gomatrixserverlib.Event, error) {
+	eventNIDs, err := r.DB.EventNIDs([]string{eventID})
+	if err != nil {
+		return nil, err
+	}
+	eventNID, ok := eventNIDs[eventID]
+	if !ok {
+		return nil, nil
+	}
+	events, err := r.DB.Events([]types.EventNID{eventNID})
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	if events[0].RoomID() != roomID {
+		return nil, nil
+	}
+	return &events[0].Event, nil
+}
+
+// loadEvents returns the events for the given state entries.
+func (r *RoomserverQueryAPI) loadEvents(stateEntries []types.StateEntry) ([]gomatrixserverlib.Event, error) {
+	eventNIDs := make([]types.EventNID, len(stateEntries))
+	for i := range stateEntries {
+		eventNIDs[i] = stateEntries[i].EventNID
+	}
+
+	stateEvents, err := r.DB.Events(eventNIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]gomatrixserverlib.Event, len(stateEvents))
+	for i := range stateEvents {
+		result[i] = stateEvents[i].Event
+	}
+	return result, nil
+}
+
 // SetupHTTP adds the RoomserverQueryAPI handlers to the http.ServeMux.
 func (r *RoomserverQueryAPI) SetupHTTP(servMux *http.ServeMux) {
 	servMux.Handle(
@@ -104,6 +404,76 @@ func (r *RoomserverQueryAPI) SetupHTTP(servMux *http.ServeMux) {
 			return util.JSONResponse{Code: 200, JSON: &response}
 		}),
 	)
+	servMux.Handle(
+		api.RoomserverQueryEventsByIDPath,
+		makeAPI("query_events_by_id", func(req *http.Request) util.JSONResponse {
+			var request api.QueryEventsByIDRequest
+			var response api.QueryEventsByIDResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.QueryEventsByID(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+	servMux.Handle(
+		api.RoomserverQueryStateForUserPath,
+		makeAPI("query_state_for_user", func(req *http.Request) util.JSONResponse {
+			var request api.QueryStateForUserRequest
+			var response api.QueryStateForUserResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.QueryStateForUser(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+	servMux.Handle(
+		api.RoomserverQueryMembershipsForRoomPath,
+		makeAPI("query_memberships_for_room", func(req *http.Request) util.JSONResponse {
+			var request api.QueryMembershipsForRoomRequest
+			var response api.QueryMembershipsForRoomResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.QueryMembershipsForRoom(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+	servMux.Handle(
+		api.RoomserverQueryEventsVisibleToUserPath,
+		makeAPI("query_events_visible_to_user", func(req *http.Request) util.JSONResponse {
+			var request api.QueryEventsVisibleToUserRequest
+			var response api.QueryEventsVisibleToUserResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.QueryEventsVisibleToUser(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
+	servMux.Handle(
+		api.RoomserverQueryStateAtEventPath,
+		makeAPI("query_state_at_event", func(req *http.Request) util.JSONResponse {
+			var request api.QueryStateAtEventRequest
+			var response api.QueryStateAtEventResponse
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				return util.ErrorResponse(err)
+			}
+			if err := r.QueryStateAtEvent(&request, &response); err != nil {
+				return util.ErrorResponse(err)
+			}
+			return util.JSONResponse{Code: 200, JSON: &response}
+		}),
+	)
 }
 
 func makeAPI(metric string, apiFunc func(req *http.Request) util.JSONResponse) http.Handler {
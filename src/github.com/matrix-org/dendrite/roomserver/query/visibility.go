@@ -0,0 +1,168 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/matrix-org/dendrite/roomserver/state"
+	"github.com/matrix-org/dendrite/roomserver/types"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+// memberContent is the part of the content of an m.room.member event needed to check visibility.
+type memberContent struct {
+	Membership string `json:"membership"`
+}
+
+// historyVisibilityContent is the content of an m.room.history_visibility event.
+type historyVisibilityContent struct {
+	HistoryVisibility string `json:"history_visibility"`
+}
+
+// historyVisible returns whether a user can see an event, given the history visibility of the room
+// and the user's membership in the state before the event. inSharedHistory is whether the event
+// is in the part of the room's history which the user can see if the history is "shared": that
+// is before they left the room, or all of it if they are still joined.
+// See https://matrix.org/docs/spec/client_server/r0.2.0.html#room-history-visibility
+func historyVisible(visibility, membership string, inSharedHistory bool) bool {
+	if visibility == "world_readable" || membership == "join" {
+		return true
+	}
+	switch visibility {
+	case "invited":
+		return membership == "invite"
+	case "joined":
+		return false
+	default:
+		// Rooms without a known history visibility are treated as "shared".
+		return inSharedHistory
+	}
+}
+
+// isEventVisibleToUser returns whether the user can see the event given the state before it.
+// sharedHistoryDepths caches the results of sharedHistoryDepth for each room.
+func (r *RoomserverQueryAPI) isEventVisibleToUser(
+	userID string, event gomatrixserverlib.Event, beforeStateSnapshotNID types.StateSnapshotNID,
+	sharedHistoryDepths map[string]int64,
+) (bool, error) {
+	// Users can always see their own membership events.
+	if event.Type() == "m.room.member" && event.StateKeyEquals(userID) {
+		return true, nil
+	}
+
+	visibility, membership, err := r.visibilityAtSnapshot(beforeStateSnapshotNID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	depth, ok := sharedHistoryDepths[event.RoomID()]
+	if !ok {
+		if depth, err = r.sharedHistoryDepth(event.RoomID(), userID); err != nil {
+			return false, err
+		}
+		sharedHistoryDepths[event.RoomID()] = depth
+	}
+	return historyVisible(visibility, membership, event.Depth() < depth), nil
+}
+
+// sharedHistoryDepth returns the depth of the events before which the user can see the room's
+// history if it is "shared". This is all of the history if the user is joined to the room, the
+// history before they left if they have left or been banned, and none of it otherwise.
+func (r *RoomserverQueryAPI) sharedHistoryDepth(roomID, userID string) (int64, error) {
+	roomNID, err := r.DB.RoomNID(roomID)
+	if err != nil || roomNID == 0 {
+		return 0, err
+	}
+	_, currentStateSnapshotNID, err := r.DB.LatestEventIDs(roomNID)
+	if err != nil {
+		return 0, err
+	}
+	memberEvent, membership, err := r.membershipAtSnapshot(currentStateSnapshotNID, userID)
+	if err != nil {
+		return 0, err
+	}
+	switch membership {
+	case "join":
+		return math.MaxInt64, nil
+	case "leave", "ban":
+		return memberEvent.Depth(), nil
+	default:
+		return 0, nil
+	}
+}
+
+// membershipAtSnapshot returns the user's m.room.member event in the state snapshot and the
+// membership in it. Returns nil and an empty membership if the user has no m.room.member event.
+func (r *RoomserverQueryAPI) membershipAtSnapshot(
+	stateSnapshotNID types.StateSnapshotNID, userID string,
+) (*gomatrixserverlib.Event, string, error) {
+	stateEvents, err := r.stateEventsAtSnapshot(
+		stateSnapshotNID,
+		[]gomatrixserverlib.StateKeyTuple{{EventType: "m.room.member", StateKey: userID}},
+	)
+	if err != nil || len(stateEvents) == 0 {
+		return nil, "", err
+	}
+	var content memberContent
+	if err = json.Unmarshal(stateEvents[0].Content(), &content); err != nil {
+		return nil, "", err
+	}
+	return &stateEvents[0], content.Membership, nil
+}
+
+// visibilityAtSnapshot returns the history visibility of the room and the membership of the user
+// in the state snapshot. The history visibility is empty if there is no m.room.history_visibility
+// event, and the membership is empty if the user has no m.room.member event.
+func (r *RoomserverQueryAPI) visibilityAtSnapshot(
+	stateSnapshotNID types.StateSnapshotNID, userID string,
+) (visibility, membership string, err error) {
+	stateEvents, err := r.stateEventsAtSnapshot(stateSnapshotNID, []gomatrixserverlib.StateKeyTuple{
+		{EventType: "m.room.history_visibility", StateKey: ""},
+		{EventType: "m.room.member", StateKey: userID},
+	})
+	if err != nil {
+		return
+	}
+	for _, event := range stateEvents {
+		switch event.Type() {
+		case "m.room.history_visibility":
+			var content historyVisibilityContent
+			if err = json.Unmarshal(event.Content(), &content); err != nil {
+				return
+			}
+			visibility = content.HistoryVisibility
+		case "m.room.member":
+			var content memberContent
+			if err = json.Unmarshal(event.Content(), &content); err != nil {
+				return
+			}
+			membership = content.Membership
+		}
+	}
+	return
+}
+
+// stateEventsAtSnapshot returns the events in the state snapshot for the given state key tuples.
+func (r *RoomserverQueryAPI) stateEventsAtSnapshot(
+	stateSnapshotNID types.StateSnapshotNID, stateToFetch []gomatrixserverlib.StateKeyTuple,
+) ([]gomatrixserverlib.Event, error) {
+	stateEntries, err := state.LoadStateAtSnapshotForStringTuples(r.DB, stateSnapshotNID, stateToFetch)
+	if err != nil {
+		return nil, err
+	}
+	return r.loadEvents(stateEntries)
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"testing"
+)
+
+func TestHistoryVisible(t *testing.T) {
+	tests := []struct {
+		visibility      string
+		membership      string
+		inSharedHistory bool
+		want            bool
+	}{
+		{"world_readable", "", false, true},
+		{"joined", "join", false, true},
+		{"joined", "invite", true, false},
+		{"joined", "leave", true, false},
+		{"invited", "invite", false, true},
+		{"invited", "", true, false},
+		{"shared", "", true, true},
+		{"shared", "leave", true, true},
+		{"shared", "", false, false},
+		{"", "", true, true},
+		{"", "", false, false},
+	}
+	for _, test := range tests {
+		got := historyVisible(test.visibility, test.membership, test.inSharedHistory)
+		if got != test.want {
+			t.Errorf(
+				"historyVisible(%q, %q, %v): wanted %v got %v",
+				test.visibility, test.membership, test.inSharedHistory, test.want, got,
+			)
+		}
+	}
+}
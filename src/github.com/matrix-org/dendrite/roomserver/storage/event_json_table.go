@@ -48,9 +48,13 @@ const bulkSelectEventJSONSQL = "" +
 	" WHERE event_nid = ANY($1)" +
 	" ORDER BY event_nid ASC"
 
+const updateEventJSONSQL = "" +
+	"UPDATE event_json SET event_json = $2 WHERE event_nid = $1"
+
 type eventJSONStatements struct {
 	insertEventJSONStmt     *sql.Stmt
 	bulkSelectEventJSONStmt *sql.Stmt
+	updateEventJSONStmt     *sql.Stmt
 }
 
 func (s *eventJSONStatements) prepare(db *sql.DB) (err error) {
@@ -61,6 +65,7 @@ func (s *eventJSONStatements) prepare(db *sql.DB) (err error) {
 	return statementList{
 		{&s.insertEventJSONStmt, insertEventJSONSQL},
 		{&s.bulkSelectEventJSONStmt, bulkSelectEventJSONSQL},
+		{&s.updateEventJSONStmt, updateEventJSONSQL},
 	}.prepare(db)
 }
 
@@ -69,6 +74,12 @@ func (s *eventJSONStatements) insertEventJSON(eventNID types.EventNID, eventJSON
 	return err
 }
 
+// updateEventJSON replaces the JSON of an event, e.g. when the event is redacted.
+func (s *eventJSONStatements) updateEventJSON(eventNID types.EventNID, eventJSON []byte) error {
+	_, err := s.updateEventJSONStmt.Exec(int64(eventNID), eventJSON)
+	return err
+}
+
 type eventJSONPair struct {
 	EventNID  types.EventNID
 	EventJSON []byte
@@ -0,0 +1,106 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"database/sql"
+)
+
+const roomAliasesSchema = `
+-- Stores room aliases and room IDs they refer to
+CREATE TABLE IF NOT EXISTS room_aliases (
+    -- Alias of the room
+    alias TEXT NOT NULL PRIMARY KEY,
+    -- Room ID the alias refers to
+    room_id TEXT NOT NULL,
+    -- The Matrix user ID of the user who created the alias
+    creator_id TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS room_id_idx ON room_aliases(room_id);
+-- creator_id was added after the table was first created. Aliases made before then have no
+-- recorded creator, so they can only be removed by users with power in the room.
+ALTER TABLE room_aliases ADD COLUMN IF NOT EXISTS creator_id TEXT NOT NULL DEFAULT '';
+`
+
+const insertRoomAliasSQL = "" +
+	"INSERT INTO room_aliases (alias, room_id, creator_id) VALUES ($1, $2, $3)" +
+	" ON CONFLICT (alias) DO NOTHING"
+
+const selectRoomIDFromAliasSQL = "" +
+	"SELECT room_id, creator_id FROM room_aliases WHERE alias = $1"
+
+const selectAliasesFromRoomIDSQL = "" +
+	"SELECT alias FROM room_aliases WHERE room_id = $1 ORDER BY alias ASC"
+
+const deleteRoomAliasSQL = "" +
+	"DELETE FROM room_aliases WHERE alias = $1"
+
+type roomAliasesStatements struct {
+	insertRoomAliasStmt         *sql.Stmt
+	selectRoomIDFromAliasStmt   *sql.Stmt
+	selectAliasesFromRoomIDStmt *sql.Stmt
+	deleteRoomAliasStmt         *sql.Stmt
+}
+
+func (s *roomAliasesStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(roomAliasesSchema)
+	if err != nil {
+		return
+	}
+	return statementList{
+		{&s.insertRoomAliasStmt, insertRoomAliasSQL},
+		{&s.selectRoomIDFromAliasStmt, selectRoomIDFromAliasSQL},
+		{&s.selectAliasesFromRoomIDStmt, selectAliasesFromRoomIDSQL},
+		{&s.deleteRoomAliasStmt, deleteRoomAliasSQL},
+	}.prepare(db)
+}
+
+// insertRoomAlias returns false if the alias already exists.
+func (s *roomAliasesStatements) insertRoomAlias(alias, roomID, creatorID string) (bool, error) {
+	res, err := s.insertRoomAliasStmt.Exec(alias, roomID, creatorID)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := res.RowsAffected()
+	return inserted > 0, err
+}
+
+func (s *roomAliasesStatements) selectRoomIDFromAlias(alias string) (roomID, creatorID string, err error) {
+	err = s.selectRoomIDFromAliasStmt.QueryRow(alias).Scan(&roomID, &creatorID)
+	return
+}
+
+func (s *roomAliasesStatements) selectAliasesFromRoomID(roomID string) ([]string, error) {
+	rows, err := s.selectAliasesFromRoomIDStmt.Query(roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []string
+	for rows.Next() {
+		var alias string
+		if err = rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+func (s *roomAliasesStatements) deleteRoomAlias(alias string) error {
+	_, err := s.deleteRoomAliasStmt.Exec(alias)
+	return err
+}
@@ -30,6 +30,7 @@ type statements struct {
 	stateSnapshotStatements
 	stateBlockStatements
 	previousEventStatements
+	roomAliasesStatements
 }
 
 func (s *statements) prepare(db *sql.DB) error {
@@ -71,5 +72,9 @@ func (s *statements) prepare(db *sql.DB) error {
 		return err
 	}
 
+	if err = s.roomAliasesStatements.prepare(db); err != nil {
+		return err
+	}
+
 	return nil
 }
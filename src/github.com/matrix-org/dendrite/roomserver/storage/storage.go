@@ -189,6 +189,16 @@ func (d *Database) Events(eventNIDs []types.EventNID) ([]types.Event, error) {
 	return results, nil
 }
 
+// EventNIDs implements input.RoomEventDatabase
+func (d *Database) EventNIDs(eventIDs []string) (map[string]types.EventNID, error) {
+	return d.statements.bulkSelectEventNID(eventIDs)
+}
+
+// RedactEvent implements input.RoomEventDatabase
+func (d *Database) RedactEvent(eventNID types.EventNID, redactedEvent gomatrixserverlib.Event) error {
+	return d.statements.updateEventJSON(eventNID, redactedEvent.JSON())
+}
+
 // AddState implements input.EventDatabase
 func (d *Database) AddState(roomNID types.RoomNID, stateBlockNIDs []types.StateBlockNID, state []types.StateEntry) (types.StateSnapshotNID, error) {
 	if len(state) > 0 {
@@ -362,3 +372,27 @@ func (d *Database) StateEntriesForTuples(
 ) ([]types.StateEntryList, error) {
 	return d.statements.bulkSelectFilteredStateBlockEntries(stateBlockNIDs, stateKeyTuples)
 }
+
+// SetRoomAlias implements alias.RoomserverAliasAPIDatabase
+func (d *Database) SetRoomAlias(alias, roomID, creatorID string) (bool, error) {
+	return d.statements.insertRoomAlias(alias, roomID, creatorID)
+}
+
+// GetRoomIDFromAlias implements alias.RoomserverAliasAPIDatabase
+func (d *Database) GetRoomIDFromAlias(alias string) (roomID, creatorID string, err error) {
+	roomID, creatorID, err = d.statements.selectRoomIDFromAlias(alias)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	return
+}
+
+// GetAliasesFromRoomID implements alias.RoomserverAliasAPIDatabase
+func (d *Database) GetAliasesFromRoomID(roomID string) ([]string, error) {
+	return d.statements.selectAliasesFromRoomID(roomID)
+}
+
+// RemoveRoomAlias implements alias.RoomserverAliasAPIDatabase
+func (d *Database) RemoveRoomAlias(alias string) error {
+	return d.statements.deleteRoomAlias(alias)
+}
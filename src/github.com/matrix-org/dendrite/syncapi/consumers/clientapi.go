@@ -0,0 +1,92 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumers
+
+import (
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/matrix-org/dendrite/clientapi/api"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/syncapi/storage"
+	"github.com/matrix-org/dendrite/syncapi/sync"
+	sarama "gopkg.in/Shopify/sarama.v1"
+)
+
+// OutputClientData consumes the messages the client API writes when users change their account data.
+type OutputClientData struct {
+	clientAPIConsumer *common.ContinualConsumer
+	db                *storage.SyncServerDatabase
+	rp                *sync.RequestPool
+}
+
+// NewOutputClientData creates a new OutputClientData consumer. Call Start() to begin consuming from the client API.
+func NewOutputClientData(cfg *config.Dendrite, rp *sync.RequestPool, store *storage.SyncServerDatabase) (*OutputClientData, error) {
+	kafkaConsumer, err := sarama.NewConsumer(cfg.Kafka.Addresses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer := common.ContinualConsumer{
+		Topic:          string(cfg.Kafka.Topics.OutputClientData),
+		Consumer:       kafkaConsumer,
+		PartitionStore: store,
+	}
+	s := &OutputClientData{
+		clientAPIConsumer: &consumer,
+		db:                store,
+		rp:                rp,
+	}
+	consumer.ProcessMessage = s.onMessage
+
+	return s, nil
+}
+
+// Start consuming from the client API
+func (s *OutputClientData) Start() error {
+	return s.clientAPIConsumer.Start()
+}
+
+// onMessage is called when the sync server receives a message from the client API data log.
+// It is not safe for this function to be called from multiple goroutines, or else the
+// sync stream position may race and be incorrectly calculated.
+func (s *OutputClientData) onMessage(msg *sarama.ConsumerMessage) error {
+	var output api.OutputClientData
+	if err := json.Unmarshal(msg.Value, &output); err != nil {
+		// If the message was invalid, log it and move on to the next message in the stream
+		log.WithError(err).Errorf("client API data log: message parse failure")
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"user_id": output.UserID,
+		"room_id": output.RoomID,
+		"type":    output.Type,
+	}).Info("received account data from client API")
+
+	pos, err := s.db.UpsertAccountData(output.UserID, output.RoomID, output.Type)
+	if err != nil {
+		// panic rather than continue with an inconsistent database
+		log.WithFields(log.Fields{
+			"user_id":    output.UserID,
+			log.ErrorKey: err,
+		}).Panicf("client API data log: write account data failure")
+		return nil
+	}
+
+	s.rp.OnNewAccountData(output.UserID, pos)
+	return nil
+}
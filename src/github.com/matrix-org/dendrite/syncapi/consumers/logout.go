@@ -0,0 +1,77 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumers
+
+import (
+	"encoding/json"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/matrix-org/dendrite/clientapi/api"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/syncapi/storage"
+	"github.com/matrix-org/dendrite/syncapi/sync"
+	sarama "gopkg.in/Shopify/sarama.v1"
+)
+
+// LogoutConsumer consumes the messages the client API writes when devices are logged out.
+type LogoutConsumer struct {
+	logoutConsumer *common.ContinualConsumer
+	rp             *sync.RequestPool
+}
+
+// NewLogoutConsumer creates a new LogoutConsumer. Call Start() to begin consuming from the client API.
+func NewLogoutConsumer(cfg *config.Dendrite, rp *sync.RequestPool, store *storage.SyncServerDatabase) (*LogoutConsumer, error) {
+	kafkaConsumer, err := sarama.NewConsumer(cfg.Kafka.Addresses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer := common.ContinualConsumer{
+		Topic:          string(cfg.Kafka.Topics.OutputClientLogout),
+		Consumer:       kafkaConsumer,
+		PartitionStore: store,
+	}
+	s := &LogoutConsumer{
+		logoutConsumer: &consumer,
+		rp:             rp,
+	}
+	consumer.ProcessMessage = s.onMessage
+
+	return s, nil
+}
+
+// Start consuming from the client API
+func (s *LogoutConsumer) Start() error {
+	return s.logoutConsumer.Start()
+}
+
+// onMessage is called when the sync server receives a message from the client API logout log.
+func (s *LogoutConsumer) onMessage(msg *sarama.ConsumerMessage) error {
+	var output api.OutputRevokedDevices
+	if err := json.Unmarshal(msg.Value, &output); err != nil {
+		// If the message was invalid, log it and move on to the next message in the stream
+		log.WithError(err).Errorf("client API logout log: message parse failure")
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":    output.UserID,
+		"device_ids": output.DeviceIDs,
+	}).Info("received logout from client API")
+
+	s.rp.OnDevicesRevoked(output.UserID, output.DeviceIDs)
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/dendrite/syncapi/storage"
+	"github.com/matrix-org/dendrite/syncapi/types"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+const defaultContextLimit = 10
+
+// http://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-rooms-roomid-context-eventid
+type contextResponse struct {
+	Start        string                          `json:"start"`
+	End          string                          `json:"end"`
+	Event        gomatrixserverlib.ClientEvent   `json:"event"`
+	EventsBefore []gomatrixserverlib.ClientEvent `json:"events_before"`
+	EventsAfter  []gomatrixserverlib.ClientEvent `json:"events_after"`
+	State        []gomatrixserverlib.ClientEvent `json:"state"`
+}
+
+// GetContext implements GET /rooms/{roomID}/context/{eventID}
+// Up to 'limit' events are returned around the event, split between the events before and after it.
+// The state returned is the state of the room before the event.
+func GetContext(
+	req *http.Request, roomID, eventID string, db *storage.SyncServerDatabase,
+	queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	if resErr = checkCanReadHistory(req, device.UserID, roomID, db, accountDB); resErr != nil {
+		return *resErr
+	}
+
+	limit := defaultContextLimit
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 0 {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.Unknown("limit must be a non-negative integer"),
+			}
+		}
+	}
+
+	event, token, err := db.GetEvent(eventID)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if event == nil || event.RoomID() != roomID {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Event not found"),
+		}
+	}
+
+	queryReq := api.QueryStateAtEventRequest{UserID: device.UserID, EventID: eventID}
+	var queryRes api.QueryStateAtEventResponse
+	if err = queryAPI.QueryStateAtEvent(&queryReq, &queryRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !queryRes.EventExists {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Event not found"),
+		}
+	}
+	if !queryRes.VisibleToUser {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You aren't allowed to see this event"),
+		}
+	}
+
+	noFilter := &common.RoomEventFilter{}
+	eventsBefore, start, err := paginateVisibleEvents(
+		device.UserID, roomID, token, types.TopologyToken{}, true, limit/2, noFilter, db, queryAPI,
+	)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	// Paginate forwards from the gap just after the event.
+	after := types.TopologyToken{Depth: token.Depth, Position: token.Position + 1}
+	eventsAfter, end, err := paginateVisibleEvents(
+		device.UserID, roomID, after, types.TopologyToken{Depth: math.MaxInt64, Position: math.MaxInt64},
+		false, limit-limit/2, noFilter, db, queryAPI,
+	)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: contextResponse{
+			Start:        start.String(),
+			End:          end.String(),
+			Event:        gomatrixserverlib.ToClientEvent(*event, gomatrixserverlib.FormatAll),
+			EventsBefore: clientEvents(eventsBefore),
+			EventsAfter:  clientEvents(eventsAfter),
+			State:        clientEvents(queryRes.StateEvents),
+		},
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/dendrite/syncapi/storage"
+	"github.com/matrix-org/dendrite/syncapi/types"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+// http://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-rooms-roomid-members
+type membersResponse struct {
+	Chunk []gomatrixserverlib.ClientEvent `json:"chunk"`
+}
+
+// GetMembers implements GET /rooms/{roomID}/members
+// The 'at' parameter is a sync stream token. The members are those in the room state after the
+// latest event in the room at that point in the stream.
+func GetMembers(
+	req *http.Request, roomID string, db *storage.SyncServerDatabase,
+	queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+
+	query := req.URL.Query()
+	queryReq := api.QueryMembershipsForRoomRequest{RoomID: roomID, UserID: device.UserID}
+	// Whether there were no events in the room at the requested position, and so no members.
+	nothingAtPosition := false
+	if at := query.Get("at"); at != "" {
+		pos, err := strconv.ParseInt(at, 10, 64)
+		if err != nil {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.Unknown("at must be a sync stream token"),
+			}
+		}
+		queryReq.AtEventID, err = db.LatestEventIDAtPosition(roomID, types.StreamPosition(pos))
+		if err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		nothingAtPosition = queryReq.AtEventID == ""
+	}
+
+	var queryRes api.QueryMembershipsForRoomResponse
+	if err := queryAPI.QueryMembershipsForRoom(&queryReq, &queryRes); err != nil {
+		return httputil.LogThenError(req, err)
+	}
+	if !queryRes.RoomExists {
+		return util.JSONResponse{
+			Code: 404,
+			JSON: jsonerror.NotFound("Room does not exist"),
+		}
+	}
+	if !queryRes.HasBeenInRoom {
+		return util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You aren't a member of the room and weren't previously a member of the room."),
+		}
+	}
+
+	res := membersResponse{Chunk: []gomatrixserverlib.ClientEvent{}}
+	if nothingAtPosition {
+		return util.JSONResponse{Code: 200, JSON: res}
+	}
+
+	membership := query.Get("membership")
+	notMembership := query.Get("not_membership")
+	var memberEvents []gomatrixserverlib.Event
+	for _, event := range queryRes.MemberEvents {
+		var content events.MemberContent
+		if err := json.Unmarshal(event.Content(), &content); err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if membership != "" && content.Membership != membership {
+			continue
+		}
+		if notMembership != "" && content.Membership == notMembership {
+			continue
+		}
+		memberEvents = append(memberEvents, event)
+	}
+	res.Chunk = clientEvents(memberEvents)
+	return util.JSONResponse{Code: 200, JSON: res}
+}
@@ -0,0 +1,270 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/events"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/dendrite/syncapi/storage"
+	"github.com/matrix-org/dendrite/syncapi/types"
+	"github.com/matrix-org/gomatrixserverlib"
+	"github.com/matrix-org/util"
+)
+
+const defaultMessagesLimit = 10
+
+// http://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-rooms-roomid-messages
+type messagesResponse struct {
+	Start string                          `json:"start"`
+	End   string                          `json:"end"`
+	Chunk []gomatrixserverlib.ClientEvent `json:"chunk"`
+}
+
+// GetMessages implements GET /rooms/{roomID}/messages
+// The 'from' and 'to' tokens can be either topology tokens or sync stream positions, such as the
+// prev_batch and next_batch tokens returned by /sync.
+func GetMessages(
+	req *http.Request, roomID string, db *storage.SyncServerDatabase,
+	queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) util.JSONResponse {
+	device, resErr := auth.VerifyAccessToken(req, accountDB)
+	if resErr != nil {
+		return *resErr
+	}
+	if resErr = checkCanReadHistory(req, device.UserID, roomID, db, accountDB); resErr != nil {
+		return *resErr
+	}
+
+	query := req.URL.Query()
+	backwards := query.Get("dir") == "b"
+	if !backwards && query.Get("dir") != "f" {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.Unknown("dir must be either 'b' or 'f'"),
+		}
+	}
+	if query.Get("from") == "" {
+		return util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.MissingParam("from is required"),
+		}
+	}
+	from, resErr := parsePaginationToken(req, query.Get("from"), roomID, db)
+	if resErr != nil {
+		return *resErr
+	}
+	// By default paginate to the start or the end of the room's history.
+	to := types.TopologyToken{}
+	if !backwards {
+		to = types.TopologyToken{Depth: math.MaxInt64, Position: math.MaxInt64}
+	}
+	if query.Get("to") != "" {
+		if to, resErr = parsePaginationToken(req, query.Get("to"), roomID, db); resErr != nil {
+			return *resErr
+		}
+	}
+
+	var filter common.RoomEventFilter
+	if query.Get("filter") != "" {
+		if err := json.Unmarshal([]byte(query.Get("filter")), &filter); err != nil {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.BadJSON("filter must be a JSON room event filter: " + err.Error()),
+			}
+		}
+	}
+	limit := defaultMessagesLimit
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	if query.Get("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 0 {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.Unknown("limit must be a non-negative integer"),
+			}
+		}
+	}
+
+	visibleEvents, end, err := paginateVisibleEvents(
+		device.UserID, roomID, from, to, backwards, limit, &filter, db, queryAPI,
+	)
+	if err != nil {
+		return httputil.LogThenError(req, err)
+	}
+
+	return util.JSONResponse{
+		Code: 200,
+		JSON: messagesResponse{
+			Start: query.Get("from"),
+			End:   end.String(),
+			Chunk: clientEvents(visibleEvents),
+		},
+	}
+}
+
+// parsePaginationToken parses a token which is either a topology token or a sync token. Sync tokens
+// are converted to the position in the room's history at their position in the stream of events.
+func parsePaginationToken(
+	req *http.Request, token, roomID string, db *storage.SyncServerDatabase,
+) (types.TopologyToken, *util.JSONResponse) {
+	if topologyToken, err := types.NewTopologyTokenFromString(token); err == nil {
+		return topologyToken, nil
+	}
+	pos, err := types.NewSyncPositionFromString(token)
+	if err != nil {
+		return types.TopologyToken{}, &util.JSONResponse{
+			Code: 400,
+			JSON: jsonerror.Unknown("Invalid pagination token: " + token),
+		}
+	}
+	topologyToken, err := db.TopologyTokenAtPosition(roomID, pos.PDUPosition)
+	if err != nil {
+		resErr := httputil.LogThenError(req, err)
+		return types.TopologyToken{}, &resErr
+	}
+	return topologyToken, nil
+}
+
+// checkCanReadHistory returns an error response if the user is not allowed to read the history of
+// the room: that is if they have never been in the room or have forgotten it.
+func checkCanReadHistory(
+	req *http.Request, userID, roomID string, db *storage.SyncServerDatabase, accountDB *accounts.Database,
+) *util.JSONResponse {
+	memberEvent, err := db.GetStateEvent(roomID, "m.room.member", userID)
+	if err != nil {
+		resErr := httputil.LogThenError(req, err)
+		return &resErr
+	}
+	if memberEvent == nil {
+		return &util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You aren't a member of the room and weren't previously a member of the room."),
+		}
+	}
+
+	var content events.MemberContent
+	if err = json.Unmarshal(memberEvent.Content(), &content); err != nil {
+		resErr := httputil.LogThenError(req, err)
+		return &resErr
+	}
+	if content.Membership != "leave" && content.Membership != "ban" {
+		return nil
+	}
+	forgotten, err := accountDB.IsRoomForgotten(userID, roomID, memberEvent.EventID())
+	if err != nil {
+		resErr := httputil.LogThenError(req, err)
+		return &resErr
+	}
+	if forgotten {
+		return &util.JSONResponse{
+			Code: 403,
+			JSON: jsonerror.Forbidden("You have forgotten this room."),
+		}
+	}
+	return nil
+}
+
+// filterVisibleEvents asks the roomserver which of the events the user is allowed to see given the
+// history visibility of the room, and returns only those events.
+func filterVisibleEvents(
+	userID string, evs []gomatrixserverlib.Event, queryAPI api.RoomserverQueryAPI,
+) ([]gomatrixserverlib.Event, error) {
+	if len(evs) == 0 {
+		return evs, nil
+	}
+	queryReq := api.QueryEventsVisibleToUserRequest{UserID: userID}
+	for _, ev := range evs {
+		queryReq.EventIDs = append(queryReq.EventIDs, ev.EventID())
+	}
+	var queryRes api.QueryEventsVisibleToUserResponse
+	if err := queryAPI.QueryEventsVisibleToUser(&queryReq, &queryRes); err != nil {
+		return nil, err
+	}
+	visible := map[string]bool{}
+	for _, eventID := range queryRes.VisibleEventIDs {
+		visible[eventID] = true
+	}
+	var result []gomatrixserverlib.Event
+	for _, ev := range evs {
+		if visible[ev.EventID()] {
+			result = append(result, ev)
+		}
+	}
+	return result, nil
+}
+
+// maxPaginationBatch caps how many events paginateVisibleEvents fetches at once.
+const maxPaginationBatch = 1000
+
+// paginateVisibleEvents returns up to 'limit' events from the history of the room which match the
+// filter and which the user is allowed to see, along with the token to carry on paginating from.
+// Events the user can't see are skipped, so it carries on paginating until it has found 'limit'
+// visible events or reaches the 'to' token, rather than returning fewer events while there is
+// more history.
+func paginateVisibleEvents(
+	userID, roomID string, from, to types.TopologyToken, backwards bool, limit int,
+	filter *common.RoomEventFilter, db *storage.SyncServerDatabase, queryAPI api.RoomserverQueryAPI,
+) ([]gomatrixserverlib.Event, types.TopologyToken, error) {
+	var result []gomatrixserverlib.Event
+	batch := limit
+	for len(result) < limit {
+		evs, next, err := db.PaginateRoomEvents(roomID, from, to, backwards, batch, filter)
+		if err != nil {
+			return nil, from, err
+		}
+		visible, err := filterVisibleEvents(userID, evs, queryAPI)
+		if err != nil {
+			return nil, from, err
+		}
+		if wanted := limit - len(result); len(visible) > wanted {
+			// Carry on from the last event returned rather than from the end of the batch.
+			visible = visible[:wanted]
+			if _, next, err = db.GetEvent(visible[wanted-1].EventID()); err != nil {
+				return nil, from, err
+			}
+			if !backwards {
+				next.Position++
+			}
+		}
+		result = append(result, visible...)
+		from = next
+		if len(evs) < batch {
+			// There is no more history between the tokens.
+			break
+		}
+		// Fetch more events at a time when the user can't see many of them.
+		if batch < maxPaginationBatch {
+			batch *= 2
+		}
+	}
+	return result, from, nil
+}
+
+// clientEvents converts the events to the client format, returning an empty list rather than nil.
+func clientEvents(evs []gomatrixserverlib.Event) []gomatrixserverlib.ClientEvent {
+	return append([]gomatrixserverlib.ClientEvent{}, gomatrixserverlib.ToClientEvents(evs, gomatrixserverlib.FormatAll)...)
+}
@@ -18,7 +18,12 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"github.com/matrix-org/dendrite/syncapi/config"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
+	"github.com/matrix-org/dendrite/clientapi/httputil"
+	"github.com/matrix-org/dendrite/common/config"
+	"github.com/matrix-org/dendrite/roomserver/api"
+	"github.com/matrix-org/dendrite/syncapi/readers"
+	"github.com/matrix-org/dendrite/syncapi/storage"
 	"github.com/matrix-org/dendrite/syncapi/sync"
 	"github.com/matrix-org/util"
 	"github.com/prometheus/client_golang/prometheus"
@@ -27,14 +32,29 @@ import (
 const pathPrefixR0 = "/_matrix/client/r0"
 
 // SetupSyncServerListeners configures the given mux with sync-server listeners
-func SetupSyncServerListeners(servMux *http.ServeMux, httpClient *http.Client, cfg config.Sync, srp *sync.RequestPool) {
+func SetupSyncServerListeners(
+	servMux *http.ServeMux, httpClient *http.Client, cfg *config.Dendrite, srp *sync.RequestPool,
+	db *storage.SyncServerDatabase, queryAPI api.RoomserverQueryAPI, accountDB *accounts.Database,
+) {
 	apiMux := mux.NewRouter()
 	r0mux := apiMux.PathPrefix(pathPrefixR0).Subrouter()
 	r0mux.Handle("/sync", make("sync", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
 		return srp.OnIncomingSyncRequest(req)
 	})))
+	r0mux.Handle("/rooms/{roomID}/members", make("members", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetMembers(req, vars["roomID"], db, queryAPI, accountDB)
+	}))).Methods("GET")
+	r0mux.Handle("/rooms/{roomID}/messages", make("room_messages", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetMessages(req, vars["roomID"], db, queryAPI, accountDB)
+	}))).Methods("GET")
+	r0mux.Handle("/rooms/{roomID}/context/{eventID}", make("room_context", util.NewJSONRequestHandler(func(req *http.Request) util.JSONResponse {
+		vars := mux.Vars(req)
+		return readers.GetContext(req, vars["roomID"], vars["eventID"], db, queryAPI, accountDB)
+	}))).Methods("GET")
 	servMux.Handle("/metrics", prometheus.Handler())
-	servMux.Handle("/api/", http.StripPrefix("/api", apiMux))
+	servMux.Handle("/api/", http.StripPrefix("/api", httputil.TrustProxies(cfg.Listen.TrustedProxyNets, apiMux)))
 }
 
 // make a util.JSONRequestHandler into an http.Handler
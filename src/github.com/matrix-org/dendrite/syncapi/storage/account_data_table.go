@@ -0,0 +1,122 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/syncapi/types"
+)
+
+const accountDataSchema = `
+-- The positions in the stream of account data changes. This is separate from the stream of
+-- output room events, because the two are written by different consumers.
+CREATE SEQUENCE IF NOT EXISTS account_data_type_id_seq;
+-- Stores the types of account data which users have changed. The data itself is in the
+-- account database.
+CREATE TABLE IF NOT EXISTS account_data_type (
+    -- The position in the stream of account data changes at which the data was last changed.
+    id BIGINT PRIMARY KEY DEFAULT nextval('account_data_type_id_seq'),
+    -- The Matrix user ID of the owner of the data e.g '@alice:localhost'
+    user_id TEXT NOT NULL,
+    -- The room the data is for, or an empty string for global account data.
+    room_id TEXT NOT NULL,
+    -- The type of the data e.g 'm.direct'
+    type TEXT NOT NULL,
+    CONSTRAINT account_data_type_unique UNIQUE (user_id, room_id, type)
+);
+`
+
+const upsertAccountDataTypeSQL = "" +
+	"INSERT INTO account_data_type (user_id, room_id, type) VALUES ($1, $2, $3)" +
+	" ON CONFLICT ON CONSTRAINT account_data_type_unique" +
+	" DO UPDATE SET id = EXCLUDED.id RETURNING id"
+
+const selectAccountDataInRangeSQL = "" +
+	"SELECT room_id, type FROM account_data_type" +
+	" WHERE user_id = $1 AND id > $2 AND id <= $3 ORDER BY id ASC"
+
+const selectMaxAccountDataIDSQL = "" +
+	"SELECT MAX(id) FROM account_data_type"
+
+type accountDataStatements struct {
+	upsertAccountDataTypeStmt    *sql.Stmt
+	selectAccountDataInRangeStmt *sql.Stmt
+	selectMaxAccountDataIDStmt   *sql.Stmt
+}
+
+func (s *accountDataStatements) prepare(db *sql.DB) (err error) {
+	_, err = db.Exec(accountDataSchema)
+	if err != nil {
+		return
+	}
+	if s.upsertAccountDataTypeStmt, err = db.Prepare(upsertAccountDataTypeSQL); err != nil {
+		return
+	}
+	if s.selectAccountDataInRangeStmt, err = db.Prepare(selectAccountDataInRangeSQL); err != nil {
+		return
+	}
+	if s.selectMaxAccountDataIDStmt, err = db.Prepare(selectMaxAccountDataIDSQL); err != nil {
+		return
+	}
+	return
+}
+
+// insertAccountData records that the account data of the given type changed, and returns the
+// position in the stream of account data changes of the change.
+func (s *accountDataStatements) insertAccountData(userID, roomID, dataType string) (pos int64, err error) {
+	err = s.upsertAccountDataTypeStmt.QueryRow(userID, roomID, dataType).Scan(&pos)
+	return
+}
+
+// selectAccountDataInRange returns a map from room IDs to the types of account data the user
+// changed between the two positions, exclusive of oldPos and inclusive of newPos. Global account
+// data is under the empty room ID.
+func (s *accountDataStatements) selectAccountDataInRange(
+	txn *sql.Tx, userID string, oldPos, newPos types.StreamPosition,
+) (map[string][]string, error) {
+	stmt := s.selectAccountDataInRangeStmt
+	if txn != nil {
+		stmt = txn.Stmt(stmt)
+	}
+	rows, err := stmt.Query(userID, oldPos, newPos)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dataTypes := make(map[string][]string)
+	for rows.Next() {
+		var roomID, dataType string
+		if err = rows.Scan(&roomID, &dataType); err != nil {
+			return nil, err
+		}
+		dataTypes[roomID] = append(dataTypes[roomID], dataType)
+	}
+	return dataTypes, rows.Err()
+}
+
+func (s *accountDataStatements) selectMaxAccountDataID(txn *sql.Tx) (id int64, err error) {
+	stmt := s.selectMaxAccountDataIDStmt
+	if txn != nil {
+		stmt = txn.Stmt(stmt)
+	}
+	var nullableID sql.NullInt64
+	err = stmt.QueryRow().Scan(&nullableID)
+	if nullableID.Valid {
+		id = nullableID.Int64
+	}
+	return
+}
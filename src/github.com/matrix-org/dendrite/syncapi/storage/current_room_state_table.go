@@ -61,11 +61,19 @@ const selectRoomIDsWithMembershipSQL = "" +
 const selectCurrentStateSQL = "" +
 	"SELECT event_json FROM current_room_state WHERE room_id = $1"
 
+const selectStateEventSQL = "" +
+	"SELECT event_json FROM current_room_state WHERE room_id = $1 AND type = $2 AND state_key = $3"
+
+const updateEventJSONInRoomStateSQL = "" +
+	"UPDATE current_room_state SET event_json = $1 WHERE event_id = $2"
+
 type currentRoomStateStatements struct {
 	upsertRoomStateStmt             *sql.Stmt
+	updateEventJSONStmt             *sql.Stmt
 	deleteRoomStateByEventIDStmt    *sql.Stmt
 	selectRoomIDsWithMembershipStmt *sql.Stmt
 	selectCurrentStateStmt          *sql.Stmt
+	selectStateEventStmt            *sql.Stmt
 }
 
 func (s *currentRoomStateStatements) prepare(db *sql.DB) (err error) {
@@ -85,6 +93,12 @@ func (s *currentRoomStateStatements) prepare(db *sql.DB) (err error) {
 	if s.selectCurrentStateStmt, err = db.Prepare(selectCurrentStateSQL); err != nil {
 		return
 	}
+	if s.updateEventJSONStmt, err = db.Prepare(updateEventJSONInRoomStateSQL); err != nil {
+		return
+	}
+	if s.selectStateEventStmt, err = db.Prepare(selectStateEventSQL); err != nil {
+		return
+	}
 	return
 }
 
@@ -162,3 +176,25 @@ func (s *currentRoomStateStatements) UpdateRoomState(txn *sql.Tx, added []gomatr
 	}
 	return nil
 }
+
+// UpdateEventJSON replaces the JSON of the event if it is part of the current state. This is used to
+// store the redacted form of state events.
+func (s *currentRoomStateStatements) UpdateEventJSON(txn *sql.Tx, event *gomatrixserverlib.Event) error {
+	_, err := txn.Stmt(s.updateEventJSONStmt).Exec(event.JSON(), event.EventID())
+	return err
+}
+
+// SelectStateEvent returns the current state event in the given room with the given type and state key.
+// Returns sql.ErrNoRows if there is no such event.
+func (s *currentRoomStateStatements) SelectStateEvent(roomID, evType, stateKey string) (*gomatrixserverlib.Event, error) {
+	var eventBytes []byte
+	if err := s.selectStateEventStmt.QueryRow(roomID, evType, stateKey).Scan(&eventBytes); err != nil {
+		return nil, err
+	}
+	// TODO: Handle redacted events
+	ev, err := gomatrixserverlib.NewEventFromTrustedJSON(eventBytes, false)
+	if err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
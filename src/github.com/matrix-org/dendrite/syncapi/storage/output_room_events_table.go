@@ -17,9 +17,11 @@ package storage
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/lib/pq"
+	"github.com/matrix-org/dendrite/common"
 	"github.com/matrix-org/dendrite/syncapi/types"
 	"github.com/matrix-org/gomatrixserverlib"
 )
@@ -35,6 +37,12 @@ CREATE TABLE IF NOT EXISTS output_room_events (
     event_id TEXT NOT NULL,
     -- The 'room_id' key for the event.
     room_id TEXT NOT NULL,
+    -- The 'type' key for the event.
+    type TEXT NOT NULL,
+    -- The 'sender' key for the event.
+    sender TEXT NOT NULL,
+    -- The 'depth' key for the event. Events are paginated in the order of their depth and then their id.
+    depth BIGINT NOT NULL,
     -- The JSON for the event. Stored as TEXT because this should be valid UTF-8.
     event_json TEXT NOT NULL,
     -- A list of event IDs which represent a delta of added/removed room state. This can be NULL
@@ -42,12 +50,32 @@ CREATE TABLE IF NOT EXISTS output_room_events (
     add_state_ids TEXT[],
     remove_state_ids TEXT[]
 );
+-- type, sender and depth were added after the table was first created. Fill them in from the
+-- event JSON for tables which don't have them yet.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'output_room_events' AND column_name = 'depth'
+    ) THEN
+        ALTER TABLE output_room_events ADD COLUMN type TEXT, ADD COLUMN sender TEXT, ADD COLUMN depth BIGINT;
+        UPDATE output_room_events SET
+            type = event_json::jsonb->>'type',
+            sender = event_json::jsonb->>'sender',
+            depth = (event_json::jsonb->>'depth')::BIGINT;
+        ALTER TABLE output_room_events ALTER COLUMN type SET NOT NULL,
+            ALTER COLUMN sender SET NOT NULL, ALTER COLUMN depth SET NOT NULL;
+    END IF;
+END $$;
 -- for event selection
 CREATE UNIQUE INDEX IF NOT EXISTS event_id_idx ON output_room_events(event_id);
+-- for paginating through the history of a room
+CREATE INDEX IF NOT EXISTS output_room_events_topology_idx ON output_room_events(room_id, depth, id);
 `
 
 const insertEventSQL = "" +
-	"INSERT INTO output_room_events (room_id, event_id, event_json, add_state_ids, remove_state_ids) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	"INSERT INTO output_room_events (room_id, event_id, type, sender, depth, event_json, add_state_ids, remove_state_ids)" +
+	" VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
 
 const selectEventsSQL = "" +
 	"SELECT event_json FROM output_room_events WHERE event_id = ANY($1)"
@@ -55,8 +83,48 @@ const selectEventsSQL = "" +
 const selectEventsInRangeSQL = "" +
 	"SELECT event_json FROM output_room_events WHERE id > $1 AND id <= $2"
 
-const selectRecentEventsSQL = "" +
-	"SELECT event_json FROM output_room_events WHERE room_id = $1 AND id > $2 AND id <= $3 ORDER BY id DESC LIMIT $4"
+var selectRecentEventsSQL = "" +
+	"SELECT event_json FROM output_room_events WHERE room_id = $1 AND id > $2 AND id <= $3" +
+	eventFilterSQL(4) +
+	" ORDER BY id DESC LIMIT $8"
+
+const selectEventsAtOrBeforeSQL = "" +
+	"SELECT event_json FROM output_room_events WHERE event_id = ANY($1) AND id <= $2"
+
+const selectLatestEventIDAtPositionSQL = "" +
+	"SELECT event_id FROM output_room_events WHERE room_id = $1 AND id <= $2 ORDER BY id DESC LIMIT 1"
+
+const selectTopologyOfEventSQL = "" +
+	"SELECT depth, id FROM output_room_events WHERE event_id = $1"
+
+const selectLatestTopologyAtPositionSQL = "" +
+	"SELECT depth, id FROM output_room_events WHERE room_id = $1 AND id <= $2 ORDER BY depth DESC, id DESC LIMIT 1"
+
+// eventFilterSQL returns the conditions which filter events by their type and sender. The four
+// parameters starting at $first are LIKE patterns matching the types to include and exclude, then
+// the senders to include and exclude. NULL arrays mean that the filter doesn't restrict the types
+// or senders at all.
+func eventFilterSQL(first int) string {
+	return fmt.Sprintf(""+
+		" AND ($%[1]d::TEXT[] IS NULL OR type LIKE ANY($%[1]d))"+
+		" AND ($%[2]d::TEXT[] IS NULL OR NOT (type LIKE ANY($%[2]d)))"+
+		" AND ($%[3]d::TEXT[] IS NULL OR sender = ANY($%[3]d))"+
+		" AND ($%[4]d::TEXT[] IS NULL OR NOT (sender = ANY($%[4]d)))",
+		first, first+1, first+2, first+3,
+	)
+}
+
+var selectEventsBackwardsSQL = "" +
+	"SELECT depth, id, event_json FROM output_room_events" +
+	" WHERE room_id = $1 AND (depth, id) < ($2, $3) AND (depth, id) >= ($4, $5)" +
+	eventFilterSQL(6) +
+	" ORDER BY depth DESC, id DESC LIMIT $10"
+
+var selectEventsForwardsSQL = "" +
+	"SELECT depth, id, event_json FROM output_room_events" +
+	" WHERE room_id = $1 AND (depth, id) >= ($2, $3) AND (depth, id) < ($4, $5)" +
+	eventFilterSQL(6) +
+	" ORDER BY depth ASC, id ASC LIMIT $10"
 
 const selectMaxIDSQL = "" +
 	"SELECT MAX(id) FROM output_room_events"
@@ -64,16 +132,27 @@ const selectMaxIDSQL = "" +
 // In order for us to apply the state updates correctly, rows need to be ordered in the order they were received (id).
 const selectStateInRangeSQL = "" +
 	"SELECT event_json, add_state_ids, remove_state_ids FROM output_room_events" +
-	" WHERE (id > $1 AND id < $2) AND (add_state_ids IS NOT NULL OR remove_state_ids IS NOT NULL)" +
+	" WHERE (id > $1 AND id <= $2) AND (add_state_ids IS NOT NULL OR remove_state_ids IS NOT NULL)" +
 	" ORDER BY id ASC"
 
+const updateEventJSONSQL = "" +
+	"UPDATE output_room_events SET event_json = $1 WHERE event_id = $2"
+
 type outputRoomEventsStatements struct {
-	insertEventStmt         *sql.Stmt
-	selectEventsStmt        *sql.Stmt
-	selectMaxIDStmt         *sql.Stmt
-	selectEventsInRangeStmt *sql.Stmt
-	selectRecentEventsStmt  *sql.Stmt
-	selectStateInRangeStmt  *sql.Stmt
+	insertEventStmt            *sql.Stmt
+	updateEventJSONStmt        *sql.Stmt
+	selectEventsStmt           *sql.Stmt
+	selectMaxIDStmt            *sql.Stmt
+	selectEventsAtOrBeforeStmt *sql.Stmt
+	selectEventsInRangeStmt    *sql.Stmt
+	selectRecentEventsStmt     *sql.Stmt
+	selectStateInRangeStmt     *sql.Stmt
+
+	selectLatestEventIDAtPositionStmt  *sql.Stmt
+	selectTopologyOfEventStmt          *sql.Stmt
+	selectLatestTopologyAtPositionStmt *sql.Stmt
+	selectEventsBackwardsStmt          *sql.Stmt
+	selectEventsForwardsStmt           *sql.Stmt
 }
 
 func (s *outputRoomEventsStatements) prepare(db *sql.DB) (err error) {
@@ -84,12 +163,18 @@ func (s *outputRoomEventsStatements) prepare(db *sql.DB) (err error) {
 	if s.insertEventStmt, err = db.Prepare(insertEventSQL); err != nil {
 		return
 	}
+	if s.updateEventJSONStmt, err = db.Prepare(updateEventJSONSQL); err != nil {
+		return
+	}
 	if s.selectEventsStmt, err = db.Prepare(selectEventsSQL); err != nil {
 		return
 	}
 	if s.selectMaxIDStmt, err = db.Prepare(selectMaxIDSQL); err != nil {
 		return
 	}
+	if s.selectEventsAtOrBeforeStmt, err = db.Prepare(selectEventsAtOrBeforeSQL); err != nil {
+		return
+	}
 	if s.selectEventsInRangeStmt, err = db.Prepare(selectEventsInRangeSQL); err != nil {
 		return
 	}
@@ -99,10 +184,26 @@ func (s *outputRoomEventsStatements) prepare(db *sql.DB) (err error) {
 	if s.selectStateInRangeStmt, err = db.Prepare(selectStateInRangeSQL); err != nil {
 		return
 	}
+	if s.selectLatestEventIDAtPositionStmt, err = db.Prepare(selectLatestEventIDAtPositionSQL); err != nil {
+		return
+	}
+	if s.selectTopologyOfEventStmt, err = db.Prepare(selectTopologyOfEventSQL); err != nil {
+		return
+	}
+	if s.selectLatestTopologyAtPositionStmt, err = db.Prepare(selectLatestTopologyAtPositionSQL); err != nil {
+		return
+	}
+	if s.selectEventsBackwardsStmt, err = db.Prepare(selectEventsBackwardsSQL); err != nil {
+		return
+	}
+	if s.selectEventsForwardsStmt, err = db.Prepare(selectEventsForwardsSQL); err != nil {
+		return
+	}
 	return
 }
 
-// StateBetween returns the state events between the two given stream positions, exclusive of both.
+// StateBetween returns the state events between the two given stream positions, exclusive of oldPos
+// and inclusive of newPos.
 // Results are bucketed based on the room ID. If the same state is overwritten multiple times between the
 // two positions, only the most recent state is returned.
 func (s *outputRoomEventsStatements) StateBetween(txn *sql.Tx, oldPos, newPos types.StreamPosition) (map[string][]gomatrixserverlib.Event, error) {
@@ -226,14 +327,29 @@ func (s *outputRoomEventsStatements) MaxID(txn *sql.Tx) (id int64, err error) {
 // of the inserted event.
 func (s *outputRoomEventsStatements) InsertEvent(txn *sql.Tx, event *gomatrixserverlib.Event, addState, removeState []string) (streamPos int64, err error) {
 	err = txn.Stmt(s.insertEventStmt).QueryRow(
-		event.RoomID(), event.EventID(), event.JSON(), pq.StringArray(addState), pq.StringArray(removeState),
+		event.RoomID(), event.EventID(), event.Type(), event.Sender(), event.Depth(), event.JSON(),
+		pq.StringArray(addState), pq.StringArray(removeState),
 	).Scan(&streamPos)
 	return
 }
 
-// RecentEventsInRoom returns the most recent events in the given room, up to a maximum of 'limit'.
-func (s *outputRoomEventsStatements) RecentEventsInRoom(txn *sql.Tx, roomID string, fromPos, toPos types.StreamPosition, limit int) ([]gomatrixserverlib.Event, error) {
-	rows, err := s.selectRecentEventsStmt.Query(roomID, fromPos, toPos, limit)
+// UpdateEventJSON replaces the stored JSON of the event with the JSON of the given event, which must
+// have the same event ID. This is used to store the redacted form of events.
+func (s *outputRoomEventsStatements) UpdateEventJSON(txn *sql.Tx, event *gomatrixserverlib.Event) error {
+	_, err := txn.Stmt(s.updateEventJSONStmt).Exec(event.JSON(), event.EventID())
+	return err
+}
+
+// RecentEventsInRoom returns the most recent events in the given room which match the filter, up to
+// a maximum of 'limit'. The rooms in the filter are ignored.
+func (s *outputRoomEventsStatements) RecentEventsInRoom(
+	txn *sql.Tx, roomID string, fromPos, toPos types.StreamPosition, limit int, filter *common.RoomEventFilter,
+) ([]gomatrixserverlib.Event, error) {
+	rows, err := s.selectRecentEventsStmt.Query(
+		roomID, fromPos, toPos,
+		likePatterns(filter.Types), likePatterns(filter.NotTypes),
+		stringArrayOrNull(filter.Senders), stringArrayOrNull(filter.NotSenders), limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -247,10 +363,105 @@ func (s *outputRoomEventsStatements) RecentEventsInRoom(txn *sql.Tx, roomID stri
 	return reverseEvents(events), nil
 }
 
+// LatestEventIDAtPosition returns the ID of the most recent event in the given room at or before
+// the given stream position. Returns sql.ErrNoRows if there are no such events.
+func (s *outputRoomEventsStatements) LatestEventIDAtPosition(roomID string, pos types.StreamPosition) (eventID string, err error) {
+	err = s.selectLatestEventIDAtPositionStmt.QueryRow(roomID, pos).Scan(&eventID)
+	return
+}
+
+// TopologyOfEvent returns the token for the gap just before the given event in the history of its room.
+// 'txn' is optional. Returns sql.ErrNoRows if there is no such event.
+func (s *outputRoomEventsStatements) TopologyOfEvent(txn *sql.Tx, eventID string) (token types.TopologyToken, err error) {
+	stmt := s.selectTopologyOfEventStmt
+	if txn != nil {
+		stmt = txn.Stmt(stmt)
+	}
+	err = stmt.QueryRow(eventID).Scan(&token.Depth, &token.Position)
+	return
+}
+
+// LatestTopologyAtPosition returns the token for the gap just after the last event in the history of the
+// given room which was in the sync stream at or before the given position. Returns sql.ErrNoRows if
+// there are no such events.
+func (s *outputRoomEventsStatements) LatestTopologyAtPosition(roomID string, pos types.StreamPosition) (token types.TopologyToken, err error) {
+	err = s.selectLatestTopologyAtPositionStmt.QueryRow(roomID, pos).Scan(&token.Depth, &token.Position)
+	token.Position++
+	return
+}
+
+// PaginateEvents returns up to 'limit' events in the given room which match the filter, starting
+// from the 'from' token and moving towards the 'to' token. If backwards is true the events are
+// returned newest first, otherwise they are returned oldest first. Also returns the token which
+// should be used to carry on paginating in the same direction, or 'from' if there are no events.
+func (s *outputRoomEventsStatements) PaginateEvents(
+	roomID string, from, to types.TopologyToken, backwards bool, limit int, filter *common.RoomEventFilter,
+) ([]gomatrixserverlib.Event, types.TopologyToken, error) {
+	stmt := s.selectEventsForwardsStmt
+	if backwards {
+		stmt = s.selectEventsBackwardsStmt
+	}
+	rows, err := stmt.Query(
+		roomID, from.Depth, from.Position, to.Depth, to.Position,
+		likePatterns(filter.Types), likePatterns(filter.NotTypes),
+		stringArrayOrNull(filter.Senders), stringArrayOrNull(filter.NotSenders), limit,
+	)
+	if err != nil {
+		return nil, from, err
+	}
+	defer rows.Close()
+
+	var result []gomatrixserverlib.Event
+	next := from
+	for rows.Next() {
+		var eventBytes []byte
+		if err = rows.Scan(&next.Depth, &next.Position, &eventBytes); err != nil {
+			return nil, from, err
+		}
+		// TODO: Handle redacted events
+		ev, err := gomatrixserverlib.NewEventFromTrustedJSON(eventBytes, false)
+		if err != nil {
+			return nil, from, err
+		}
+		result = append(result, ev)
+	}
+	if len(result) > 0 && !backwards {
+		// Carry on from the gap after the last event rather than the gap before it.
+		next.Position++
+	}
+	return result, next, nil
+}
+
+// likePatterns converts a list of event types, which may contain '*' wildcards, into a list of
+// patterns for a LIKE expression. Returns NULL if the list is nil.
+func likePatterns(eventTypes []string) pq.StringArray {
+	if eventTypes == nil {
+		return nil
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%")
+	patterns := make(pq.StringArray, len(eventTypes))
+	for i := range eventTypes {
+		patterns[i] = escaper.Replace(eventTypes[i])
+	}
+	return patterns
+}
+
+// stringArrayOrNull converts a list of strings into an array parameter which is NULL if the list is nil.
+func stringArrayOrNull(values []string) pq.StringArray {
+	if values == nil {
+		return nil
+	}
+	return pq.StringArray(values)
+}
+
 // Events returns the events for the given event IDs. Returns an error if any one of the event IDs given are missing
-// from the database.
+// from the database. 'txn' is optional.
 func (s *outputRoomEventsStatements) Events(txn *sql.Tx, eventIDs []string) ([]gomatrixserverlib.Event, error) {
-	rows, err := txn.Stmt(s.selectEventsStmt).Query(pq.StringArray(eventIDs))
+	stmt := s.selectEventsStmt
+	if txn != nil {
+		stmt = txn.Stmt(stmt)
+	}
+	rows, err := stmt.Query(pq.StringArray(eventIDs))
 	if err != nil {
 		return nil, err
 	}
@@ -266,6 +477,19 @@ func (s *outputRoomEventsStatements) Events(txn *sql.Tx, eventIDs []string) ([]g
 	return result, nil
 }
 
+// EventsAtOrBefore returns the events for the given event IDs which are at or before the given
+// position in the sync stream. Event IDs which are missing or after the position are skipped.
+func (s *outputRoomEventsStatements) EventsAtOrBefore(
+	txn *sql.Tx, eventIDs []string, pos types.StreamPosition,
+) ([]gomatrixserverlib.Event, error) {
+	rows, err := txn.Stmt(s.selectEventsAtOrBeforeStmt).Query(pq.StringArray(eventIDs), pos)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rowsToEvents(rows)
+}
+
 func rowsToEvents(rows *sql.Rows) ([]gomatrixserverlib.Event, error) {
 	var result []gomatrixserverlib.Event
 	for rows.Next() {
@@ -0,0 +1,33 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestLikePatterns(t *testing.T) {
+	if got := likePatterns(nil); got != nil {
+		t.Errorf("likePatterns(nil): wanted nil got %#v", got)
+	}
+	got := likePatterns([]string{"m.room.*", "m.room.message", "com.example_type", `50%\off`})
+	want := pq.StringArray{"m.room.%", "m.room.message", `com.example\_type`, `50\%\\off`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("likePatterns: wanted %#v got %#v", want, got)
+	}
+}
@@ -16,8 +16,11 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
+
 	// Import the postgres database driver.
 	_ "github.com/lib/pq"
+	"github.com/matrix-org/dendrite/clientapi/events"
 	"github.com/matrix-org/dendrite/common"
 	"github.com/matrix-org/dendrite/syncapi/types"
 	"github.com/matrix-org/gomatrixserverlib"
@@ -25,10 +28,11 @@ import (
 
 // SyncServerDatabase represents a sync server database
 type SyncServerDatabase struct {
-	db         *sql.DB
-	partitions common.PartitionOffsetStatements
-	events     outputRoomEventsStatements
-	roomstate  currentRoomStateStatements
+	db          *sql.DB
+	partitions  common.PartitionOffsetStatements
+	events      outputRoomEventsStatements
+	roomstate   currentRoomStateStatements
+	accountData accountDataStatements
 }
 
 // NewSyncServerDatabase creates a new sync server database
@@ -50,13 +54,18 @@ func NewSyncServerDatabase(dataSourceName string) (*SyncServerDatabase, error) {
 	if err := state.prepare(db); err != nil {
 		return nil, err
 	}
-	return &SyncServerDatabase{db, partitions, events, state}, nil
+	accountData := accountDataStatements{}
+	if err = accountData.prepare(db); err != nil {
+		return nil, err
+	}
+	return &SyncServerDatabase{db, partitions, events, state, accountData}, nil
 }
 
 // WriteEvent into the database. It is not safe to call this function from multiple goroutines, as it would create races
-// when generating the stream position for this event. Returns the sync stream position for the inserted event.
-// Returns an error if there was a problem inserting this event.
-func (d *SyncServerDatabase) WriteEvent(ev *gomatrixserverlib.Event, addStateEventIDs, removeStateEventIDs []string) (streamPos types.StreamPosition, returnErr error) {
+// when generating the stream position for this event. If redactedEventID is not empty then the event is an m.room.redaction
+// and the stored copy of the redacted event is replaced with its redacted form. Returns the sync stream position for the
+// inserted event. Returns an error if there was a problem inserting this event.
+func (d *SyncServerDatabase) WriteEvent(ev *gomatrixserverlib.Event, addStateEventIDs, removeStateEventIDs []string, redactedEventID string) (streamPos types.StreamPosition, returnErr error) {
 	returnErr = runTransaction(d.db, func(txn *sql.Tx) error {
 		var err error
 		pos, err := d.events.InsertEvent(txn, ev, addStateEventIDs, removeStateEventIDs)
@@ -65,6 +74,12 @@ func (d *SyncServerDatabase) WriteEvent(ev *gomatrixserverlib.Event, addStateEve
 		}
 		streamPos = types.StreamPosition(pos)
 
+		if redactedEventID != "" {
+			if err = d.redactEvent(txn, redactedEventID, ev, streamPos); err != nil {
+				return err
+			}
+		}
+
 		if len(addStateEventIDs) == 0 && len(removeStateEventIDs) == 0 {
 			// Nothing to do, the event may have just been a message event.
 			return nil
@@ -91,6 +106,29 @@ func (d *SyncServerDatabase) WriteEvent(ev *gomatrixserverlib.Event, addStateEve
 	return
 }
 
+// redactEvent replaces the stored copies of the redacted event with its redacted form.
+// The redacted event may not have been stored, e.g. if it was sent before we joined the
+// room, in which case there is nothing to redact.
+func (d *SyncServerDatabase) redactEvent(
+	txn *sql.Tx, redactedEventID string, redaction *gomatrixserverlib.Event, pos types.StreamPosition,
+) error {
+	targets, err := d.events.EventsAtOrBefore(txn, []string{redactedEventID}, pos)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	redacted, err := common.RedactEvent(targets[0], *redaction)
+	if err != nil {
+		return err
+	}
+	if err = d.events.UpdateEventJSON(txn, &redacted); err != nil {
+		return err
+	}
+	return d.roomstate.UpdateEventJSON(txn, &redacted)
+}
+
 // PartitionOffsets implements common.PartitionStorer
 func (d *SyncServerDatabase) PartitionOffsets(topic string) ([]common.PartitionOffset, error) {
 	return d.partitions.SelectPartitionOffsets(topic)
@@ -101,17 +139,120 @@ func (d *SyncServerDatabase) SetPartitionOffset(topic string, partition int32, o
 	return d.partitions.UpsertPartitionOffset(topic, partition, offset)
 }
 
-// SyncStreamPosition returns the latest position in the sync stream. Returns 0 if there are no events yet.
-func (d *SyncServerDatabase) SyncStreamPosition() (types.StreamPosition, error) {
-	id, err := d.events.MaxID(nil)
+// SyncStreamPosition returns the latest positions in the streams of events and account data changes.
+// The positions are 0 if there is nothing in the streams yet.
+func (d *SyncServerDatabase) SyncStreamPosition() (types.SyncPosition, error) {
+	return d.syncStreamPositionTx(nil)
+}
+
+func (d *SyncServerDatabase) syncStreamPositionTx(txn *sql.Tx) (types.SyncPosition, error) {
+	maxID, err := d.events.MaxID(txn)
 	if err != nil {
-		return types.StreamPosition(0), err
+		return types.SyncPosition{}, err
+	}
+	maxAccountDataID, err := d.accountData.selectMaxAccountDataID(txn)
+	if err != nil {
+		return types.SyncPosition{}, err
+	}
+	return types.SyncPosition{
+		PDUPosition:         types.StreamPosition(maxID),
+		AccountDataPosition: types.StreamPosition(maxAccountDataID),
+	}, nil
+}
+
+// UpsertAccountData records that the account data of the given type changed for the user, and
+// returns the position in the stream of account data changes of the change. roomID is empty for
+// global account data.
+func (d *SyncServerDatabase) UpsertAccountData(userID, roomID, dataType string) (types.StreamPosition, error) {
+	pos, err := d.accountData.insertAccountData(userID, roomID, dataType)
+	return types.StreamPosition(pos), err
+}
+
+// GetAccountDataInRange returns a map from room IDs to the types of account data the user changed
+// between the two positions in the stream of account data changes, exclusive of oldPos and inclusive
+// of newPos. Global account data is under the empty room ID.
+func (d *SyncServerDatabase) GetAccountDataInRange(
+	userID string, oldPos, newPos types.StreamPosition,
+) (map[string][]string, error) {
+	return d.accountData.selectAccountDataInRange(nil, userID, oldPos, newPos)
+}
+
+// LatestEventIDAtPosition returns the ID of the most recent event in the given room at or before the
+// given position in the sync stream. Returns an empty string if there are no such events.
+func (d *SyncServerDatabase) LatestEventIDAtPosition(roomID string, pos types.StreamPosition) (string, error) {
+	eventID, err := d.events.LatestEventIDAtPosition(roomID, pos)
+	if err == sql.ErrNoRows {
+		return "", nil
 	}
-	return types.StreamPosition(id), nil
+	return eventID, err
+}
+
+// GetStateEvent returns the current state event in the given room with the given type and state key.
+// Returns nil if there is no such event.
+func (d *SyncServerDatabase) GetStateEvent(roomID, evType, stateKey string) (*gomatrixserverlib.Event, error) {
+	ev, err := d.roomstate.SelectStateEvent(roomID, evType, stateKey)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ev, err
+}
+
+// GetEvent returns the event with the given ID and the token for the gap just before it in the
+// history of its room. Returns nil if there is no such event.
+func (d *SyncServerDatabase) GetEvent(eventID string) (*gomatrixserverlib.Event, types.TopologyToken, error) {
+	token, err := d.events.TopologyOfEvent(nil, eventID)
+	if err == sql.ErrNoRows {
+		return nil, types.TopologyToken{}, nil
+	}
+	if err != nil {
+		return nil, types.TopologyToken{}, err
+	}
+	evs, err := d.events.Events(nil, []string{eventID})
+	if err != nil {
+		return nil, types.TopologyToken{}, err
+	}
+	return &evs[0], token, nil
+}
+
+// TopologyTokenAtPosition returns the token for the gap just after the events in the history of the
+// given room which were in the sync stream at or before the given position. This allows a room's
+// history to be paginated from a sync stream position.
+func (d *SyncServerDatabase) TopologyTokenAtPosition(roomID string, pos types.StreamPosition) (types.TopologyToken, error) {
+	token, err := d.events.LatestTopologyAtPosition(roomID, pos)
+	if err == sql.ErrNoRows {
+		return types.TopologyToken{}, nil
+	}
+	return token, err
+}
+
+// PaginateRoomEvents returns up to 'limit' events from the history of the given room which match
+// the filter, moving from the 'from' token towards the 'to' token. If backwards is true then the
+// events are returned newest first. Also returns the token to carry on paginating from.
+func (d *SyncServerDatabase) PaginateRoomEvents(
+	roomID string, from, to types.TopologyToken, backwards bool, limit int, filter *common.RoomEventFilter,
+) ([]gomatrixserverlib.Event, types.TopologyToken, error) {
+	return d.events.PaginateEvents(roomID, from, to, backwards, limit, filter)
+}
+
+// prevBatch returns the token which clients can paginate backwards from to get the events before the
+// recent events. If there are no recent events then this is the stream position they start after.
+func (d *SyncServerDatabase) prevBatch(txn *sql.Tx, recentEvents []gomatrixserverlib.Event, fromPos types.StreamPosition) (string, error) {
+	if len(recentEvents) == 0 {
+		return fromPos.String(), nil
+	}
+	token, err := d.events.TopologyOfEvent(txn, recentEvents[0].EventID())
+	if err != nil {
+		return "", err
+	}
+	return token.String(), nil
 }
 
 // IncrementalSync returns all the data needed in order to create an incremental sync response.
-func (d *SyncServerDatabase) IncrementalSync(userID string, fromPos, toPos types.StreamPosition, numRecentEventsPerRoom int) (data map[string]types.RoomData, returnErr error) {
+// Only the events which match the timeline filter are returned as recent events.
+func (d *SyncServerDatabase) IncrementalSync(
+	userID string, fromPos, toPos types.StreamPosition, numRecentEventsPerRoom int,
+	timelineFilter *common.RoomEventFilter,
+) (data map[string]types.RoomData, returnErr error) {
 	data = make(map[string]types.RoomData)
 	returnErr = runTransaction(d.db, func(txn *sql.Tx) error {
 		roomIDs, err := d.roomstate.SelectRoomIDsWithMembership(txn, userID, "join")
@@ -125,33 +266,115 @@ func (d *SyncServerDatabase) IncrementalSync(userID string, fromPos, toPos types
 		}
 
 		for _, roomID := range roomIDs {
-			recentEvents, err := d.events.RecentEventsInRoom(txn, roomID, fromPos, toPos, numRecentEventsPerRoom)
+			recentEvents, err := d.events.RecentEventsInRoom(
+				txn, roomID, fromPos, toPos, numRecentEventsPerRoom, timelineFilter,
+			)
+			if err != nil {
+				return err
+			}
+			prevBatch, err := d.prevBatch(txn, recentEvents, fromPos)
 			if err != nil {
 				return err
 			}
 			roomData := types.RoomData{
+				Membership:   "join",
 				State:        state[roomID],
 				RecentEvents: recentEvents,
+				PrevBatch:    prevBatch,
 			}
 			data[roomID] = roomData
 		}
+
+		// Add the rooms which the user left or was banned from between the two positions.
+		for roomID, stateEvents := range state {
+			if _, joined := data[roomID]; joined {
+				continue
+			}
+			leaveEvent, err := findLeaveEvent(stateEvents, userID)
+			if err != nil {
+				return err
+			}
+			if leaveEvent == nil {
+				continue
+			}
+			recentEvents, leavePos, err := d.recentEventsUntilLeave(
+				txn, roomID, leaveEvent, fromPos, numRecentEventsPerRoom, timelineFilter,
+			)
+			if err != nil {
+				return err
+			}
+			// The state may have changed again after the user left, which they shouldn't see.
+			stateUntilLeave, err := d.events.StateBetween(txn, fromPos, leavePos)
+			if err != nil {
+				return err
+			}
+			prevBatch, err := d.prevBatch(txn, recentEvents, fromPos)
+			if err != nil {
+				return err
+			}
+			data[roomID] = types.RoomData{
+				Membership:   "leave",
+				State:        stateUntilLeave[roomID],
+				RecentEvents: recentEvents,
+				PrevBatch:    prevBatch,
+			}
+		}
 		return nil
 	})
 	return
 }
 
-// CompleteSync returns all the data needed in order to create a complete sync response.
-func (d *SyncServerDatabase) CompleteSync(userID string, numRecentEventsPerRoom int) (pos types.StreamPosition, data map[string]types.RoomData, returnErr error) {
+// recentEventsUntilLeave returns the recent events in the room up to and including the event in
+// which the user left it, since a user who has left a room shouldn't see anything which happened
+// afterwards. Also returns the position of the leave event in the sync stream.
+func (d *SyncServerDatabase) recentEventsUntilLeave(
+	txn *sql.Tx, roomID string, leaveEvent *gomatrixserverlib.Event, fromPos types.StreamPosition,
+	numRecentEventsPerRoom int, timelineFilter *common.RoomEventFilter,
+) ([]gomatrixserverlib.Event, types.StreamPosition, error) {
+	leaveToken, err := d.events.TopologyOfEvent(txn, leaveEvent.EventID())
+	if err != nil {
+		return nil, 0, err
+	}
+	recentEvents, err := d.events.RecentEventsInRoom(
+		txn, roomID, fromPos, leaveToken.Position, numRecentEventsPerRoom, timelineFilter,
+	)
+	return recentEvents, leaveToken.Position, err
+}
+
+// findLeaveEvent returns the m.room.member event in the state which shows the user has left or been
+// banned from the room. Returns nil if there is no such event.
+func findLeaveEvent(stateEvents []gomatrixserverlib.Event, userID string) (*gomatrixserverlib.Event, error) {
+	for i := range stateEvents {
+		ev := &stateEvents[i]
+		if ev.Type() != "m.room.member" || ev.StateKey() == nil || *ev.StateKey() != userID {
+			continue
+		}
+		var content events.MemberContent
+		if err := json.Unmarshal(ev.Content(), &content); err != nil {
+			return nil, err
+		}
+		if content.Membership == "leave" || content.Membership == "ban" {
+			return ev, nil
+		}
+	}
+	return nil, nil
+}
+
+// CompleteSync returns all the data needed in order to create a complete sync response. Only the
+// events which match the timeline filter are returned as recent events. If includeLeave is true
+// then the rooms which the user has left or been banned from are included too.
+func (d *SyncServerDatabase) CompleteSync(
+	userID string, numRecentEventsPerRoom int, timelineFilter *common.RoomEventFilter, includeLeave bool,
+) (pos types.SyncPosition, data map[string]types.RoomData, returnErr error) {
 	data = make(map[string]types.RoomData)
 	// This needs to be all done in a transaction as we need to do multiple SELECTs, and we need to have
 	// a consistent view of the database throughout. This includes extracting the sync stream position.
 	returnErr = runTransaction(d.db, func(txn *sql.Tx) error {
 		// Get the current stream position which we will base the sync response on.
-		id, err := d.events.MaxID(txn)
-		if err != nil {
+		var err error
+		if pos, err = d.syncStreamPositionTx(txn); err != nil {
 			return err
 		}
-		pos = types.StreamPosition(id)
 
 		// Extract room state and recent events for all rooms the user is joined to.
 		roomIDs, err := d.roomstate.SelectRoomIDsWithMembership(txn, userID, "join")
@@ -163,15 +386,40 @@ func (d *SyncServerDatabase) CompleteSync(userID string, numRecentEventsPerRoom
 			if err != nil {
 				return err
 			}
-			// TODO: When filters are added, we may need to call this multiple times to get enough events.
-			//       See: https://github.com/matrix-org/synapse/blob/v0.19.3/synapse/handlers/sync.py#L316
-			recentEvents, err := d.events.RecentEventsInRoom(txn, roomID, types.StreamPosition(0), pos, numRecentEventsPerRoom)
+			recentEvents, err := d.events.RecentEventsInRoom(
+				txn, roomID, types.StreamPosition(0), pos.PDUPosition, numRecentEventsPerRoom, timelineFilter,
+			)
+			if err != nil {
+				return err
+			}
+			prevBatch, err := d.prevBatch(txn, recentEvents, types.StreamPosition(0))
 			if err != nil {
 				return err
 			}
 			data[roomID] = types.RoomData{
+				Membership:   "join",
 				State:        stateEvents,
 				RecentEvents: recentEvents,
+				PrevBatch:    prevBatch,
+			}
+		}
+
+		if !includeLeave {
+			return nil
+		}
+		for _, membership := range []string{"leave", "ban"} {
+			roomIDs, err := d.roomstate.SelectRoomIDsWithMembership(txn, userID, membership)
+			if err != nil {
+				return err
+			}
+			for _, roomID := range roomIDs {
+				roomData, err := d.leftRoomData(txn, roomID, userID, numRecentEventsPerRoom, timelineFilter)
+				if err != nil {
+					return err
+				}
+				if roomData != nil {
+					data[roomID] = *roomData
+				}
 			}
 		}
 		return nil
@@ -179,6 +427,47 @@ func (d *SyncServerDatabase) CompleteSync(userID string, numRecentEventsPerRoom
 	return
 }
 
+// leftRoomData returns the data for a complete sync of a room which the user has left. Returns nil
+// if the current state of the room doesn't show the user leaving it.
+func (d *SyncServerDatabase) leftRoomData(
+	txn *sql.Tx, roomID, userID string, numRecentEventsPerRoom int, timelineFilter *common.RoomEventFilter,
+) (*types.RoomData, error) {
+	currentState, err := d.roomstate.CurrentState(txn, roomID)
+	if err != nil {
+		return nil, err
+	}
+	leaveEvent, err := findLeaveEvent(currentState, userID)
+	if err != nil || leaveEvent == nil {
+		return nil, err
+	}
+	recentEvents, leavePos, err := d.recentEventsUntilLeave(
+		txn, roomID, leaveEvent, types.StreamPosition(0), numRecentEventsPerRoom, timelineFilter,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Leave out the state which changed after the user left.
+	// TODO: Return the state events which those replaced, rather than nothing.
+	stateEventIDs := make([]string, len(currentState))
+	for i := range currentState {
+		stateEventIDs[i] = currentState[i].EventID()
+	}
+	stateEvents, err := d.events.EventsAtOrBefore(txn, stateEventIDs, leavePos)
+	if err != nil {
+		return nil, err
+	}
+	prevBatch, err := d.prevBatch(txn, recentEvents, types.StreamPosition(0))
+	if err != nil {
+		return nil, err
+	}
+	return &types.RoomData{
+		Membership:   "leave",
+		State:        stateEvents,
+		RecentEvents: recentEvents,
+		PrevBatch:    prevBatch,
+	}, nil
+}
+
 func runTransaction(db *sql.DB, fn func(txn *sql.Tx) error) (err error) {
 	txn, err := db.Begin()
 	if err != nil {
@@ -0,0 +1,180 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/syncapi/types"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+// filterResponse removes the rooms and events which don't match the filter from the response.
+// The types and senders in the timeline filter are also applied by the database, so that the
+// timeline limit counts the events which match.
+func filterResponse(res *types.Response, filter *common.Filter) {
+	res.AccountData.Events = filterEvents(res.AccountData.Events, &filter.AccountData)
+	res.Presence.Events = filterEvents(res.Presence.Events, &filter.Presence)
+	room := &filter.Room
+	for roomID, jr := range res.Rooms.Join {
+		if !room.AllowsRoom(roomID) {
+			delete(res.Rooms.Join, roomID)
+			continue
+		}
+		jr.State.Events = filterRoomEvents(jr.State.Events, &room.State, roomID)
+		jr.Timeline.Events = filterRoomEvents(jr.Timeline.Events, &room.Timeline, roomID)
+		jr.Ephemeral.Events = filterRoomEvents(jr.Ephemeral.Events, &room.Ephemeral, roomID)
+		jr.AccountData.Events = filterRoomEvents(jr.AccountData.Events, &room.AccountData, roomID)
+		res.Rooms.Join[roomID] = jr
+	}
+	for roomID, lr := range res.Rooms.Leave {
+		if !room.AllowsRoom(roomID) {
+			delete(res.Rooms.Leave, roomID)
+			continue
+		}
+		lr.State.Events = filterRoomEvents(lr.State.Events, &room.State, roomID)
+		lr.Timeline.Events = filterRoomEvents(lr.Timeline.Events, &room.Timeline, roomID)
+		res.Rooms.Leave[roomID] = lr
+	}
+	for roomID := range res.Rooms.Invite {
+		if !room.AllowsRoom(roomID) {
+			delete(res.Rooms.Invite, roomID)
+		}
+	}
+}
+
+// filterRoomEvents returns the events in the room which match the filter.
+func filterRoomEvents(
+	evs []gomatrixserverlib.ClientEvent, filter *common.RoomEventFilter, roomID string,
+) []gomatrixserverlib.ClientEvent {
+	if !filter.AllowsRoom(roomID) {
+		return []gomatrixserverlib.ClientEvent{}
+	}
+	return filterEvents(evs, &filter.EventFilter)
+}
+
+// filterEvents returns the events which match the filter. If there are more than the limit of
+// the filter then only the last ones are returned.
+func filterEvents(evs []gomatrixserverlib.ClientEvent, filter *common.EventFilter) []gomatrixserverlib.ClientEvent {
+	// Not nil, so that it is sent as [] rather than null.
+	filtered := []gomatrixserverlib.ClientEvent{}
+	for _, ev := range evs {
+		if filter.AllowsEvent(ev.Type, ev.Sender) {
+			filtered = append(filtered, ev)
+		}
+	}
+	if filter.Limit > 0 && len(filtered) > filter.Limit {
+		filtered = filtered[len(filtered)-filter.Limit:]
+	}
+	return filtered
+}
+
+// projectEventFields returns the response with only the given fields of each event in it.
+func projectEventFields(res *types.Response, fields []string) (interface{}, error) {
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	// Decode numbers as json.Number so that large integers such as timestamps keep their precision.
+	decoder := json.NewDecoder(bytes.NewReader(resJSON))
+	decoder.UseNumber()
+	if err = decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	paths := make([][]string, len(fields))
+	for i := range fields {
+		paths[i] = splitEventField(fields[i])
+	}
+	projectSection(generic, "account_data", paths)
+	projectSection(generic, "presence", paths)
+	rooms, _ := generic["rooms"].(map[string]interface{})
+	for _, membership := range []string{"join", "leave"} {
+		roomsWithMembership, _ := rooms[membership].(map[string]interface{})
+		for _, room := range roomsWithMembership {
+			room, _ := room.(map[string]interface{})
+			for _, section := range []string{"state", "timeline", "ephemeral", "account_data"} {
+				projectSection(room, section, paths)
+			}
+		}
+	}
+	return generic, nil
+}
+
+// projectSection replaces each event in the section of the parent object with its projection.
+func projectSection(parent map[string]interface{}, section string, paths [][]string) {
+	sectionObj, _ := parent[section].(map[string]interface{})
+	evs, _ := sectionObj["events"].([]interface{})
+	for i := range evs {
+		if ev, ok := evs[i].(map[string]interface{}); ok {
+			evs[i] = projectEvent(ev, paths)
+		}
+	}
+}
+
+// projectEvent returns an event with only the fields of the given event at the given paths.
+func projectEvent(ev map[string]interface{}, paths [][]string) map[string]interface{} {
+	projected := make(map[string]interface{})
+	for _, path := range paths {
+		copyField(ev, projected, path)
+	}
+	return projected
+}
+
+// copyField copies the value at the path in one object to the same path in the other, if the
+// path exists.
+func copyField(from, to map[string]interface{}, path []string) {
+	value, ok := from[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		to[path[0]] = value
+		return
+	}
+	fromChild, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	toChild, ok := to[path[0]].(map[string]interface{})
+	if !ok {
+		toChild = make(map[string]interface{})
+		to[path[0]] = toChild
+	}
+	copyField(fromChild, toChild, path[1:])
+}
+
+// splitEventField splits an event field such as "content.body" into the keys along its path.
+// A '.' in a key can be escaped with a '\'.
+func splitEventField(field string) []string {
+	var path []string
+	var key []byte
+	for i := 0; i < len(field); i++ {
+		switch {
+		case field[i] == '\\' && i+1 < len(field) && field[i+1] == '.':
+			key = append(key, '.')
+			i++
+		case field[i] == '.':
+			path = append(path, string(key))
+			key = nil
+		default:
+			key = append(key, field[i])
+		}
+	}
+	return append(path, string(key))
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/matrix-org/dendrite/common"
+	"github.com/matrix-org/dendrite/syncapi/types"
+	"github.com/matrix-org/gomatrixserverlib"
+)
+
+func TestFilterResponse(t *testing.T) {
+	res := types.NewResponse(types.SyncPosition{PDUPosition: 1})
+	jr := types.NewJoinResponse()
+	jr.Timeline.Events = []gomatrixserverlib.ClientEvent{
+		{Type: "m.room.message", Sender: "@alice:localhost"},
+		{Type: "m.room.member", Sender: "@alice:localhost"},
+		{Type: "m.room.message", Sender: "@bob:localhost"},
+	}
+	res.Rooms.Join["!kept:localhost"] = *jr
+	res.Rooms.Join["!dropped:localhost"] = *types.NewJoinResponse()
+
+	var filter common.Filter
+	filter.Room.NotRooms = []string{"!dropped:localhost"}
+	filter.Room.Timeline.Types = []string{"m.room.*"}
+	filter.Room.Timeline.NotTypes = []string{"m.room.member"}
+	filter.Room.Timeline.Limit = 1
+	filterResponse(res, &filter)
+
+	if _, ok := res.Rooms.Join["!dropped:localhost"]; ok {
+		t.Error("want !dropped:localhost to be filtered out")
+	}
+	timeline := res.Rooms.Join["!kept:localhost"].Timeline.Events
+	if len(timeline) != 1 || timeline[0].Sender != "@bob:localhost" {
+		t.Errorf("want only bob's message in the timeline, got %v", timeline)
+	}
+}
+
+func TestProjectEventFields(t *testing.T) {
+	res := types.NewResponse(types.SyncPosition{PDUPosition: 1})
+	res.AccountData.Events = []gomatrixserverlib.ClientEvent{{
+		Type:    "m.example",
+		Sender:  "@alice:localhost",
+		Content: []byte(`{"body":"hello","msgtype":"m.text"}`),
+	}}
+	projected, err := projectEventFields(res, []string{"type", "content.body", "missing.field"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectedJSON, err := json.Marshal(projected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		AccountData struct {
+			Events []map[string]interface{} `json:"events"`
+		} `json:"account_data"`
+	}
+	if err = json.Unmarshal(projectedJSON, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{
+		"type":    "m.example",
+		"content": map[string]interface{}{"body": "hello"},
+	}}
+	if !reflect.DeepEqual(got.AccountData.Events, want) {
+		t.Errorf("want projected events %v, got %v", want, got.AccountData.Events)
+	}
+}
+
+func TestSplitEventField(t *testing.T) {
+	tests := map[string][]string{
+		"type":                  {"type"},
+		"content.body":          {"content", "body"},
+		`content.m\.relates_to`: {"content", "m.relates_to"},
+		`content\`:              {`content\`},
+	}
+	for field, want := range tests {
+		if got := splitEventField(field); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitEventField(%q): want %q, got %q", field, want, got)
+		}
+	}
+}
@@ -15,9 +15,12 @@
 package sync
 
 import (
+	"encoding/json"
+	"github.com/matrix-org/dendrite/common"
 	"github.com/matrix-org/dendrite/syncapi/types"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -29,26 +32,50 @@ type syncRequest struct {
 	userID        string
 	limit         int
 	timeout       time.Duration
-	since         types.StreamPosition
+	since         types.SyncPosition
 	wantFullState bool
+	filter        common.Filter
+	// The ID of the uploaded filter to use, which still needs to be loaded into 'filter'.
+	filterID string
 }
 
 func newSyncRequest(req *http.Request, userID string) (*syncRequest, error) {
 	timeout := getTimeout(req.URL.Query().Get("timeout"))
 	fullState := req.URL.Query().Get("full_state")
 	wantFullState := fullState != "" && fullState != "false"
-	since, err := getSyncStreamPosition(req.URL.Query().Get("since"))
+	since, err := getSyncPosition(req.URL.Query().Get("since"))
 	if err != nil {
 		return nil, err
 	}
-	// TODO: Additional query params: set_presence, filter
-	return &syncRequest{
+	// TODO: Additional query params: set_presence
+	syncReq := syncRequest{
 		userID:        userID,
 		timeout:       timeout,
 		since:         since,
 		wantFullState: wantFullState,
-		limit:         defaultTimelineLimit, // TODO: read from filter
-	}, nil
+		limit:         defaultTimelineLimit,
+	}
+	// The filter is either inline JSON or the ID of a filter the user uploaded.
+	filter := req.URL.Query().Get("filter")
+	if strings.HasPrefix(filter, "{") {
+		if err = syncReq.setFilter(filter); err != nil {
+			return nil, err
+		}
+	} else {
+		syncReq.filterID = filter
+	}
+	return &syncReq, nil
+}
+
+// setFilter parses the JSON of the filter for the request, and applies its timeline limit.
+func (r *syncRequest) setFilter(filterJSON string) error {
+	if err := json.Unmarshal([]byte(filterJSON), &r.filter); err != nil {
+		return err
+	}
+	if r.filter.Room.Timeline.Limit > 0 {
+		r.limit = r.filter.Room.Timeline.Limit
+	}
+	return nil
 }
 
 func getTimeout(timeoutMS string) time.Duration {
@@ -62,13 +89,9 @@ func getTimeout(timeoutMS string) time.Duration {
 	return time.Duration(i) * time.Millisecond
 }
 
-func getSyncStreamPosition(since string) (types.StreamPosition, error) {
+func getSyncPosition(since string) (types.SyncPosition, error) {
 	if since == "" {
-		return types.StreamPosition(0), nil
-	}
-	i, err := strconv.Atoi(since)
-	if err != nil {
-		return types.StreamPosition(0), err
+		return types.SyncPosition{}, nil
 	}
-	return types.StreamPosition(i), nil
+	return types.NewSyncPositionFromString(since)
 }
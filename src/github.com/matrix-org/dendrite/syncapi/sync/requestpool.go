@@ -21,6 +21,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/auth/storage/accounts"
 	"github.com/matrix-org/dendrite/clientapi/httputil"
 	"github.com/matrix-org/dendrite/clientapi/jsonerror"
 	"github.com/matrix-org/dendrite/syncapi/storage"
@@ -32,19 +33,41 @@ import (
 // RequestPool manages HTTP long-poll connections for /sync
 type RequestPool struct {
 	db *storage.SyncServerDatabase
-	// The latest sync stream position: guarded by 'cond'.
-	currPos types.StreamPosition
+	// The account database, used to verify access tokens.
+	accountDB *accounts.Database
+	// The latest positions in the sync streams: guarded by 'cond'.
+	currPos types.SyncPosition
+	// The position of the latest account data change of each user who has changed their account
+	// data since the server started. Requests are only woken by the user's own account data
+	// changes: guarded by 'cond'.
+	userPos map[string]types.StreamPosition
 	// A condition variable to notify all waiting goroutines of a new sync stream position
 	cond *sync.Cond
+	// The channels to close to end the in-flight requests for each device: guarded by 'revokedMutex'.
+	revoked      map[deviceKey][]chan struct{}
+	revokedMutex sync.Mutex
+}
+
+// deviceKey identifies the device which made a /sync request.
+type deviceKey struct {
+	userID   string
+	deviceID string
 }
 
 // NewRequestPool makes a new RequestPool
-func NewRequestPool(db *storage.SyncServerDatabase) (*RequestPool, error) {
+func NewRequestPool(db *storage.SyncServerDatabase, accountDB *accounts.Database) (*RequestPool, error) {
 	pos, err := db.SyncStreamPosition()
 	if err != nil {
 		return nil, err
 	}
-	return &RequestPool{db, types.StreamPosition(pos), sync.NewCond(&sync.Mutex{})}, nil
+	return &RequestPool{
+		db:        db,
+		accountDB: accountDB,
+		currPos:   pos,
+		userPos:   make(map[string]types.StreamPosition),
+		cond:      sync.NewCond(&sync.Mutex{}),
+		revoked:   make(map[deviceKey][]chan struct{}),
+	}, nil
 }
 
 // OnIncomingSyncRequest is called when a client makes a /sync request. This function MUST be
@@ -53,10 +76,11 @@ func NewRequestPool(db *storage.SyncServerDatabase) (*RequestPool, error) {
 func (rp *RequestPool) OnIncomingSyncRequest(req *http.Request) util.JSONResponse {
 	// Extract values from request
 	logger := util.GetLogger(req.Context())
-	userID, resErr := auth.VerifyAccessToken(req)
+	device, resErr := auth.VerifyAccessToken(req, rp.accountDB)
 	if resErr != nil {
 		return *resErr
 	}
+	userID := device.UserID
 	syncReq, err := newSyncRequest(req, userID)
 	if err != nil {
 		return util.JSONResponse{
@@ -64,12 +88,32 @@ func (rp *RequestPool) OnIncomingSyncRequest(req *http.Request) util.JSONRespons
 			JSON: jsonerror.Unknown(err.Error()),
 		}
 	}
+	if syncReq.filterID != "" {
+		filterJSON, err := rp.accountDB.GetFilter(userID, syncReq.filterID)
+		if err != nil {
+			return httputil.LogThenError(req, err)
+		}
+		if filterJSON == "" {
+			return util.JSONResponse{
+				Code: 400,
+				JSON: jsonerror.Unknown("Unknown filter ID " + syncReq.filterID),
+			}
+		}
+		// The filter was checked when it was uploaded, so this shouldn't fail.
+		if err = syncReq.setFilter(filterJSON); err != nil {
+			return httputil.LogThenError(req, err)
+		}
+	}
 	logger.WithFields(log.Fields{
 		"userID":  userID,
 		"since":   syncReq.since,
 		"timeout": syncReq.timeout,
 	}).Info("Incoming /sync request")
 
+	// End the request early if the device is logged out while we are waiting for events.
+	revokedChan := rp.addInFlightRequest(device.UserID, device.ID)
+	defer rp.removeInFlightRequest(device.UserID, device.ID, revokedChan)
+
 	// Fork off 2 goroutines: one to do the work, and one to serve as a timeout.
 	// Whichever returns first is the one we will serve back to the client.
 	// TODO: Currently this means that cpu work is timed, which may not be what we want long term.
@@ -81,6 +125,10 @@ func (rp *RequestPool) OnIncomingSyncRequest(req *http.Request) util.JSONRespons
 	done := make(chan util.JSONResponse)
 	go func() {
 		syncData, err := rp.currentSyncForUser(*syncReq)
+		var syncJSON interface{} = syncData
+		if err == nil && len(syncReq.filter.EventFields) > 0 {
+			syncJSON, err = projectEventFields(syncData, syncReq.filter.EventFields)
+		}
 		timer.Stop()
 		var res util.JSONResponse
 		if err != nil {
@@ -88,7 +136,7 @@ func (rp *RequestPool) OnIncomingSyncRequest(req *http.Request) util.JSONRespons
 		} else {
 			res = util.JSONResponse{
 				Code: 200,
-				JSON: syncData,
+				JSON: syncJSON,
 			}
 		}
 		done <- res
@@ -101,33 +149,98 @@ func (rp *RequestPool) OnIncomingSyncRequest(req *http.Request) util.JSONRespons
 			Code: 200,
 			JSON: types.NewResponse(syncReq.since),
 		}
+	case <-revokedChan: // the device was logged out
+		return util.JSONResponse{
+			Code: 401,
+			JSON: jsonerror.UnknownToken("Access token has been revoked"),
+		}
 	case res := <-done: // received a response
 		return res
 	}
 }
 
+// OnDevicesRevoked is called when the given devices are logged out. Any requests which
+// are still being processed for the devices are ended.
+func (rp *RequestPool) OnDevicesRevoked(userID string, deviceIDs []string) {
+	rp.revokedMutex.Lock()
+	defer rp.revokedMutex.Unlock()
+	for _, deviceID := range deviceIDs {
+		key := deviceKey{userID, deviceID}
+		for _, c := range rp.revoked[key] {
+			close(c)
+		}
+		delete(rp.revoked, key)
+	}
+}
+
+// addInFlightRequest returns a channel which is closed if the device is logged out.
+func (rp *RequestPool) addInFlightRequest(userID, deviceID string) chan struct{} {
+	c := make(chan struct{})
+	key := deviceKey{userID, deviceID}
+	rp.revokedMutex.Lock()
+	rp.revoked[key] = append(rp.revoked[key], c)
+	rp.revokedMutex.Unlock()
+	return c
+}
+
+// removeInFlightRequest stops tracking a request once it has been served.
+func (rp *RequestPool) removeInFlightRequest(userID, deviceID string, c chan struct{}) {
+	key := deviceKey{userID, deviceID}
+	rp.revokedMutex.Lock()
+	defer rp.revokedMutex.Unlock()
+	chans := rp.revoked[key]
+	for i := range chans {
+		if chans[i] == c {
+			chans = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+	if len(chans) == 0 {
+		delete(rp.revoked, key)
+	} else {
+		rp.revoked[key] = chans
+	}
+}
+
 // OnNewEvent is called when a new event is received from the room server. Must only be
 // called from a single goroutine, to avoid races between updates which could set the
 // current position in the stream incorrectly.
 func (rp *RequestPool) OnNewEvent(ev *gomatrixserverlib.Event, pos types.StreamPosition) {
 	// update the current position in a guard and then notify all /sync streams
 	rp.cond.L.Lock()
-	rp.currPos = pos
+	rp.currPos.PDUPosition = pos
 	rp.cond.L.Unlock()
 
 	rp.cond.Broadcast() // notify ALL waiting goroutines
 }
 
-func (rp *RequestPool) waitForEvents(req syncRequest) types.StreamPosition {
+// OnNewAccountData is called when the user changes their account data. Must only be called
+// from a single goroutine, to avoid races between updates which could set the user's
+// position in the stream incorrectly.
+func (rp *RequestPool) OnNewAccountData(userID string, pos types.StreamPosition) {
+	rp.cond.L.Lock()
+	rp.currPos.AccountDataPosition = pos
+	rp.userPos[userID] = pos
+	rp.cond.L.Unlock()
+
+	// Requests for other users are woken too, but go back to waiting as they have nothing new.
+	rp.cond.Broadcast()
+}
+
+// hasNewData returns whether there is anything new for the user since the given position: either a
+// new event or a change to their own account data. Must be called with the lock on 'cond' held.
+func (rp *RequestPool) hasNewData(userID string, since types.SyncPosition) bool {
+	// TODO: This is true for ANY new event, we need to only wait for events which we care about.
+	return rp.currPos.PDUPosition != since.PDUPosition || rp.userPos[userID] > since.AccountDataPosition
+}
+
+func (rp *RequestPool) waitForEvents(req syncRequest) types.SyncPosition {
 	// In a guard, check if the /sync request should block, and block it until we get a new position
 	rp.cond.L.Lock()
-	currentPos := rp.currPos
-	for req.since == currentPos {
-		// we need to wait for a new event.
-		// TODO: This waits for ANY new event, we need to only wait for events which we care about.
+	for !rp.hasNewData(req.userID, req.since) {
 		rp.cond.Wait() // atomically unlocks and blocks goroutine, then re-acquires lock on unblock
-		currentPos = rp.currPos
 	}
+	currentPos := rp.currPos
 	rp.cond.L.Unlock()
 	return currentPos
 }
@@ -135,36 +248,116 @@ func (rp *RequestPool) waitForEvents(req syncRequest) types.StreamPosition {
 func (rp *RequestPool) currentSyncForUser(req syncRequest) (*types.Response, error) {
 	currentPos := rp.waitForEvents(req)
 
-	if req.since == types.StreamPosition(0) {
-		pos, data, err := rp.db.CompleteSync(req.userID, req.limit)
-		if err != nil {
-			return nil, err
-		}
-		res := types.NewResponse(pos)
-		for roomID, d := range data {
-			jr := types.NewJoinResponse()
-			jr.Timeline.Events = gomatrixserverlib.ToClientEvents(d.RecentEvents, gomatrixserverlib.FormatSync)
-			jr.Timeline.Limited = true
-			jr.State.Events = gomatrixserverlib.ToClientEvents(d.State, gomatrixserverlib.FormatSync)
-			res.Rooms.Join[roomID] = *jr
-		}
-		return res, nil
+	var data map[string]types.RoomData
+	var err error
+	// The timelines of a complete sync only have the most recent events, so are always limited.
+	limited := false
+	if req.since == (types.SyncPosition{}) {
+		currentPos, data, err = rp.db.CompleteSync(
+			req.userID, req.limit, &req.filter.Room.Timeline, req.filter.Room.IncludeLeave,
+		)
+		limited = true
+	} else {
+		// TODO: handle ignored users
+		data, err = rp.db.IncrementalSync(
+			req.userID, req.since.PDUPosition, currentPos.PDUPosition, req.limit, &req.filter.Room.Timeline,
+		)
 	}
-
-	// TODO: handle ignored users
-
-	data, err := rp.db.IncrementalSync(req.userID, req.since, currentPos, req.limit)
 	if err != nil {
 		return nil, err
 	}
 
+	var forgotten accounts.ForgottenRooms
 	res := types.NewResponse(currentPos)
 	for roomID, d := range data {
+		if d.Membership == "leave" {
+			if forgotten == nil {
+				if forgotten, err = rp.accountDB.GetForgottenRooms(req.userID); err != nil {
+					return nil, err
+				}
+			}
+			if forgotten.IsForgotten(roomID, membershipEventID(d.State, req.userID)) {
+				continue
+			}
+			lr := types.NewLeaveResponse()
+			lr.Timeline.Events = gomatrixserverlib.ToClientEvents(d.RecentEvents, gomatrixserverlib.FormatSync)
+			lr.Timeline.Limited = limited // TODO: if len(events) >= numRecents + 1 and then set limited:true
+			lr.Timeline.PrevBatch = d.PrevBatch
+			lr.State.Events = gomatrixserverlib.ToClientEvents(d.State, gomatrixserverlib.FormatSync)
+			res.Rooms.Leave[roomID] = *lr
+			continue
+		}
 		jr := types.NewJoinResponse()
 		jr.Timeline.Events = gomatrixserverlib.ToClientEvents(d.RecentEvents, gomatrixserverlib.FormatSync)
-		jr.Timeline.Limited = false // TODO: if len(events) >= numRecents + 1 and then set limited:true
+		jr.Timeline.Limited = limited // TODO: if len(events) >= numRecents + 1 and then set limited:true
+		jr.Timeline.PrevBatch = d.PrevBatch
 		jr.State.Events = gomatrixserverlib.ToClientEvents(d.State, gomatrixserverlib.FormatSync)
 		res.Rooms.Join[roomID] = *jr
 	}
+	if err = rp.appendAccountData(res, req.userID, req.since, currentPos); err != nil {
+		return nil, err
+	}
+	filterResponse(res, &req.filter)
 	return res, nil
 }
+
+// appendAccountData adds the account data which the user changed between the two positions to
+// the response. All of the user's account data is added for a complete sync. Account data for
+// rooms which aren't in the joined rooms of the response is left out.
+func (rp *RequestPool) appendAccountData(
+	res *types.Response, userID string, since, currentPos types.SyncPosition,
+) error {
+	if since == (types.SyncPosition{}) {
+		global, rooms, err := rp.accountDB.GetAccountData(userID)
+		if err != nil {
+			return err
+		}
+		res.AccountData.Events = global
+		for roomID, evs := range rooms {
+			if jr, ok := res.Rooms.Join[roomID]; ok {
+				jr.AccountData.Events = evs
+				res.Rooms.Join[roomID] = jr
+			}
+		}
+		return nil
+	}
+
+	changed, err := rp.db.GetAccountDataInRange(userID, since.AccountDataPosition, currentPos.AccountDataPosition)
+	if err != nil {
+		return err
+	}
+	for roomID, dataTypes := range changed {
+		jr, joined := res.Rooms.Join[roomID]
+		if roomID != "" && !joined {
+			continue
+		}
+		for _, dataType := range dataTypes {
+			ev, err := rp.accountDB.GetAccountDataByType(userID, roomID, dataType)
+			if err != nil {
+				return err
+			}
+			if ev == nil {
+				continue
+			}
+			if roomID == "" {
+				res.AccountData.Events = append(res.AccountData.Events, *ev)
+			} else {
+				jr.AccountData.Events = append(jr.AccountData.Events, *ev)
+			}
+		}
+		if joined {
+			res.Rooms.Join[roomID] = jr
+		}
+	}
+	return nil
+}
+
+// membershipEventID returns the ID of the user's membership event in the state, or "" if there isn't one.
+func membershipEventID(state []gomatrixserverlib.Event, userID string) string {
+	for _, ev := range state {
+		if ev.Type() == "m.room.member" && ev.StateKey() != nil && *ev.StateKey() == userID {
+			return ev.EventID()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/dendrite/syncapi/types"
+)
+
+func newTestRequestPool(pos types.SyncPosition) *RequestPool {
+	return &RequestPool{
+		currPos: pos,
+		userPos: make(map[string]types.StreamPosition),
+		cond:    sync.NewCond(&sync.Mutex{}),
+	}
+}
+
+func TestAccountDataWakesOnlyThatUser(t *testing.T) {
+	since := types.SyncPosition{PDUPosition: 5, AccountDataPosition: 2}
+	rp := newTestRequestPool(since)
+
+	woken := make(chan types.SyncPosition)
+	go func() {
+		woken <- rp.waitForEvents(syncRequest{userID: "@alice:localhost", since: since})
+	}()
+
+	rp.OnNewAccountData("@bob:localhost", 3)
+	select {
+	case pos := <-woken:
+		t.Fatalf("alice's request was woken by bob's account data at position %s", pos)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	rp.OnNewAccountData("@alice:localhost", 4)
+	select {
+	case pos := <-woken:
+		want := types.SyncPosition{PDUPosition: 5, AccountDataPosition: 4}
+		if pos != want {
+			t.Errorf("want alice's request to be woken at position %s, got %s", want, pos)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("alice's request wasn't woken by their account data")
+	}
+}
+
+func TestEventAndAccountDataPositionsAreSeparate(t *testing.T) {
+	rp := newTestRequestPool(types.SyncPosition{PDUPosition: 5, AccountDataPosition: 2})
+	rp.OnNewAccountData("@alice:localhost", 3)
+	rp.OnNewEvent(nil, 8)
+
+	want := types.SyncPosition{PDUPosition: 8, AccountDataPosition: 3}
+	if rp.currPos != want {
+		t.Errorf("want current position %s, got %s", want, rp.currPos)
+	}
+	// Bob's request is woken by the event, but not by alice's account data.
+	if !rp.hasNewData("@bob:localhost", types.SyncPosition{PDUPosition: 5, AccountDataPosition: 2}) {
+		t.Error("want bob to have new data after the event, got none")
+	}
+	if rp.hasNewData("@bob:localhost", types.SyncPosition{PDUPosition: 8, AccountDataPosition: 2}) {
+		t.Error("want bob to have no new data from alice's account data, got some")
+	}
+	if !rp.hasNewData("@alice:localhost", types.SyncPosition{PDUPosition: 8, AccountDataPosition: 2}) {
+		t.Error("want alice to have new account data, got none")
+	}
+}
@@ -15,7 +15,10 @@
 package types
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/matrix-org/gomatrixserverlib"
 )
@@ -28,10 +31,100 @@ func (sp StreamPosition) String() string {
 	return strconv.FormatInt(int64(sp), 10)
 }
 
+// ErrInvalidSyncPosition is returned when parsing a sync token which isn't in the form "s<events>_<account data>".
+var ErrInvalidSyncPosition = errors.New("syncapi: invalid sync position")
+
+// SyncPosition is the position in the sync streams a client is at, which is sent to clients as the
+// next_batch token. Events and account data changes are written by separate consumers, so they are
+// numbered in separate streams: positions taken from one shared sequence could be committed out of
+// order, letting a client skip over data which was committed later. It is serialised as
+// "s<events>_<account data>".
+type SyncPosition struct {
+	// The position in the stream of events.
+	PDUPosition StreamPosition
+	// The position in the stream of account data changes.
+	AccountDataPosition StreamPosition
+}
+
+// String implements the Stringer interface.
+func (sp SyncPosition) String() string {
+	return fmt.Sprintf("s%d_%d", sp.PDUPosition, sp.AccountDataPosition)
+}
+
+// NewSyncPositionFromString parses a sync token from the form "s<events>_<account data>". Tokens
+// which are a single number are from before account data had its own stream, so are taken to be
+// positions in the stream of events from before there was any account data.
+// Returns ErrInvalidSyncPosition if the token isn't in either form.
+func NewSyncPositionFromString(token string) (SyncPosition, error) {
+	if !strings.HasPrefix(token, "s") {
+		pos, err := strconv.ParseInt(token, 10, 64)
+		if err != nil {
+			return SyncPosition{}, ErrInvalidSyncPosition
+		}
+		return SyncPosition{PDUPosition: StreamPosition(pos)}, nil
+	}
+	parts := strings.Split(token[1:], "_")
+	if len(parts) != 2 {
+		return SyncPosition{}, ErrInvalidSyncPosition
+	}
+	pduPos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return SyncPosition{}, ErrInvalidSyncPosition
+	}
+	accountDataPos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return SyncPosition{}, ErrInvalidSyncPosition
+	}
+	return SyncPosition{PDUPosition: StreamPosition(pduPos), AccountDataPosition: StreamPosition(accountDataPos)}, nil
+}
+
+// ErrInvalidTopologyToken is returned when parsing a topology token which isn't in the form "t<depth>_<position>".
+var ErrInvalidTopologyToken = errors.New("syncapi: invalid topology token")
+
+// TopologyToken is a position in the history of a room, used to paginate through the events in it.
+// Events are ordered by their depth in the room graph and then by their position in the sync stream.
+// The token points at the gap just before the event with the given depth and stream position, so
+// it can be used to paginate in either direction. It is serialised as "t<depth>_<position>".
+type TopologyToken struct {
+	Depth    int64
+	Position StreamPosition
+}
+
+// String implements the Stringer interface.
+func (t TopologyToken) String() string {
+	return fmt.Sprintf("t%d_%d", t.Depth, t.Position)
+}
+
+// NewTopologyTokenFromString parses a topology token from the form "t<depth>_<position>".
+// Returns ErrInvalidTopologyToken if the token isn't in that form.
+func NewTopologyTokenFromString(token string) (TopologyToken, error) {
+	if !strings.HasPrefix(token, "t") {
+		return TopologyToken{}, ErrInvalidTopologyToken
+	}
+	parts := strings.Split(token[1:], "_")
+	if len(parts) != 2 {
+		return TopologyToken{}, ErrInvalidTopologyToken
+	}
+	depth, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return TopologyToken{}, ErrInvalidTopologyToken
+	}
+	pos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return TopologyToken{}, ErrInvalidTopologyToken
+	}
+	return TopologyToken{Depth: depth, Position: StreamPosition(pos)}, nil
+}
+
 // RoomData represents the data for a room suitable for building a sync response from.
 type RoomData struct {
+	// The user's membership of the room: "join", or "leave" if they have left or been
+	// banned from the room.
+	Membership   string
 	State        []gomatrixserverlib.Event
 	RecentEvents []gomatrixserverlib.Event
+	// The token to paginate backwards from to get the events before RecentEvents.
+	PrevBatch string
 }
 
 // Response represents a /sync API response. See https://matrix.org/docs/spec/client_server/r0.2.0.html#get-matrix-client-r0-sync
@@ -51,10 +144,8 @@ type Response struct {
 }
 
 // NewResponse creates an empty response with initialised maps.
-func NewResponse(pos StreamPosition) *Response {
+func NewResponse(pos SyncPosition) *Response {
 	res := Response{}
-	// Make sure we send the next_batch as a string. We don't want to confuse clients by sending this
-	// as an integer even though (at the moment) it is.
 	res.NextBatch = pos.String()
 	// Pre-initalise the maps. Synapse will return {} even if there are no rooms under a specific section,
 	// so let's do the same thing. Bonus: this means we can't get dreaded 'assignment to entry in nil map' errors.
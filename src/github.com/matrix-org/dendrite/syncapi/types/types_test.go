@@ -0,0 +1,73 @@
+// Copyright 2017 Vector Creations Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+)
+
+func TestTopologyTokenRoundTrip(t *testing.T) {
+	token := TopologyToken{Depth: 12, Position: 345}
+	if token.String() != "t12_345" {
+		t.Fatalf("wanted t12_345 got %s", token.String())
+	}
+	parsed, err := NewTopologyTokenFromString(token.String())
+	if err != nil {
+		t.Fatalf("failed to parse token: %s", err)
+	}
+	if parsed != token {
+		t.Errorf("wanted %#v got %#v", token, parsed)
+	}
+}
+
+func TestNewTopologyTokenFromStringInvalid(t *testing.T) {
+	for _, input := range []string{"", "12", "t12", "t12_", "t_345", "tx_345", "t12_345_6", "s12_345"} {
+		if _, err := NewTopologyTokenFromString(input); err != ErrInvalidTopologyToken {
+			t.Errorf("NewTopologyTokenFromString(%q): wanted ErrInvalidTopologyToken got %v", input, err)
+		}
+	}
+}
+
+func TestSyncPositionRoundTrip(t *testing.T) {
+	pos := SyncPosition{PDUPosition: 12, AccountDataPosition: 345}
+	if pos.String() != "s12_345" {
+		t.Fatalf("wanted s12_345 got %s", pos.String())
+	}
+	parsed, err := NewSyncPositionFromString(pos.String())
+	if err != nil {
+		t.Fatalf("failed to parse position: %s", err)
+	}
+	if parsed != pos {
+		t.Errorf("wanted %#v got %#v", pos, parsed)
+	}
+}
+
+func TestNewSyncPositionFromStringLegacy(t *testing.T) {
+	parsed, err := NewSyncPositionFromString("12")
+	if err != nil {
+		t.Fatalf("failed to parse position: %s", err)
+	}
+	if want := (SyncPosition{PDUPosition: 12}); parsed != want {
+		t.Errorf("wanted %#v got %#v", want, parsed)
+	}
+}
+
+func TestNewSyncPositionFromStringInvalid(t *testing.T) {
+	for _, input := range []string{"", "s12", "s12_", "s_345", "sx_345", "s12_345_6", "t12_345"} {
+		if _, err := NewSyncPositionFromString(input); err != ErrInvalidSyncPosition {
+			t.Errorf("NewSyncPositionFromString(%q): wanted ErrInvalidSyncPosition got %v", input, err)
+		}
+	}
+}